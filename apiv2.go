@@ -0,0 +1,657 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+	"github.com/AlexeyYurko/go-pmserver/db"
+	"github.com/AlexeyYurko/go-pmserver/manager"
+	stats "github.com/AlexeyYurko/go-pmserver/metrics"
+)
+
+// Error codes of API v2
+const (
+	codeInvalidParameter = "invalid_parameter"
+	codeUnknownScraper   = "unknown_scraper"
+	codeUnknownProxy     = "unknown_proxy"
+	codeScraperExists    = "scraper_exists"
+	codeNoProxy          = "no_proxy"
+	codeQuotaExceeded    = "quota_exceeded"
+	codeCircuitOpen      = "circuit_open"
+	codeNoAction         = "no_action"
+	codeNotFound         = "not_found"
+	codeMethodNotAllowed = "method_not_allowed"
+)
+
+// apiV2Prefix is path of API v2 routes
+const apiV2Prefix = "/api/v2"
+
+// apiError is error object of every failed API v2 request, answered as {"error": {...}}
+type apiError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// statusOK is answer of API v2 commands which return nothing else
+var statusOK = gin.H{"status": "ok"}
+
+func setupRouterV2(router *gin.Engine) {
+	router.HandleMethodNotAllowed = true
+	router.NoRoute(routeV2NoRoute)
+	router.NoMethod(routeV2NoMethod)
+
+	v2 := router.Group(apiV2Prefix)
+	v2.GET("/scrapers", routeV2ListScrapers)
+	v2.POST("/scrapers", routeV2AddScraper)
+	v2.POST("/scrapers/:scraper/rename", routeV2RenameScraper)
+	v2.DELETE("/scrapers/:scraper", routeV2DeleteScraper)
+	v2.GET("/scrapers/:scraper/proxy", routeV2GetRandom)
+	v2.POST("/scrapers/:scraper/good", routeV2Good)
+	v2.POST("/scrapers/:scraper/dead", routeV2Dead)
+	v2.POST("/scrapers/:scraper/outcomes", routeV2ReportOutcomes)
+	v2.POST("/scrapers/:scraper/reanimate", routeV2Reanimate)
+	v2.POST("/scrapers/:scraper/alive-from-dead", routeV2AliveFromDead)
+	v2.POST("/scrapers/:scraper/remove-dead", routeV2RemoveDead)
+	v2.POST("/scrapers/:scraper/start", routeV2Start)
+	v2.GET("/scrapers/:scraper/proxies", routeV2ListProxies)
+	v2.GET("/scrapers/:scraper/usefulness", routeV2Usefulness)
+	v2.GET("/scrapers/:scraper/policy", routeV2Policy)
+	v2.GET("/scrapers/:scraper/quota", routeV2Quota)
+	v2.GET("/scrapers/:scraper/circuit", routeV2Circuit)
+	v2.GET("/backoff-schedule", routeV2BackoffSchedule)
+	v2.POST("/proxies", routeV2AddProxies)
+	v2.POST("/proxies/remove", routeV2RemoveProxies)
+	v2.POST("/proxy-list/reload", routeV2ReloadProxyList)
+	v2.POST("/usefulness/clear", routeV2ClearUsefulness)
+	v2.GET("/settings", routeV2Settings)
+	v2.PUT("/settings", routeV2ChangeSettings)
+	v2.GET("/proxy-actions", routeV2ListProxyActions)
+	v2.POST("/proxy-actions", routeV2ProxyAction)
+	v2.POST("/proxy-actions/release", routeV2ReleaseProxy)
+	v2.GET("/stats", metrics)
+}
+
+// inAPIV2 checks if request is for API v2
+func inAPIV2(context *gin.Context) bool {
+	path := context.Request.URL.Path
+	return path == apiV2Prefix || strings.HasPrefix(path, apiV2Prefix+"/")
+}
+
+// routeV2NoRoute answers unknown API v2 path with error object, other paths as gin does
+func routeV2NoRoute(context *gin.Context) {
+	if !inAPIV2(context) {
+		context.String(http.StatusNotFound, "404 page not found")
+
+		return
+	}
+
+	abortV2(context, http.StatusNotFound, codeNotFound, "Unknown path "+context.Request.URL.Path)
+}
+
+// routeV2NoMethod answers API v2 path called with wrong method with error object,
+// other paths keep answering 404 as before
+func routeV2NoMethod(context *gin.Context) {
+	if !inAPIV2(context) {
+		context.String(http.StatusNotFound, "404 page not found")
+
+		return
+	}
+
+	abortV2(context, http.StatusMethodNotAllowed, codeMethodNotAllowed,
+		"Method "+context.Request.Method+" is not allowed for "+context.Request.URL.Path)
+}
+
+// abortV2 answers with error object
+func abortV2(context *gin.Context, status int, code, message string) {
+	context.AbortWithStatusJSON(status, gin.H{"error": apiError{Code: code, Message: message}})
+}
+
+func invalidV2(context *gin.Context, message string) {
+	abortV2(context, http.StatusBadRequest, codeInvalidParameter, message)
+}
+
+// scraperV2 returns scraper of the path, answering 404 if it is not registered
+func scraperV2(context *gin.Context, autoCreate bool) (scraper string, ok bool) {
+	scraper = context.Param("scraper")
+	if !ensureScraper(scraper, autoCreate) {
+		abortV2(context, http.StatusNotFound, codeUnknownScraper, "Unknown scraper "+scraper)
+
+		return "", false
+	}
+
+	return scraper, true
+}
+
+// proxyV2 checks proxy is in the pool of scraper, answering 404 if it is not
+func proxyV2(context *gin.Context, scraper, proxy string) bool {
+	if db.Base.ProxyNotInBase(scraper, proxy) {
+		abortV2(context, http.StatusNotFound, codeUnknownProxy, "Unknown proxy "+proxy+" of scraper "+scraper)
+
+		return false
+	}
+
+	return true
+}
+
+// bindV2 reads json body, answering 400 if it can't be read
+func bindV2(context *gin.Context, body any) bool {
+	if err := context.ShouldBindJSON(body); err != nil {
+		invalidV2(context, "Body is not valid json: "+err.Error())
+
+		return false
+	}
+
+	return true
+}
+
+func routeV2ListScrapers(context *gin.Context) {
+	scrapers := db.Scrapers()
+	sort.Strings(scrapers)
+	context.JSON(http.StatusOK, gin.H{"scrapers": scrapers})
+}
+
+// routeV2AddScraper format {"scraper": <name>}
+func routeV2AddScraper(context *gin.Context) {
+	var json struct {
+		Scraper string `json:"scraper"`
+	}
+
+	if !bindV2(context, &json) {
+		return
+	}
+
+	scraper := strings.TrimSpace(json.Scraper)
+	if scraper == "" {
+		invalidV2(context, "Field scraper is empty")
+
+		return
+	}
+
+	if err := db.AddScraper(scraper); err != nil {
+		abortV2(context, http.StatusConflict, codeScraperExists, err.Error())
+
+		return
+	}
+
+	context.JSON(http.StatusCreated, gin.H{"scraper": scraper})
+}
+
+// routeV2RenameScraper format {"new_name": <new name>}
+func routeV2RenameScraper(context *gin.Context) {
+	var json struct {
+		NewName string `json:"new_name"`
+	}
+
+	if !bindV2(context, &json) {
+		return
+	}
+
+	scraper := context.Param("scraper")
+	newName := strings.TrimSpace(json.NewName)
+
+	if newName == "" {
+		invalidV2(context, "Field new_name is empty")
+
+		return
+	}
+
+	switch err := db.RenameScraper(scraper, newName); {
+	case errors.Is(err, db.ErrUnknownScraper):
+		abortV2(context, http.StatusNotFound, codeUnknownScraper, "Unknown scraper "+scraper)
+
+		return
+	case err != nil:
+		abortV2(context, http.StatusConflict, codeScraperExists, err.Error())
+
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"scraper": newName})
+}
+
+func routeV2DeleteScraper(context *gin.Context) {
+	scraper := context.Param("scraper")
+
+	if err := db.RemoveScraper(scraper); err != nil {
+		abortV2(context, http.StatusNotFound, codeUnknownScraper, "Unknown scraper "+scraper)
+
+		return
+	}
+
+	context.JSON(http.StatusOK, statusOK)
+}
+
+// routeV2GetRandom takes the same query as /get-random
+func routeV2GetRandom(context *gin.Context) {
+	scraper, ok := scraperV2(context, config.AutoCreateScrapers)
+	if !ok {
+		return
+	}
+
+	selection, err := selectionFromQuery(context)
+	if err != nil {
+		invalidV2(context, err.Error())
+
+		return
+	}
+
+	randomProxy, err := manager.GetRandomProxy(scraper, selection)
+
+	switch {
+	case errors.Is(err, manager.ErrQuotaExceeded):
+		abortV2(context, http.StatusTooManyRequests, codeQuotaExceeded, "Quota of scraper "+scraper+" exceeded")
+	case errors.Is(err, manager.ErrCircuitOpen):
+		abortV2(context, http.StatusServiceUnavailable, codeCircuitOpen, "Circuit of scraper "+scraper+" is open")
+	case err != nil:
+		abortV2(context, http.StatusServiceUnavailable, codeNoProxy, "No proxy available for scraper "+scraper)
+	default:
+		context.JSON(http.StatusOK, gin.H{"proxy": randomProxy})
+	}
+}
+
+// routeV2Good format {"proxy": <proxy>, "latency": <ms, optional>, "domain": <target domain, optional>}
+func routeV2Good(context *gin.Context) {
+	scraper, ok := scraperV2(context, false)
+	if !ok {
+		return
+	}
+
+	var json struct {
+		Proxy   string   `json:"proxy"`
+		Latency *float64 `json:"latency"`
+		Domain  string   `json:"domain"`
+	}
+
+	if !bindV2(context, &json) {
+		return
+	}
+
+	if json.Proxy == "" {
+		invalidV2(context, "Field proxy is empty")
+
+		return
+	}
+
+	var latency float64 = -1
+
+	if json.Latency != nil {
+		if *json.Latency < 0 {
+			invalidV2(context, "Field latency is not a positive number")
+
+			return
+		}
+
+		latency = *json.Latency
+	}
+
+	if !proxyV2(context, scraper, json.Proxy) {
+		return
+	}
+
+	manager.IncGoodAttempts(scraper, json.Proxy)
+	manager.ReportLatency(scraper, json.Proxy, latency)
+
+	if domain := manager.NormalizeDomain(json.Domain); domain != "" {
+		manager.DomainPassed(scraper, json.Proxy, domain)
+	}
+
+	context.JSON(http.StatusOK, statusOK)
+}
+
+// routeV2Dead format {"proxy": <proxy>, "reason": <reason, optional>, "domain": <target domain, optional>}
+func routeV2Dead(context *gin.Context) {
+	scraper, ok := scraperV2(context, false)
+	if !ok {
+		return
+	}
+
+	var json struct {
+		Proxy  string `json:"proxy"`
+		Reason string `json:"reason"`
+		Domain string `json:"domain"`
+	}
+
+	if !bindV2(context, &json) {
+		return
+	}
+
+	if json.Proxy == "" {
+		invalidV2(context, "Field proxy is empty")
+
+		return
+	}
+
+	if !manager.ValidReason(json.Reason) {
+		invalidV2(context, "Field reason should be one of "+strings.Join(manager.FailureReasons, ", "))
+
+		return
+	}
+
+	if !proxyV2(context, scraper, json.Proxy) {
+		return
+	}
+
+	if domain := manager.NormalizeDomain(json.Domain); domain != "" {
+		manager.MarkDeadOnDomain(scraper, json.Proxy, domain, json.Reason)
+	} else {
+		manager.MarkDead(scraper, json.Proxy, json.Reason)
+	}
+
+	context.JSON(http.StatusOK, statusOK)
+}
+
+func routeV2Reanimate(context *gin.Context) {
+	if scraper, ok := scraperV2(context, false); ok {
+		manager.ReanimateProxies(scraper)
+		context.JSON(http.StatusOK, statusOK)
+	}
+}
+
+func routeV2AliveFromDead(context *gin.Context) {
+	if scraper, ok := scraperV2(context, false); ok {
+		db.Base.AliveFromDead(scraper)
+		context.JSON(http.StatusOK, statusOK)
+	}
+}
+
+func routeV2RemoveDead(context *gin.Context) {
+	if scraper, ok := scraperV2(context, false); ok {
+		manager.RemoveDeadProxiesForALongTime(scraper)
+		context.JSON(http.StatusOK, statusOK)
+	}
+}
+
+func routeV2Start(context *gin.Context) {
+	if scraper, ok := scraperV2(context, config.AutoCreateScrapers); ok {
+		log.Info().Msgf("%s\n", scraper)
+		context.JSON(http.StatusOK, statusOK)
+	}
+}
+
+// routeV2ListProxies lists working proxies of scraper, or dead ones with status=dead
+func routeV2ListProxies(context *gin.Context) {
+	scraper, ok := scraperV2(context, false)
+	if !ok {
+		return
+	}
+
+	var proxies []string
+
+	switch status := context.DefaultQuery("status", "working"); status {
+	case "working":
+		proxies = db.Set.GetWorking(scraper)
+	case "dead":
+		proxies = db.Set.GetDead(scraper)
+	default:
+		invalidV2(context, "Field status should be working or dead")
+
+		return
+	}
+
+	if proxies == nil {
+		proxies = []string{}
+	}
+
+	sort.Strings(proxies)
+	context.JSON(http.StatusOK, gin.H{"proxies": proxies})
+}
+
+func routeV2Usefulness(context *gin.Context) {
+	scraper, ok := scraperV2(context, false)
+	if !ok {
+		return
+	}
+
+	orderBy := context.DefaultQuery("order_by", "name")
+	if !slices.Contains(statsOrders, orderBy) {
+		invalidV2(context, "Field order_by should be one of "+strings.Join(statsOrders, ", "))
+
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"proxies": stats.ProxyUsefulnessStats(scraper, orderBy)})
+}
+
+func routeV2Policy(context *gin.Context) {
+	if scraper, ok := scraperV2(context, false); ok {
+		context.JSON(http.StatusOK, manager.EffectivePolicy(scraper))
+	}
+}
+
+func routeV2Quota(context *gin.Context) {
+	if scraper, ok := scraperV2(context, false); ok {
+		context.JSON(http.StatusOK, manager.UsageOfQuota(scraper))
+	}
+}
+
+func routeV2Circuit(context *gin.Context) {
+	if scraper, ok := scraperV2(context, false); ok {
+		context.JSON(http.StatusOK, manager.CircuitOf(scraper))
+	}
+}
+
+// routeV2BackoffSchedule takes the same query as /backoff-schedule
+func routeV2BackoffSchedule(context *gin.Context) {
+	schedule, err := backoffScheduleFromQuery(context)
+
+	switch {
+	case errors.Is(err, db.ErrUnknownScraper):
+		abortV2(context, http.StatusNotFound, codeUnknownScraper, "Unknown scraper "+context.Query("scraper"))
+	case err != nil:
+		invalidV2(context, err.Error())
+	default:
+		context.JSON(http.StatusOK, schedule)
+	}
+}
+
+// proxiesBody is body of adding and removing proxies, empty scraper is for all scrapers
+type proxiesBody struct {
+	Scraper string   `json:"scraper"`
+	Proxies []string `json:"proxies"`
+}
+
+// bindProxiesV2 reads and checks body of adding and removing proxies
+func bindProxiesV2(context *gin.Context, autoCreate bool) (body proxiesBody, ok bool) {
+	if !bindV2(context, &body) {
+		return body, false
+	}
+
+	if len(body.Proxies) == 0 {
+		invalidV2(context, "Empty proxies list")
+
+		return body, false
+	}
+
+	if body.Scraper != "" && !ensureScraper(body.Scraper, autoCreate) {
+		abortV2(context, http.StatusNotFound, codeUnknownScraper, "Unknown scraper "+body.Scraper)
+
+		return body, false
+	}
+
+	return body, true
+}
+
+// routeV2AddProxies format {"scraper": <name, empty for all scrapers>, "proxies": [list_of_proxies]},
+// answers with numbers of proxies filtered out by blocklist by scraper
+func routeV2AddProxies(context *gin.Context) {
+	body, ok := bindProxiesV2(context, config.AutoCreateScrapers)
+	if !ok {
+		return
+	}
+
+	filtered := db.StoreProxies(body.Scraper, body.Proxies)
+	if filtered == nil {
+		filtered = map[string]int{}
+	}
+
+	context.JSON(http.StatusOK, gin.H{"filtered": filtered})
+}
+
+// routeV2RemoveProxies format {"scraper": <name, empty for all scrapers>, "proxies": [list_of_proxies]}
+func routeV2RemoveProxies(context *gin.Context) {
+	body, ok := bindProxiesV2(context, false)
+	if !ok {
+		return
+	}
+
+	db.Base.RemoveProxies(body.Scraper, body.Proxies)
+	context.JSON(http.StatusOK, statusOK)
+}
+
+func routeV2ReloadProxyList(context *gin.Context) {
+	reloadProxies()
+	context.JSON(http.StatusOK, statusOK)
+}
+
+func routeV2ClearUsefulness(context *gin.Context) {
+	db.Base.ClearUsefulnessStats()
+	context.JSON(http.StatusOK, statusOK)
+}
+
+// settingsV2 are settings changeable in runtime
+type settingsV2 struct {
+	RemoveDeadDays  *int64 `json:"remove_dead_days"`
+	MaxGoodAttempts *int32 `json:"max_good_attempts"`
+}
+
+func currentSettingsV2() settingsV2 {
+	removeDeadDays := config.RemoveDeadTime / (hoursInDay * minsInHour * secsInMinute)
+	maxGoodAttempts := config.MaxGoodAttempts
+
+	return settingsV2{RemoveDeadDays: &removeDeadDays, MaxGoodAttempts: &maxGoodAttempts}
+}
+
+func routeV2Settings(context *gin.Context) {
+	context.JSON(http.StatusOK, currentSettingsV2())
+}
+
+// routeV2ChangeSettings format {"remove_dead_days": <days, optional>, "max_good_attempts": <number, optional>}
+func routeV2ChangeSettings(context *gin.Context) {
+	var json settingsV2
+
+	if !bindV2(context, &json) {
+		return
+	}
+
+	if json.RemoveDeadDays != nil && *json.RemoveDeadDays < 0 {
+		invalidV2(context, "Field remove_dead_days is negative")
+
+		return
+	}
+
+	if json.MaxGoodAttempts != nil && *json.MaxGoodAttempts < 1 {
+		invalidV2(context, "Field max_good_attempts should be positive")
+
+		return
+	}
+
+	if json.RemoveDeadDays != nil {
+		config.SetRemoveDeadTime(*json.RemoveDeadDays * hoursInDay * minsInHour * secsInMinute)
+	}
+
+	if json.MaxGoodAttempts != nil {
+		config.SetMaxGoodAttempts(*json.MaxGoodAttempts)
+	}
+
+	context.JSON(http.StatusOK, currentSettingsV2())
+}
+
+func routeV2ListProxyActions(context *gin.Context) {
+	scraper := context.Query("scraper")
+	if scraper != "" && !ensureScraper(scraper, false) {
+		abortV2(context, http.StatusNotFound, codeUnknownScraper, "Unknown scraper "+scraper)
+
+		return
+	}
+
+	actions := db.Actions.List(scraper)
+	if actions == nil {
+		actions = []db.ProxyAction{}
+	}
+
+	context.JSON(http.StatusOK, gin.H{"actions": actions})
+}
+
+// routeV2ProxyAction takes the same body as /proxy-action
+func routeV2ProxyAction(context *gin.Context) {
+	var json struct {
+		Scraper string `json:"scraper"`
+		Proxy   string `json:"proxy"`
+		Action  string `json:"action"`
+		Reason  string `json:"reason"`
+		Actor   string `json:"actor"`
+	}
+
+	if !bindV2(context, &json) {
+		return
+	}
+
+	if json.Proxy == "" {
+		invalidV2(context, "Field proxy is empty")
+
+		return
+	}
+
+	if !db.ValidAction(json.Action) {
+		invalidV2(context, "Field action should be quarantine, pin or block")
+
+		return
+	}
+
+	if json.Scraper != "" && !ensureScraper(json.Scraper, false) {
+		abortV2(context, http.StatusNotFound, codeUnknownScraper, "Unknown scraper "+json.Scraper)
+
+		return
+	}
+
+	action := db.ProxyAction{
+		Scraper: json.Scraper,
+		Proxy:   json.Proxy,
+		Action:  json.Action,
+		Reason:  json.Reason,
+		Actor:   actor(context, json.Actor),
+	}
+	db.TakeAction(action)
+
+	context.JSON(http.StatusOK, statusOK)
+}
+
+// routeV2ReleaseProxy takes the same body as /release-proxy
+func routeV2ReleaseProxy(context *gin.Context) {
+	var json struct {
+		Scraper string `json:"scraper"`
+		Proxy   string `json:"proxy"`
+		Actor   string `json:"actor"`
+	}
+
+	if !bindV2(context, &json) {
+		return
+	}
+
+	if json.Proxy == "" {
+		invalidV2(context, "Field proxy is empty")
+
+		return
+	}
+
+	if json.Scraper != "" && !ensureScraper(json.Scraper, false) {
+		abortV2(context, http.StatusNotFound, codeUnknownScraper, "Unknown scraper "+json.Scraper)
+
+		return
+	}
+
+	if err := db.ReleaseProxy(json.Scraper, json.Proxy, actor(context, json.Actor)); errors.Is(err, db.ErrNoAction) {
+		abortV2(context, http.StatusNotFound, codeNoAction, "No action taken on proxy "+json.Proxy)
+
+		return
+	}
+
+	context.JSON(http.StatusOK, statusOK)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+	"github.com/AlexeyYurko/go-pmserver/db"
+)
+
+func TestAPIV2Errors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	config.Scrapers = []string{"ra"}
+	config.Groups = nil
+	config.ProxyrackProxyIP = []string{"9.9.9.9"}
+	config.AutoCreateScrapers = false
+	db.Init()
+	db.StoreProxies("", []string{"1.1.1.1:80"})
+	router := setupRouter()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		code   string
+	}{
+		{name: "good of known proxy", method: http.MethodPost, path: "/api/v2/scrapers/ra/good",
+			body: `{"proxy": "1.1.1.1:80"}`, status: http.StatusOK},
+		{name: "good of unknown proxy", method: http.MethodPost, path: "/api/v2/scrapers/ra/good",
+			body: `{"proxy": "2.2.2.2:80"}`, status: http.StatusNotFound, code: codeUnknownProxy},
+		{name: "dead of unknown proxy", method: http.MethodPost, path: "/api/v2/scrapers/ra/dead",
+			body: `{"proxy": "2.2.2.2:80", "reason": "banned"}`, status: http.StatusNotFound, code: codeUnknownProxy},
+		{name: "dead with wrong reason", method: http.MethodPost, path: "/api/v2/scrapers/ra/dead",
+			body: `{"proxy": "2.2.2.2:80", "reason": "tired"}`, status: http.StatusBadRequest, code: codeInvalidParameter},
+		{name: "start of known scraper", method: http.MethodPost, path: "/api/v2/scrapers/ra/start", status: http.StatusOK},
+		{name: "start of unknown scraper", method: http.MethodPost, path: "/api/v2/scrapers/nobody/start",
+			status: http.StatusNotFound, code: codeUnknownScraper},
+		{name: "unknown path", method: http.MethodGet, path: "/api/v2/nothing", status: http.StatusNotFound, code: codeNotFound},
+		{name: "wrong method", method: http.MethodGet, path: "/api/v2/scrapers/ra/good",
+			status: http.StatusMethodNotAllowed, code: codeMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body)))
+		if recorder.Code != tt.status {
+			t.Errorf("%s: status %d, want %d: %s", tt.name, recorder.Code, tt.status, recorder.Body)
+			continue
+		}
+		if tt.code == "" {
+			continue
+		}
+		var answer struct {
+			Error apiError `json:"error"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &answer); err != nil || answer.Error.Code != tt.code {
+			t.Errorf("%s: answer %s, want code %s", tt.name, recorder.Body, tt.code)
+		}
+	}
+}
+
+func TestLegacyRoutesKeepPlainNotFound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := setupRouter()
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		recorder := httptest.NewRecorder()
+		path := "/nothing"
+		if method == http.MethodPost {
+			// registered for GET only
+			path = "/get-random"
+		}
+		router.ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+		if recorder.Code != http.StatusNotFound || strings.HasPrefix(recorder.Body.String(), "{") {
+			t.Errorf("%s %s: status %d, body %s, want plain 404", method, path, recorder.Code, recorder.Body)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package blocklist
+
+import (
+	"bufio"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// asnRange is a range of addresses announced by one autonomous system
+type asnRange struct {
+	start netip.Addr
+	end   netip.Addr
+	asn   uint32
+}
+
+// ASNDatabase maps addresses to autonomous systems
+type ASNDatabase struct {
+	ranges []asnRange
+}
+
+// LoadASNDatabase reads file with tab or space separated range start, range end and AS number per line,
+// as in ip2asn-v4.tsv, anything after AS number is ignored, so are blank lines and # comments
+func LoadASNDatabase(path string) (*ASNDatabase, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	database := &ASNDatabase{}
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("%s:%d: want range start, range end and AS number", path, lineNumber)
+		}
+		start, err := netip.ParseAddr(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+		}
+		end, err := netip.ParseAddr(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+		}
+		asn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(fields[2]), "AS"), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNumber, err)
+		}
+		// ip2asn marks not routed ranges with AS 0
+		if asn == 0 {
+			continue
+		}
+		database.ranges = append(database.ranges, asnRange{start: start.Unmap(), end: end.Unmap(), asn: uint32(asn)})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(database.ranges, func(i, j int) bool {
+		return database.ranges[i].start.Less(database.ranges[j].start)
+	})
+	return database, nil
+}
+
+// Lookup returns autonomous system announcing address, ok is false if it is unknown
+func (d *ASNDatabase) Lookup(addr netip.Addr) (asn uint32, ok bool) {
+	if d == nil {
+		return 0, false
+	}
+	addr = addr.Unmap()
+	// the last range starting not after addr
+	position := sort.Search(len(d.ranges), func(i int) bool {
+		return addr.Less(d.ranges[i].start)
+	}) - 1
+	if position < 0 {
+		return 0, false
+	}
+	found := d.ranges[position]
+	if found.end.Less(addr) || found.start.BitLen() != addr.BitLen() {
+		return 0, false
+	}
+	return found.asn, true
+}
+
+// Len returns number of ranges in database
+func (d *ASNDatabase) Len() int {
+	if d == nil {
+		return 0
+	}
+	return len(d.ranges)
+}
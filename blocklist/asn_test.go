@@ -0,0 +1,95 @@
+package blocklist
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const asnTable = `# range start, range end, AS number, country, name
+1.0.0.0	1.0.0.255	13335	US	CLOUDFLARENET
+1.0.4.0	1.0.7.255	38803	AU	GTELECOM
+2.0.0.0	2.0.0.255	0	None	Not routed
+
+2001:db8::	2001:db8::ffff	64500	ZZ	DOCUMENTATION
+2001:db8:1::	2001:db8:1:ffff:ffff:ffff:ffff:ffff	AS64501	ZZ	DOCUMENTATION
+`
+
+func writeDatabase(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ip2asn.tsv")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadASNDatabase(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		ranges  int
+		wantErr bool
+	}{
+		{name: "ip2asn", content: asnTable, ranges: 4},
+		{name: "empty", content: "# nothing\n\n", ranges: 0},
+		{name: "missing AS number", content: "1.0.0.0 1.0.0.255\n", wantErr: true},
+		{name: "broken range start", content: "1.0.0 1.0.0.255 13335\n", wantErr: true},
+		{name: "broken range end", content: "1.0.0.0 1.0.0.256 13335\n", wantErr: true},
+		{name: "broken AS number", content: "1.0.0.0 1.0.0.255 ASX\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		database, err := LoadASNDatabase(writeDatabase(t, tt.content))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && database.Len() != tt.ranges {
+			t.Errorf("%s: %d ranges, want %d", tt.name, database.Len(), tt.ranges)
+		}
+	}
+	if _, err := LoadASNDatabase(filepath.Join(t.TempDir(), "missing.tsv")); err == nil {
+		t.Error("missing file gave no error")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	database, err := LoadASNDatabase(writeDatabase(t, asnTable))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		addr  string
+		asn   uint32
+		found bool
+	}{
+		{addr: "1.0.0.0", asn: 13335, found: true},
+		{addr: "1.0.0.128", asn: 13335, found: true},
+		{addr: "1.0.0.255", asn: 13335, found: true},
+		{addr: "1.0.1.0"},
+		{addr: "1.0.5.1", asn: 38803, found: true},
+		{addr: "::ffff:1.0.5.1", asn: 38803, found: true},
+		{addr: "0.255.255.255"},
+		// not routed range is left out
+		{addr: "2.0.0.1"},
+		{addr: "200.0.0.1"},
+		{addr: "2001:db8::1", asn: 64500, found: true},
+		{addr: "2001:db8::ffff", asn: 64500, found: true},
+		{addr: "2001:db8::1:0"},
+		{addr: "2001:db8:1::abcd", asn: 64501, found: true},
+		{addr: "2001:db9::1"},
+		{addr: "::1"},
+	}
+	for _, tt := range tests {
+		asn, found := database.Lookup(netip.MustParseAddr(tt.addr))
+		if asn != tt.asn || found != tt.found {
+			t.Errorf("Lookup(%s) = %d, %v, want %d, %v", tt.addr, asn, found, tt.asn, tt.found)
+		}
+	}
+
+	var missing *ASNDatabase
+	if _, found := missing.Lookup(netip.MustParseAddr("1.0.0.1")); found {
+		t.Error("nil database found address")
+	}
+}
@@ -0,0 +1,168 @@
+package blocklist
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+)
+
+// ErrNoASNDatabase returned when autonomous systems are blocked but there is no database to look them up
+var ErrNoASNDatabase = errors.New("asns are blocked but asn-database is not set")
+
+// Filter tells if proxy is in blocked ranges or autonomous systems
+type Filter struct {
+	prefixes []netip.Prefix
+	asns     map[uint32]bool
+	database *ASNDatabase
+}
+
+var (
+	asnDatabase *ASNDatabase
+	filters     = struct {
+		sync.RWMutex
+		byScraper map[string]*Filter
+	}{byScraper: make(map[string]*Filter)}
+)
+
+// Init loads ASN database from config and checks blocklists of all scrapers
+func Init() error {
+	asnDatabase = nil
+	if config.ASNDatabase != "" {
+		database, err := LoadASNDatabase(config.ASNDatabase)
+		if err != nil {
+			return err
+		}
+		asnDatabase = database
+		log.Info().Int("ranges", database.Len()).Str("file", config.ASNDatabase).Msg("ASN database loaded")
+	}
+
+	filters.Lock()
+	filters.byScraper = make(map[string]*Filter)
+	filters.Unlock()
+
+	if _, err := NewFilter(config.GlobalBlocklist, asnDatabase); err != nil {
+		return err
+	}
+	for _, scraper := range config.Scrapers {
+		if _, err := NewFilter(config.PolicyFor(scraper).Blocklist, asnDatabase); err != nil {
+			return fmt.Errorf("scraper %s: %w", scraper, err)
+		}
+	}
+	return nil
+}
+
+// For returns blocklist filter of scraper
+func For(scraper string) *Filter {
+	filters.RLock()
+	filter, ok := filters.byScraper[scraper]
+	filters.RUnlock()
+	if ok {
+		return filter
+	}
+
+	filter, err := NewFilter(config.PolicyFor(scraper).Blocklist, asnDatabase)
+	if err != nil {
+		// lists are checked by Init, so this is a scraper whose settings were never checked
+		log.Warn().Err(err).Str("scraper", scraper).Msg("blocklist of scraper is ignored")
+		filter = &Filter{}
+	}
+	filters.Lock()
+	filters.byScraper[scraper] = filter
+	filters.Unlock()
+	return filter
+}
+
+// NewFilter builds filter from blocklist, database is needed only if autonomous systems are blocked
+func NewFilter(list config.Blocklist, database *ASNDatabase) (*Filter, error) {
+	filter := &Filter{database: database}
+	for _, cidr := range list.CIDRs {
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(cidr))
+		if err != nil {
+			return nil, err
+		}
+		filter.prefixes = append(filter.prefixes, prefix.Masked())
+	}
+	if len(list.ASNs) > 0 {
+		if database == nil {
+			return nil, ErrNoASNDatabase
+		}
+		filter.asns = make(map[uint32]bool, len(list.ASNs))
+		for _, asn := range list.ASNs {
+			filter.asns[asn] = true
+		}
+	}
+	return filter, nil
+}
+
+// Empty checks if filter blocks nothing
+func (f *Filter) Empty() bool {
+	return len(f.prefixes) == 0 && len(f.asns) == 0
+}
+
+// Blocked checks if proxy is in blocked range or autonomous system, proxies given by host name are never blocked
+func (f *Filter) Blocked(proxy string) bool {
+	if f.Empty() {
+		return false
+	}
+	addr, ok := proxyAddr(proxy)
+	if !ok {
+		return false
+	}
+	for _, prefix := range f.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	if len(f.asns) > 0 {
+		if asn, found := f.database.Lookup(addr); found && f.asns[asn] {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyAddr finds ip address in proxy written as ip, ip:port, user:password@ip:port or ip:port:user:password,
+// with or without scheme
+func proxyAddr(proxy string) (netip.Addr, bool) {
+	host := proxy
+	if position := strings.Index(host, "://"); position >= 0 {
+		host = host[position+3:]
+	}
+	if position := strings.LastIndex(host, "@"); position >= 0 {
+		host = host[position+1:]
+	}
+	host = strings.TrimSuffix(host, "/")
+	if addrPort, err := netip.ParseAddrPort(host); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	if addr, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+		return addr.Unmap(), true
+	}
+	if addrPort, ok := addrPortBeforeCredentials(host); ok {
+		return addrPort.Addr().Unmap(), true
+	}
+	return netip.Addr{}, false
+}
+
+// addrPortBeforeCredentials parses ip:port:user:password, IPv6 address is written in brackets there
+func addrPortBeforeCredentials(host string) (netip.AddrPort, bool) {
+	hostEnd := strings.Index(host, ":")
+	if strings.HasPrefix(host, "[") {
+		hostEnd = strings.Index(host, "]:") + 1
+	}
+	if hostEnd <= 0 {
+		return netip.AddrPort{}, false
+	}
+	port, credentials, ok := strings.Cut(host[hostEnd+1:], ":")
+	if !ok || !strings.Contains(credentials, ":") {
+		return netip.AddrPort{}, false
+	}
+	addrPort, err := netip.ParseAddrPort(host[:hostEnd] + ":" + port)
+	return addrPort, err == nil
+}
@@ -0,0 +1,211 @@
+package checker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/AlexeyYurko/go-pmserver/db"
+	"github.com/AlexeyYurko/go-pmserver/now"
+)
+
+const maxEchoSize = 64 << 10
+
+// proxyHeaders are added by proxies which do not hide the fact of proxying
+var proxyHeaders = []string{
+	"Via", "Forwarded", "X-Forwarded-For", "X-Forwarded-Host", "X-Real-Ip", "Forwarded-For",
+	"Client-Ip", "X-Client-Ip", "X-Proxy-Id", "Proxy-Connection", "X-Originating-Ip",
+}
+
+// EchoResponse is what echo endpoint tells about the request it got
+type EchoResponse struct {
+	IP      string              `json:"ip"`
+	Headers map[string][]string `json:"headers"`
+}
+
+// AnonymityResult of single anonymity probe
+type AnonymityResult struct {
+	ExitIP    string
+	Anonymity string
+	// Advertised is false when proxy exits through other ip than the one in its address
+	Advertised bool
+}
+
+// OriginIP asks echo endpoint directly for our own ip, it is what transparent proxies leak
+func (c *Checker) OriginIP(ctx context.Context) (string, error) {
+	if c.RealIP != "" {
+		return c.RealIP, nil
+	}
+	echo, err := c.echo(ctx, &http.Transport{})
+	if err != nil {
+		return "", err
+	}
+	return echo.IP, nil
+}
+
+// ProbeAnonymity requests echo endpoint through proxy and classifies what reached it
+func (c *Checker) ProbeAnonymity(ctx context.Context, proxy, originIP string) (result AnonymityResult, err error) {
+	proxyURL, err := ProxyURL(proxy)
+	if err != nil {
+		return result, err
+	}
+	echo, err := c.echo(ctx, &http.Transport{Proxy: http.ProxyURL(proxyURL), DisableKeepAlives: true})
+	if err != nil {
+		return result, err
+	}
+
+	result.ExitIP = echo.IP
+	result.Anonymity = classify(echo.Headers, originIP)
+	result.Advertised = advertisedIP(proxyURL.Hostname(), echo.IP)
+	return result, nil
+}
+
+func (c *Checker) echo(ctx context.Context, transport *http.Transport) (echo EchoResponse, err error) {
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport, Timeout: c.Timeout}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.EchoURL, http.NoBody)
+	if err != nil {
+		return echo, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return echo, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return echo, &StatusError{StatusCode: resp.StatusCode}
+	}
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxEchoSize)).Decode(&echo); err != nil {
+		return echo, fmt.Errorf("bad echo response: %w", err)
+	}
+	if echo.IP == "" {
+		return echo, errors.New("echo response has no ip")
+	}
+	return echo, nil
+}
+
+// classify finds out anonymity level from headers which reached echo endpoint
+func classify(headers map[string][]string, originIP string) string {
+	header := http.Header(headers)
+	if origin, err := netip.ParseAddr(originIP); err == nil {
+		for _, values := range header {
+			for _, value := range values {
+				if leaks(value, origin.Unmap()) {
+					return db.AnonymityTransparent
+				}
+			}
+		}
+	}
+	for _, name := range proxyHeaders {
+		if header.Get(name) != "" {
+			return db.AnonymityAnonymous
+		}
+	}
+	return db.AnonymityElite
+}
+
+// leaks checks if header value lists origin among its addresses, like X-Forwarded-For: 1.2.3.4, 5.6.7.8
+// or Forwarded: for="[2001:db8::1]:4711";proto=http
+func leaks(value string, origin netip.Addr) bool {
+	for _, element := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' }) {
+		if addr, ok := addressOf(element); ok && addr == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// addressOf parses ip of header element, with optional port, brackets, quotes or for= prefix
+func addressOf(element string) (netip.Addr, bool) {
+	element = strings.TrimSpace(element)
+	if name, address, ok := strings.Cut(element, "="); ok && strings.EqualFold(strings.TrimSpace(name), "for") {
+		element = address
+	}
+	element = strings.Trim(element, `" `)
+	if addrPort, err := netip.ParseAddrPort(element); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	addr, err := netip.ParseAddr(strings.Trim(element, "[]"))
+	return addr.Unmap(), err == nil
+}
+
+// advertisedIP compares exit ip with proxy host, hostnames are resolved
+func advertisedIP(host, exitIP string) bool {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.Equal(net.ParseIP(exitIP))
+	}
+	addresses, err := net.LookupHost(host)
+	if err != nil {
+		return false
+	}
+	for _, address := range addresses {
+		if address == exitIP {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAnonymity probes proxies with unknown or outdated anonymity level
+func (c *Checker) checkAnonymity(ctx context.Context) {
+	proxies := c.collectForAnonymity()
+	if len(proxies) == 0 {
+		return
+	}
+	originIP, err := c.OriginIP(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Could not find out origin ip, anonymity check skipped")
+		return
+	}
+	log.Info().Int("count", len(proxies)).Msg("Checking proxies anonymity")
+
+	var probed, leaking atomic.Int32
+	c.probeEach(proxies, func(proxy string) {
+		result, err := c.ProbeAnonymity(ctx, proxy, originIP)
+		if err != nil {
+			log.Debug().Err(err).Str("proxy", proxy).Msg("anonymity probe failed")
+			return
+		}
+		db.Base.StoreAnonymity(proxy, result.ExitIP, result.Anonymity, now.Time())
+		probed.Add(1)
+		if result.Anonymity == db.AnonymityTransparent || !result.Advertised {
+			leaking.Add(1)
+			log.Info().
+				Str("proxy", proxy).
+				Str("exit_ip", result.ExitIP).
+				Str("anonymity", result.Anonymity).
+				Bool("advertised", result.Advertised).
+				Msg("proxy leaks origin ip or exits through other ip")
+		}
+	})
+	log.Info().Int32("probed", probed.Load()).Int32("leaking", leaking.Load()).Msg("Anonymity check finished")
+}
+
+func (c *Checker) collectForAnonymity() (proxies []string) {
+	seen := make(map[string]bool)
+	currentTime := now.Time()
+	for _, scraper := range db.Scrapers() {
+		for _, proxy := range db.Set.GetWorking(scraper) {
+			if seen[proxy] || (c.BatchSize > 0 && len(proxies) >= c.BatchSize) {
+				continue
+			}
+			seen[proxy] = true
+			checked := db.Base.AnonymityChecked(scraper, proxy)
+			if checked == 0 || (c.AnonymityRecheck > 0 && checked+c.AnonymityRecheck <= currentTime) {
+				proxies = append(proxies, proxy)
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,32 @@
+package checker
+
+import (
+	"testing"
+
+	"github.com/AlexeyYurko/go-pmserver/db"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string][]string
+		origin  string
+		want    string
+	}{
+		{name: "no proxy headers", headers: map[string][]string{"Accept": {"*/*"}}, origin: "1.2.3.4", want: db.AnonymityElite},
+		{name: "via", headers: map[string][]string{"Via": {"1.1 squid"}}, origin: "1.2.3.4", want: db.AnonymityAnonymous},
+		{name: "forwarded for origin", headers: map[string][]string{"X-Forwarded-For": {"1.2.3.4"}}, origin: "1.2.3.4", want: db.AnonymityTransparent},
+		{name: "origin in chain", headers: map[string][]string{"X-Forwarded-For": {"10.0.0.1, 1.2.3.4"}}, origin: "1.2.3.4", want: db.AnonymityTransparent},
+		{name: "origin with port", headers: map[string][]string{"X-Real-Ip": {"1.2.3.4:5555"}}, origin: "1.2.3.4", want: db.AnonymityTransparent},
+		{name: "longer address is not origin", headers: map[string][]string{"X-Forwarded-For": {"11.2.3.45"}}, origin: "1.2.3.4", want: db.AnonymityAnonymous},
+		{name: "address in other header text", headers: map[string][]string{"User-Agent": {"bot/11.2.3.45"}}, origin: "1.2.3.4", want: db.AnonymityElite},
+		{name: "forwarded ipv6", headers: map[string][]string{"Forwarded": {`for="[2001:db8::1]:4711";proto=http`}}, origin: "2001:db8::1", want: db.AnonymityTransparent},
+		{name: "mapped ipv4", headers: map[string][]string{"X-Forwarded-For": {"::ffff:1.2.3.4"}}, origin: "1.2.3.4", want: db.AnonymityTransparent},
+		{name: "unknown origin", headers: map[string][]string{"X-Forwarded-For": {"1.2.3.4"}}, origin: "", want: db.AnonymityAnonymous},
+	}
+	for _, tt := range tests {
+		if got := classify(tt.headers, tt.origin); got != tt.want {
+			t.Errorf("%s: classify = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
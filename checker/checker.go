@@ -0,0 +1,252 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+	"github.com/AlexeyYurko/go-pmserver/db"
+	"github.com/AlexeyYurko/go-pmserver/manager"
+	"github.com/AlexeyYurko/go-pmserver/proxyurl"
+)
+
+const (
+	defaultTimeout     = 10 * time.Second
+	defaultConcurrency = 10
+	maxDrainSize       = 64 << 10
+)
+
+// ErrUnexpectedStatus returned when target answered through proxy with wrong status code
+var ErrUnexpectedStatus = errors.New("unexpected status code")
+
+// errBadProxyAddress is returned for proxy whose address can't be read, nothing was sent through it,
+// so it is not a failure of the proxy
+var errBadProxyAddress = errors.New("bad proxy address")
+
+// StatusError keeps status code the target answered with, it matches ErrUnexpectedStatus
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: %d", ErrUnexpectedStatus, e.StatusCode)
+}
+
+func (e *StatusError) Unwrap() error {
+	return ErrUnexpectedStatus
+}
+
+// Checker probes proxies by sending test request through them to the target
+type Checker struct {
+	Target         string
+	Timeout        time.Duration
+	Concurrency    int
+	BatchSize      int
+	ExpectedStatus int
+	// EchoURL of echo endpoint for anonymity probes, empty to skip them
+	EchoURL string
+	// RealIP is our own ip, found out through echo endpoint if empty
+	RealIP string
+	// AnonymityRecheck period in seconds after which anonymity is probed again, 0 to probe only once
+	AnonymityRecheck int64
+
+	running atomic.Bool
+}
+
+// New creates checker for target url
+func New(target string, timeout time.Duration, concurrency int) *Checker {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	if concurrency <= 0 {
+		concurrency = defaultConcurrency
+	}
+	return &Checker{
+		Target:      target,
+		Timeout:     timeout,
+		Concurrency: concurrency,
+	}
+}
+
+// NewFromConfig creates checker with settings from config.yml
+func NewFromConfig() *Checker {
+	c := New(config.CheckerURL, time.Duration(config.CheckerTimeout)*time.Second, config.CheckerConcurrency)
+	c.BatchSize = config.CheckerBatchSize
+	c.ExpectedStatus = config.CheckerExpectedStatus
+	c.EchoURL = config.CheckerEchoURL
+	c.RealIP = config.CheckerRealIP
+	c.AnonymityRecheck = config.CheckerAnonymityRecheck
+	return c
+}
+
+// ProxyURL converts proxy from the list to url, see proxyurl.Parse for the forms it is read in
+func ProxyURL(proxy string) (*url.URL, error) {
+	proxyURL, err := proxyurl.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errBadProxyAddress, err)
+	}
+	return proxyURL, nil
+}
+
+// Probe sends single request to the target through proxy
+func (c *Checker) Probe(ctx context.Context, proxy string) error {
+	proxyURL, err := ProxyURL(proxy)
+	if err != nil {
+		return err
+	}
+	transport := &http.Transport{
+		Proxy:             http.ProxyURL(proxyURL),
+		DisableKeepAlives: true,
+	}
+	defer transport.CloseIdleConnections()
+	client := &http.Client{Transport: transport, Timeout: c.Timeout}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Target, http.NoBody)
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxDrainSize))
+
+	if !c.statusAccepted(resp.StatusCode) {
+		return &StatusError{StatusCode: resp.StatusCode}
+	}
+	return nil
+}
+
+func (c *Checker) statusAccepted(statusCode int) bool {
+	if c.ExpectedStatus != 0 {
+		return statusCode == c.ExpectedStatus
+	}
+	return statusCode >= http.StatusOK && statusCode < http.StatusMultipleChoices
+}
+
+// Run checks unchecked proxies of all scrapers, every proxy is probed once per run
+// and the result is applied to each scraper where it is still unchecked.
+// Anonymity of working proxies is probed afterwards if echo url is set.
+// Run is skipped if the previous one has not finished yet.
+func (c *Checker) Run() {
+	if !c.running.CompareAndSwap(false, true) {
+		log.Info().Msg("Previous proxy check is still running")
+		return
+	}
+	defer c.running.Store(false)
+
+	ctx := context.Background()
+	c.checkHealth(ctx)
+	if c.EchoURL != "" {
+		c.checkAnonymity(ctx)
+	}
+}
+
+func (c *Checker) checkHealth(ctx context.Context) {
+	scrapersByProxy := c.collect()
+	if len(scrapersByProxy) == 0 {
+		return
+	}
+	log.Info().Int("count", len(scrapersByProxy)).Msg("Checking unchecked proxies")
+
+	proxies := make([]string, 0, len(scrapersByProxy))
+	for proxy := range scrapersByProxy {
+		proxies = append(proxies, proxy)
+	}
+
+	var passed, failed, skipped atomic.Int32
+	c.probeEach(proxies, func(proxy string) {
+		start := time.Now()
+		err := c.Probe(ctx, proxy)
+		if errors.Is(err, errBadProxyAddress) {
+			// nothing went through the proxy, it stays unchecked
+			skipped.Add(1)
+			log.Warn().Err(err).Str("proxy", proxy).Msg("proxy address can't be used for health check")
+			return
+		}
+		latency := float64(time.Since(start)) / float64(time.Millisecond)
+		for _, scraper := range scrapersByProxy[proxy] {
+			if err == nil {
+				manager.CheckPassed(scraper, proxy)
+				manager.ReportLatency(scraper, proxy, latency)
+			} else {
+				manager.CheckFailed(scraper, proxy, FailureReason(err))
+			}
+		}
+		if err == nil {
+			passed.Add(1)
+		} else {
+			failed.Add(1)
+			log.Debug().Err(err).Str("proxy", proxy).Msg("proxy failed health check")
+		}
+	})
+	log.Info().
+		Int32("passed", passed.Load()).
+		Int32("failed", failed.Load()).
+		Int32("skipped", skipped.Load()).
+		Msg("Proxy check finished")
+}
+
+// FailureReason translates probe error to MarkDead reason
+func FailureReason(err error) string {
+	var statusErr *StatusError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &statusErr):
+		switch {
+		case statusErr.StatusCode >= http.StatusInternalServerError:
+			return manager.ReasonHTTP5xx
+		case statusErr.StatusCode == http.StatusForbidden || statusErr.StatusCode == http.StatusTooManyRequests:
+			return manager.ReasonBanned
+		}
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return manager.ReasonRefused
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return manager.ReasonTimeout
+	}
+	return manager.ReasonCustom
+}
+
+// collect groups unchecked proxies by address limited by batch size
+func (c *Checker) collect() map[string][]string {
+	scrapersByProxy := make(map[string][]string)
+	for _, scraper := range db.Scrapers() {
+		for _, proxy := range db.Set.GetUnchecked(scraper) {
+			if _, ok := scrapersByProxy[proxy]; !ok && c.BatchSize > 0 && len(scrapersByProxy) >= c.BatchSize {
+				continue
+			}
+			scrapersByProxy[proxy] = append(scrapersByProxy[proxy], scraper)
+		}
+	}
+	return scrapersByProxy
+}
+
+// probeEach runs probe for every proxy keeping at most Concurrency of them at the same time
+func (c *Checker) probeEach(proxies []string, probe func(proxy string)) {
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, c.Concurrency)
+	for _, proxy := range proxies {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(proxy string) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			probe(proxy)
+		}(proxy)
+	}
+	wg.Wait()
+}
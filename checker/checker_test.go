@@ -0,0 +1,190 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+	"github.com/AlexeyYurko/go-pmserver/db"
+	"github.com/AlexeyYurko/go-pmserver/manager"
+)
+
+const target = "http://target.test/check"
+
+// proxyStandIn answers requests sent through it as a proxy would get them from the target
+func proxyStandIn(t *testing.T, status int) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.String() != target {
+			t.Errorf("proxy got request for %s, want %s", r.URL, target)
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server.Listener.Addr().String()
+}
+
+// closedAddress returns address nobody listens on
+func closedAddress(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := listener.Addr().String()
+	listener.Close()
+	return address
+}
+
+func TestProbe(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		expected int
+		wantCode int
+	}{
+		{name: "ok", status: http.StatusOK},
+		{name: "no content", status: http.StatusNoContent},
+		{name: "server error", status: http.StatusBadGateway, wantCode: http.StatusBadGateway},
+		{name: "redirect", status: http.StatusFound, wantCode: http.StatusFound},
+		{name: "expected status", status: http.StatusFound, expected: http.StatusFound},
+		{name: "not expected status", status: http.StatusOK, expected: http.StatusNoContent, wantCode: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(target, time.Second, 1)
+			c.ExpectedStatus = tt.expected
+			err := c.Probe(context.Background(), proxyStandIn(t, tt.status))
+			if tt.wantCode == 0 {
+				if err != nil {
+					t.Fatalf("Probe: %v", err)
+				}
+				return
+			}
+			var statusErr *StatusError
+			if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.wantCode {
+				t.Fatalf("Probe err = %v, want status %d", err, tt.wantCode)
+			}
+			if !errors.Is(err, ErrUnexpectedStatus) {
+				t.Errorf("Probe err does not match ErrUnexpectedStatus")
+			}
+		})
+	}
+}
+
+func TestProbeUnreachableProxy(t *testing.T) {
+	err := New(target, time.Second, 1).Probe(context.Background(), closedAddress(t))
+	if reason := FailureReason(err); reason != manager.ReasonRefused {
+		t.Fatalf("FailureReason(%v) = %s, want %s", err, reason, manager.ReasonRefused)
+	}
+}
+
+func TestProbeTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer slow.Close()
+
+	err := New(target, 50*time.Millisecond, 1).Probe(context.Background(), slow.Listener.Addr().String())
+	if reason := FailureReason(err); reason != manager.ReasonTimeout {
+		t.Fatalf("FailureReason(%v) = %s, want %s", err, reason, manager.ReasonTimeout)
+	}
+}
+
+func TestFailureReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{err: &StatusError{StatusCode: http.StatusInternalServerError}, want: manager.ReasonHTTP5xx},
+		{err: &StatusError{StatusCode: http.StatusServiceUnavailable}, want: manager.ReasonHTTP5xx},
+		{err: &StatusError{StatusCode: http.StatusForbidden}, want: manager.ReasonBanned},
+		{err: &StatusError{StatusCode: http.StatusTooManyRequests}, want: manager.ReasonBanned},
+		{err: &StatusError{StatusCode: http.StatusNotFound}, want: manager.ReasonCustom},
+		{err: fmt.Errorf("dial: %w", syscall.ECONNREFUSED), want: manager.ReasonRefused},
+		{err: fmt.Errorf("request: %w", context.DeadlineExceeded), want: manager.ReasonTimeout},
+		{err: errors.New("bad proxy address"), want: manager.ReasonCustom},
+	}
+	for _, tt := range tests {
+		if got := FailureReason(tt.err); got != tt.want {
+			t.Errorf("FailureReason(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	config.Scrapers = []string{"first", "second"}
+	config.ProxyrackProxyIP = []string{"9.9.9.9"}
+	db.Init()
+
+	good := proxyStandIn(t, http.StatusOK)
+	banned := proxyStandIn(t, http.StatusForbidden)
+	refused := closedAddress(t)
+	db.StoreProxies("", []string{good, banned, refused})
+
+	c := New(target, time.Second, 2)
+	c.Run()
+
+	for _, scraper := range config.Scrapers {
+		if unchecked := db.Set.GetUnchecked(scraper); len(unchecked) != 0 {
+			t.Errorf("%s: unchecked after run %v", scraper, unchecked)
+		}
+		if working := db.Set.GetWorking(scraper); !slices.Equal(working, []string{good}) {
+			t.Errorf("%s: working %v, want [%s]", scraper, working, good)
+		}
+		dead := db.Set.GetDead(scraper)
+		slices.Sort(dead)
+		want := []string{banned, refused}
+		slices.Sort(want)
+		if !slices.Equal(dead, want) {
+			t.Errorf("%s: dead %v, want %v", scraper, dead, want)
+		}
+		if next := db.Base.LoadNextCheck(scraper, good); next != 0 {
+			t.Errorf("%s: passed proxy got next check %d", scraper, next)
+		}
+	}
+}
+
+func TestProbeWithCredentialsAfterPort(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Proxy-Authorization"); got != "Basic dXNlcjpwYXNz" {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	proxy := server.Listener.Addr().String() + ":user:pass"
+	if err := New(target, time.Second, 1).Probe(context.Background(), proxy); err != nil {
+		t.Fatalf("Probe(%s): %v", proxy, err)
+	}
+}
+
+func TestRunSkipsBadProxyAddress(t *testing.T) {
+	config.Scrapers = []string{"first"}
+	config.ProxyrackProxyIP = []string{"9.9.9.9"}
+	db.Init()
+	bad := "1.2.3.4:port:user:pass"
+	db.StoreProxies("", []string{bad})
+
+	New(target, time.Second, 1).Run()
+
+	if dead := db.Set.GetDead("first"); len(dead) != 0 {
+		t.Errorf("proxy with bad address marked dead: %v", dead)
+	}
+	if unchecked := db.Set.GetUnchecked("first"); !slices.Equal(unchecked, []string{bad}) {
+		t.Errorf("unchecked %v, want [%s]", unchecked, bad)
+	}
+}
@@ -0,0 +1,412 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+)
+
+// Failure reasons accepted by MarkDead
+const (
+	ReasonTimeout = "timeout"
+	ReasonRefused = "refused"
+	ReasonBanned  = "banned"
+	ReasonCaptcha = "captcha"
+	ReasonHTTP5xx = "http_5xx"
+	ReasonCustom  = "custom"
+)
+
+// Selection narrows down proxies GetRandom can choose from, zero value allows any available proxy
+type Selection struct {
+	// MaxLatency proxies with rolling latency estimate under it are preferred, 0 for no limit
+	MaxLatency time.Duration
+	// RequireLatency makes MaxLatency strict
+	RequireLatency bool
+	// Anonymity is the worst level allowed: transparent, anonymous or elite, empty for any
+	Anonymity string
+	// Domain is target domain of request, proxies dead on it are skipped, empty for any
+	Domain string
+}
+
+// Success details of a good attempt, zero value reports nothing but the attempt
+type Success struct {
+	// Latency of request through proxy, 0 if not measured
+	Latency time.Duration
+	// Domain request was sent to, clears failures of proxy on it
+	Domain string
+}
+
+// Failure details of a failed attempt, zero value marks proxy dead with no reason
+type Failure struct {
+	// Reason is one of Reason constants, empty if not known
+	Reason string
+	// Domain marks proxy dead on this domain only if set
+	Domain string
+}
+
+// Results of reports sent with ReportOutcomes
+const (
+	ResultApplied = "applied"
+	// ResultIgnored is success of proxy which is already dead
+	ResultIgnored      = "ignored"
+	ResultUnknownProxy = "unknown_proxy"
+)
+
+// Report of request through proxy, sent in a batch with ReportOutcomes
+type Report struct {
+	Proxy string
+	// Failed report is sent with Failure, otherwise with Success
+	Failed  bool
+	Success Success
+	Failure Failure
+}
+
+// ReportResult tells what pmserver did with report, one of Result constants
+type ReportResult struct {
+	Proxy  string `json:"proxy"`
+	Result string `json:"result"`
+}
+
+// Echo is what pmserver saw of the request
+type Echo struct {
+	IP      string              `json:"ip"`
+	Headers map[string][]string `json:"headers"`
+}
+
+// Schedule of backoffs given to proxy failing in a row
+type Schedule struct {
+	Scraper  string         `json:"scraper"`
+	Tier     string         `json:"tier"`
+	Policy   config.Backoff `json:"policy"`
+	Schedule []int64        `json:"schedule"`
+}
+
+// Policy is every setting deciding what happens to proxies of scraper
+type Policy struct {
+	config.ProxyPolicy
+	// Backoff parameters for dead proxies by tier
+	Backoff map[string]config.Backoff `json:"backoff"`
+}
+
+// Quota of scraper with its current usage
+type Quota struct {
+	Busy         int `json:"busy"`
+	MaxBusy      int `json:"max_busy"`
+	PerMinute    int `json:"per_minute"`
+	MaxPerMinute int `json:"max_per_minute"`
+	Rejected     int `json:"rejected"`
+}
+
+// Circuit is state of circuit breaker of scraper
+type Circuit struct {
+	State       string `json:"state"`
+	Since       int64  `json:"since"`
+	WindowStart int64  `json:"window_start"`
+	Successes   int    `json:"successes"`
+	Failures    int    `json:"failures"`
+}
+
+// ProxyAction is action an operator took on proxy for one scraper, or for all of them if Scraper is empty
+type ProxyAction struct {
+	Scraper string `json:"scraper"`
+	Proxy   string `json:"proxy"`
+	// Action is quarantine, pin or block
+	Action string `json:"action"`
+	Reason string `json:"reason"`
+	Actor  string `json:"actor"`
+	At     int64  `json:"at"`
+}
+
+// Ping checks pmserver answers
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.get(ctx, "/", nil)
+	return err
+}
+
+// Echo returns address and headers pmserver saw in the request
+func (c *Client) Echo(ctx context.Context) (echo Echo, err error) {
+	err = c.getJSON(ctx, "/echo", nil, &echo)
+	return
+}
+
+// GetRandom takes proxy for scraper, it is busy until reported
+func (c *Client) GetRandom(ctx context.Context, scraper string, selection Selection) (string, error) {
+	query := url.Values{"scraper": {scraper}}
+	if selection.MaxLatency > 0 {
+		query.Set("max_latency", strconv.FormatInt(selection.MaxLatency.Milliseconds(), 10))
+		if selection.RequireLatency {
+			query.Set("latency_mode", "require")
+		}
+	}
+	if selection.Anonymity != "" {
+		query.Set("anonymity", selection.Anonymity)
+	}
+	if selection.Domain != "" {
+		query.Set("domain", selection.Domain)
+	}
+	body, err := c.get(ctx, "/get-random", query)
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// IncGoodAttempts reports successful request through proxy
+func (c *Client) IncGoodAttempts(ctx context.Context, scraper, proxy string, success Success) error {
+	query := url.Values{"scraper": {scraper}, "proxy": {proxy}}
+	if success.Latency > 0 {
+		query.Set("latency", strconv.FormatInt(success.Latency.Milliseconds(), 10))
+	}
+	if success.Domain != "" {
+		query.Set("domain", success.Domain)
+	}
+	_, err := c.get(ctx, "/inc-good-attempts", query)
+	return err
+}
+
+// MarkDead reports failed request through proxy
+func (c *Client) MarkDead(ctx context.Context, scraper, proxy string, failure Failure) error {
+	query := url.Values{"scraper": {scraper}, "proxy": {proxy}}
+	if failure.Reason != "" {
+		query.Set("reason", failure.Reason)
+	}
+	if failure.Domain != "" {
+		query.Set("domain", failure.Domain)
+	}
+	_, err := c.get(ctx, "/mark-dead", query)
+	return err
+}
+
+// ReportOutcomes sends many reports of scraper in one request, they are applied in order
+func (c *Client) ReportOutcomes(ctx context.Context, scraper string, reports []Report) ([]ReportResult, error) {
+	items := make([]map[string]any, len(reports))
+	for i, report := range reports {
+		item := map[string]any{"proxy": report.Proxy, "outcome": "good"}
+		domain := report.Success.Domain
+		if report.Failed {
+			item["outcome"] = "dead"
+			item["reason"] = report.Failure.Reason
+			domain = report.Failure.Domain
+		} else if report.Success.Latency > 0 {
+			item["latency"] = report.Success.Latency.Milliseconds()
+		}
+		if domain != "" {
+			item["domain"] = domain
+		}
+		items[i] = item
+	}
+
+	body, err := c.post(ctx, "/report-outcomes", map[string]any{"scraper": scraper, "outcomes": items})
+	if err != nil {
+		return nil, err
+	}
+	var answer struct {
+		Results []ReportResult `json:"results"`
+	}
+	err = json.Unmarshal(body, &answer)
+	return answer.Results, err
+}
+
+// Reanimate returns busy and postponed proxies of scraper to good ones
+func (c *Client) Reanimate(ctx context.Context, scraper string) error {
+	_, err := c.get(ctx, "/reanimate", url.Values{"scraper": {scraper}})
+	return err
+}
+
+// Start tells pmserver scraper has started
+func (c *Client) Start(ctx context.Context, scraper string) error {
+	_, err := c.get(ctx, "/start", url.Values{"scraper": {scraper}})
+	return err
+}
+
+// AliveFromDead returns dead proxies of scraper whose backoff is over to unchecked ones
+func (c *Client) AliveFromDead(ctx context.Context, scraper string) error {
+	_, err := c.get(ctx, "/alive-from-dead", url.Values{"scraper": {scraper}})
+	return err
+}
+
+// SetRemoveDays sets days after which dead proxies are removed
+func (c *Client) SetRemoveDays(ctx context.Context, days int) error {
+	_, err := c.get(ctx, "/remove-days", url.Values{"days": {strconv.Itoa(days)}})
+	return err
+}
+
+// SetMaxGoodAttempts sets good attempts after which proxy is postponed
+func (c *Client) SetMaxGoodAttempts(ctx context.Context, attempts int) error {
+	_, err := c.get(ctx, "/max-good-attempts", url.Values{"numbers": {strconv.Itoa(attempts)}})
+	return err
+}
+
+// RemoveDead removes proxies of scraper dead for longer than remove days
+func (c *Client) RemoveDead(ctx context.Context, scraper string) error {
+	_, err := c.get(ctx, "/remove-dead", url.Values{"scraper": {scraper}})
+	return err
+}
+
+// ReloadProxyList loads proxy list from the source now
+func (c *Client) ReloadProxyList(ctx context.Context) error {
+	_, err := c.get(ctx, "/reload-proxy-list", nil)
+	return err
+}
+
+// WorkingList returns proxies of scraper which are not dead
+func (c *Client) WorkingList(ctx context.Context, scraper string) ([]string, error) {
+	body, err := c.get(ctx, "/get-working-list", url.Values{"scraper": {scraper}})
+	if err != nil {
+		return nil, err
+	}
+	return lines(body), nil
+}
+
+// DeadList returns dead proxies of scraper
+func (c *Client) DeadList(ctx context.Context, scraper string) ([]string, error) {
+	body, err := c.get(ctx, "/get-dead-list", url.Values{"scraper": {scraper}})
+	if err != nil {
+		return nil, err
+	}
+	return lines(body), nil
+}
+
+// UsefulnessStats returns csv with usage of every proxy of scraper,
+// orderBy is one of name, sdate, success, fdate, fail, latency
+func (c *Client) UsefulnessStats(ctx context.Context, scraper, orderBy string) ([]byte, error) {
+	query := url.Values{"scraper": {scraper}}
+	if orderBy != "" {
+		query.Set("order_by", orderBy)
+	}
+	return c.get(ctx, "/get-proxy-usefulness-stats", query)
+}
+
+// ClearUsefulnessStats forgets usage of every proxy
+func (c *Client) ClearUsefulnessStats(ctx context.Context) error {
+	_, err := c.get(ctx, "/clear-usefulness-stats", nil)
+	return err
+}
+
+// BackoffSchedule returns backoffs proxy of scraper and tier (free or rack) gets failing in a row,
+// policy is tried instead of the configured one if given
+func (c *Client) BackoffSchedule(ctx context.Context, scraper, tier string, attempts int, policy *config.Backoff) (schedule Schedule, err error) {
+	query := url.Values{}
+	if scraper != "" {
+		query.Set("scraper", scraper)
+	}
+	if tier != "" {
+		query.Set("tier", tier)
+	}
+	if attempts > 0 {
+		query.Set("attempts", strconv.Itoa(attempts))
+	}
+	if policy != nil {
+		query.Set("type", policy.Type)
+		query.Set("base", strconv.FormatFloat(policy.Base, 'f', -1, 64))
+		query.Set("factor", strconv.FormatFloat(policy.Factor, 'f', -1, 64))
+		query.Set("step", strconv.FormatFloat(policy.Step, 'f', -1, 64))
+		query.Set("cap", strconv.FormatFloat(policy.Cap, 'f', -1, 64))
+		if policy.Jitter != "" {
+			query.Set("jitter", policy.Jitter)
+		}
+	}
+	err = c.getJSON(ctx, "/backoff-schedule", query, &schedule)
+	return
+}
+
+// Policy returns settings effective for scraper
+func (c *Client) Policy(ctx context.Context, scraper string) (policy Policy, err error) {
+	err = c.getJSON(ctx, "/get-policy", url.Values{"scraper": {scraper}}, &policy)
+	return
+}
+
+// Quota returns quota of scraper with its current usage
+func (c *Client) Quota(ctx context.Context, scraper string) (quota Quota, err error) {
+	err = c.getJSON(ctx, "/get-quota", url.Values{"scraper": {scraper}}, &quota)
+	return
+}
+
+// Circuit returns state of circuit breaker of scraper
+func (c *Client) Circuit(ctx context.Context, scraper string) (circuit Circuit, err error) {
+	err = c.getJSON(ctx, "/get-circuit", url.Values{"scraper": {scraper}}, &circuit)
+	return
+}
+
+// ZabbixStats returns answer for zabbix
+func (c *Client) ZabbixStats(ctx context.Context) (string, error) {
+	body, err := c.get(ctx, "/zstats", nil)
+	return string(body), err
+}
+
+// HTMLStats returns stats page
+func (c *Client) HTMLStats(ctx context.Context) (string, error) {
+	body, err := c.get(ctx, "/hstats", nil)
+	return string(body), err
+}
+
+// Stats returns request metrics by metric name
+func (c *Client) Stats(ctx context.Context) (stats map[string]map[string]any, err error) {
+	err = c.getJSON(ctx, "/stats", nil, &stats)
+	return
+}
+
+// AddProxies adds proxies to scraper, to every scraper if scraper is empty
+func (c *Client) AddProxies(ctx context.Context, scraper string, proxies []string) error {
+	_, err := c.post(ctx, "/add-proxies", map[string]any{"scraper": scraper, "proxies": proxies})
+	return err
+}
+
+// RemoveProxies removes proxies of scraper, of every scraper if scraper is empty
+func (c *Client) RemoveProxies(ctx context.Context, scraper string, proxies []string) error {
+	_, err := c.post(ctx, "/remove-proxies", map[string]any{"scraper": scraper, "proxies": proxies})
+	return err
+}
+
+// Scrapers returns registered scrapers
+func (c *Client) Scrapers(ctx context.Context) ([]string, error) {
+	body, err := c.get(ctx, "/list-scrapers", nil)
+	if err != nil {
+		return nil, err
+	}
+	return lines(body), nil
+}
+
+// AddScraper registers scraper
+func (c *Client) AddScraper(ctx context.Context, scraper string) error {
+	_, err := c.post(ctx, "/add-scraper", map[string]string{"scraper": scraper})
+	return err
+}
+
+// RenameScraper renames scraper keeping its proxies
+func (c *Client) RenameScraper(ctx context.Context, scraper, newName string) error {
+	_, err := c.post(ctx, "/rename-scraper", map[string]string{"scraper": scraper, "new_name": newName})
+	return err
+}
+
+// DeleteScraper removes scraper with its proxies
+func (c *Client) DeleteScraper(ctx context.Context, scraper string) error {
+	_, err := c.post(ctx, "/delete-scraper", map[string]string{"scraper": scraper})
+	return err
+}
+
+// ProxyActions lists actions taken for scraper and for all scrapers, every action if scraper is empty
+func (c *Client) ProxyActions(ctx context.Context, scraper string) (actions []ProxyAction, err error) {
+	query := url.Values{}
+	if scraper != "" {
+		query.Set("scraper", scraper)
+	}
+	err = c.getJSON(ctx, "/list-proxy-actions", query, &actions)
+	return
+}
+
+// TakeAction quarantines, pins or blocks proxy, At is set by pmserver
+func (c *Client) TakeAction(ctx context.Context, action ProxyAction) error {
+	_, err := c.post(ctx, "/proxy-action", action)
+	return err
+}
+
+// ReleaseProxy cancels action taken on proxy for scraper, for all scrapers if scraper is empty
+func (c *Client) ReleaseProxy(ctx context.Context, scraper, proxy, actor string) error {
+	_, err := c.post(ctx, "/release-proxy", map[string]string{"scraper": scraper, "proxy": proxy, "actor": actor})
+	return err
+}
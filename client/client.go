@@ -0,0 +1,136 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const defaultTimeout = 10 * time.Second
+
+// Errors APIError matches by status code
+var (
+	// ErrNoProxy returned when there is no available proxy to hand out
+	ErrNoProxy = errors.New("no proxy available")
+	// ErrQuotaExceeded returned when scraper has used up its quota
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrCircuitOpen returned when handouts of scraper are paused by circuit breaker
+	ErrCircuitOpen = errors.New("circuit open")
+	// ErrNotFound returned for unknown scraper or proxy
+	ErrNotFound = errors.New("not found")
+	// ErrRejected returned when request is wrong, message of APIError tells why
+	ErrRejected = errors.New("request rejected")
+	// ErrConflict returned when scraper already exists
+	ErrConflict = errors.New("conflict")
+)
+
+// APIError is answer of pmserver with unexpected status code
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("pmserver answered %d: %s", e.StatusCode, e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	switch e.StatusCode {
+	case http.StatusNoContent:
+		return ErrNoProxy
+	case http.StatusTooManyRequests:
+		return ErrQuotaExceeded
+	case http.StatusServiceUnavailable:
+		return ErrCircuitOpen
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusForbidden, http.StatusBadRequest:
+		return ErrRejected
+	case http.StatusConflict:
+		return ErrConflict
+	}
+	return nil
+}
+
+// Client calls pmserver API
+type Client struct {
+	// BaseURL of pmserver, like http://127.0.0.1:5000
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// New creates client of pmserver at baseURL
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: &http.Client{Timeout: defaultTimeout},
+	}
+}
+
+// get sends GET request with query and returns answer body
+func (c *Client) get(ctx context.Context, path string, query url.Values) ([]byte, error) {
+	address := c.BaseURL + path
+	if len(query) > 0 {
+		address += "?" + query.Encode()
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(request)
+}
+
+// post sends POST request with body encoded as json and returns answer body
+func (c *Client) post(ctx context.Context, path string, body any) ([]byte, error) {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+path, bytes.NewReader(encoded))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	return c.do(request)
+}
+
+// getJSON sends GET request with query and decodes json answer into result
+func (c *Client) getJSON(ctx context.Context, path string, query url.Values, result any) error {
+	body, err := c.get(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(body, result)
+}
+
+func (c *Client) do(request *http.Request) ([]byte, error) {
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, &APIError{StatusCode: response.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+	return body, nil
+}
+
+// lines splits newline separated list, empty answer is empty list
+func lines(body []byte) []string {
+	text := strings.TrimSpace(string(body))
+	if text == "" {
+		return []string{}
+	}
+	return strings.Split(text, "\n")
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Event is change of proxies streamed by pmserver
+type Event struct {
+	// Type is status, removed, reload, reload-failed, reanimate, circuit or dropped for events missed by slow client
+	Type string `json:"type"`
+	// Scraper is the pool (group of grouped scraper) for status, removed and reanimate events
+	Scraper string `json:"scraper"`
+	// Member is group member status or removed event was made for, empty if it was made for the whole pool
+	Member  string `json:"member"`
+	Proxy   string `json:"proxy"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Count   int    `json:"count"`
+	Message string `json:"message"`
+	At      int64  `json:"at"`
+}
+
+// Events streams events of scrapers with types, any of them if empty, until ctx is done or connection breaks,
+// then the channel is closed
+func (c *Client) Events(ctx context.Context, scrapers, types []string) (<-chan Event, error) {
+	query := url.Values{}
+	if len(scrapers) > 0 {
+		query.Set("scraper", strings.Join(scrapers, ","))
+	}
+	if len(types) > 0 {
+		query.Set("type", strings.Join(types, ","))
+	}
+	address := c.BaseURL + "/events"
+	if len(query) > 0 {
+		address += "?" + query.Encode()
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "text/event-stream")
+
+	// stream lasts longer than timeout of the usual requests
+	streamClient := *c.HTTPClient
+	streamClient.Timeout = 0
+	response, err := streamClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		var message strings.Builder
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			message.WriteString(scanner.Text())
+		}
+		return nil, &APIError{StatusCode: response.StatusCode, Message: strings.TrimSpace(message.String())}
+	}
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		defer response.Body.Close()
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data:")
+			if !ok {
+				continue
+			}
+			var event Event
+			if json.Unmarshal([]byte(data), &event) != nil {
+				continue
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
@@ -0,0 +1,231 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/AlexeyYurko/go-pmserver/proxyurl"
+)
+
+// Outcome of request sent through proxy
+type Outcome struct {
+	Failed bool
+	// Reason of failure, one of Reason constants
+	Reason string
+	// DomainOnly marks proxy dead on the request domain only
+	DomainOnly bool
+}
+
+// Classifier decides outcome of request from its answer or error, response is nil if there is an error.
+// Classifier reading the body has to leave it readable for the caller
+type Classifier func(response *http.Response, err error) Outcome
+
+// StatusClassifier fails requests with errors, with banCodes as banned and with 502 and 504 as http_5xx
+func StatusClassifier(banCodes ...int) Classifier {
+	return func(response *http.Response, err error) Outcome {
+		switch {
+		case err != nil:
+			return Outcome{Failed: true, Reason: ErrorReason(err)}
+		case slices.Contains(banCodes, response.StatusCode):
+			return Outcome{Failed: true, Reason: ReasonBanned}
+		case response.StatusCode == http.StatusBadGateway || response.StatusCode == http.StatusGatewayTimeout:
+			return Outcome{Failed: true, Reason: ReasonHTTP5xx}
+		}
+		return Outcome{}
+	}
+}
+
+// DefaultClassifier treats 403 and 429 as bans
+var DefaultClassifier = StatusClassifier(http.StatusForbidden, http.StatusTooManyRequests)
+
+// ErrorReason translates error of request through proxy to failure reason
+func ErrorReason(err error) string {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return ReasonRefused
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return ReasonTimeout
+	}
+	return ReasonCustom
+}
+
+// Transport is http.RoundTripper sending every request through proxy taken from pmserver
+// and reporting to pmserver how it went
+type Transport struct {
+	Client  *Client
+	Scraper string
+	// Selection for GetRandom, its Domain is taken from request if empty
+	Selection Selection
+	// Classify decides outcome of request, DefaultClassifier if nil
+	Classify Classifier
+	// Base is cloned for every proxy, clone of http.DefaultTransport if nil
+	Base *http.Transport
+	// PerSession keeps the same proxy for every request until it fails, use one Transport per session
+	PerSession bool
+	// OnReportError is called when outcome can't be reported, errors are dropped if nil
+	OnReportError func(err error)
+
+	mu      sync.Mutex
+	session string
+	// sessionTransport keeps connections to the session proxy, without session every request
+	// gets its own transport closing connection once the answer is read
+	sessionTransport *http.Transport
+}
+
+// NewTransport creates transport taking proxies of scraper from pmserver at client
+func NewTransport(client *Client, scraper string) *Transport {
+	return &Transport{Client: client, Scraper: scraper}
+}
+
+// RoundTrip sends request through proxy, errors of getting proxy from pmserver are returned as is,
+// request cancelled by the caller and proxy which can't be read are not reported
+func (t *Transport) RoundTrip(request *http.Request) (*http.Response, error) {
+	ctx := request.Context()
+	domain := t.Selection.Domain
+	if domain == "" {
+		domain = strings.ToLower(request.URL.Hostname())
+	}
+
+	proxy, err := t.proxy(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := t.transport(proxy)
+	if err != nil {
+		// nothing was sent through proxy which can't be read, it is not its failure
+		t.forget(proxy)
+		return nil, err
+	}
+
+	started := time.Now()
+	response, err := transport.RoundTrip(request)
+	latency := time.Since(started)
+	if ctx.Err() != nil {
+		return response, err
+	}
+
+	classify := t.Classify
+	if classify == nil {
+		classify = DefaultClassifier
+	}
+	outcome := classify(response, err)
+	if outcome.Failed {
+		t.forget(proxy)
+	}
+	t.report(ctx, proxy, domain, outcome, latency)
+	return response, err
+}
+
+// proxy returns proxy of the session or takes new one
+func (t *Transport) proxy(ctx context.Context, domain string) (string, error) {
+	if t.PerSession {
+		t.mu.Lock()
+		proxy := t.session
+		t.mu.Unlock()
+		if proxy != "" {
+			return proxy, nil
+		}
+	}
+
+	selection := t.Selection
+	selection.Domain = domain
+	proxy, err := t.Client.GetRandom(ctx, t.Scraper, selection)
+	if err != nil {
+		return "", fmt.Errorf("getting proxy for %s: %w", t.Scraper, err)
+	}
+	if t.PerSession {
+		t.mu.Lock()
+		t.session = proxy
+		t.mu.Unlock()
+	}
+	return proxy, nil
+}
+
+// transport returns transport sending requests through proxy, transport of session proxy is kept
+func (t *Transport) transport(proxy string) (*http.Transport, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.PerSession && t.sessionTransport != nil && t.session == proxy {
+		return t.sessionTransport, nil
+	}
+
+	proxyURL, err := ProxyURL(proxy)
+	if err != nil {
+		return nil, err
+	}
+	var transport *http.Transport
+	if t.Base != nil {
+		transport = t.Base.Clone()
+	} else {
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	transport.Proxy = http.ProxyURL(proxyURL)
+
+	if !t.PerSession || t.session != proxy {
+		// nobody uses this transport again, its connection is closed with the answer
+		transport.DisableKeepAlives = true
+		return transport, nil
+	}
+	if t.sessionTransport != nil {
+		t.sessionTransport.CloseIdleConnections()
+	}
+	t.sessionTransport = transport
+	return transport, nil
+}
+
+// forget drops failed proxy from the session and closes its connections
+func (t *Transport) forget(proxy string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.session != proxy {
+		return
+	}
+	t.session = ""
+	if t.sessionTransport != nil {
+		t.sessionTransport.CloseIdleConnections()
+		t.sessionTransport = nil
+	}
+}
+
+// report tells pmserver outcome of request, even if the request context is done meanwhile
+func (t *Transport) report(ctx context.Context, proxy, domain string, outcome Outcome, latency time.Duration) {
+	ctx = context.WithoutCancel(ctx)
+	var err error
+	if outcome.Failed {
+		failure := Failure{Reason: outcome.Reason}
+		if outcome.DomainOnly {
+			failure.Domain = domain
+		}
+		err = t.Client.MarkDead(ctx, t.Scraper, proxy, failure)
+	} else {
+		err = t.Client.IncGoodAttempts(ctx, t.Scraper, proxy, Success{Latency: latency, Domain: domain})
+	}
+	if err != nil && t.OnReportError != nil {
+		t.OnReportError(err)
+	}
+}
+
+// CloseIdleConnections closes idle connections to the session proxy
+func (t *Transport) CloseIdleConnections() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.sessionTransport != nil {
+		t.sessionTransport.CloseIdleConnections()
+	}
+}
+
+// ProxyURL converts proxy got from pmserver to url, plain host:port is http proxy,
+// host:port:user:password is proxy with credentials
+func ProxyURL(proxy string) (*url.URL, error) {
+	return proxyurl.Parse(proxy)
+}
@@ -7,6 +7,114 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+const (
+	defaultLatencySmoothing   = 0.3
+	defaultScrapersCollection = "scrapers"
+	defaultActionsCollection  = "proxy_actions"
+)
+
+// FailurePolicy says what to do with proxy marked dead with some reason
+type FailurePolicy struct {
+	// Backoff in seconds before dead proxy is reanimated, 0 for default exponential backoff
+	Backoff int64 `yaml:"backoff" json:"backoff"`
+	// RemoveAfter blocks proxy after that many failures with the reason, 0 to never remove
+	RemoveAfter int32 `yaml:"remove-after" json:"remove_after"`
+}
+
+// Backoff parameters of backoff policy for dead proxies
+type Backoff struct {
+	// Type is one of exponential, linear, fixed, decorrelated
+	Type string `yaml:"type" json:"type" form:"type"`
+	// Base backoff in seconds
+	Base float64 `yaml:"base" json:"base" form:"base"`
+	// Factor multiplies exponential backoff on every failure
+	Factor float64 `yaml:"factor,omitempty" json:"factor,omitempty" form:"factor"`
+	// Step is added to linear backoff on every failure
+	Step float64 `yaml:"step,omitempty" json:"step,omitempty" form:"step"`
+	// Cap is the longest backoff in seconds, 0 for no cap
+	Cap float64 `yaml:"cap,omitempty" json:"cap,omitempty" form:"cap"`
+	// Jitter is one of none, full, equal, uniform, decorrelated policy has own jitter
+	Jitter string `yaml:"jitter,omitempty" json:"jitter,omitempty" form:"jitter"`
+}
+
+// RateLimit limits how often one proxy is handed out to a scraper, zero value for no limit
+type RateLimit struct {
+	// MaxUses is how many times proxy can be handed out within Window, 0 for no limit
+	MaxUses int `yaml:"max-uses" json:"max_uses"`
+	// Window in seconds MaxUses are counted in, a minute if not set
+	Window float64 `yaml:"window" json:"window"`
+	// MinInterval in seconds between two handouts of the same proxy, 0 for no limit
+	MinInterval float64 `yaml:"min-interval" json:"min_interval"`
+}
+
+// Quota limits how many proxies a scraper takes from its pool, zero value for no limit
+type Quota struct {
+	// MaxBusy is how many proxies scraper can keep busy at the same time, 0 for no limit
+	MaxBusy int `yaml:"max-busy" json:"max_busy"`
+	// MaxPerMinute is how many proxies scraper can get within a minute, 0 for no limit
+	MaxPerMinute int `yaml:"max-per-minute" json:"max_per_minute"`
+}
+
+// CircuitBreaker stops escalating backoffs of a scraper whose proxies fail en masse, zero value is disabled
+type CircuitBreaker struct {
+	// FailureRatio of failed requests within Window opening the circuit, from 0 to 1, 0 to disable
+	FailureRatio float64 `yaml:"failure-ratio" json:"failure_ratio"`
+	// MinRequests within Window before failure ratio is taken into account
+	MinRequests int `yaml:"min-requests" json:"min_requests"`
+	// Window in seconds requests are counted in
+	Window int64 `yaml:"window" json:"window"`
+	// ProbePeriod in seconds the circuit stays open and then probes if failures are over
+	ProbePeriod int64 `yaml:"probe-period" json:"probe_period"`
+	// PauseHandouts is yes to hand out no proxies while the circuit is open
+	PauseHandouts string `yaml:"pause-handouts" json:"pause_handouts"`
+}
+
+// Blocklist ranges and autonomous systems whose proxies are never used
+type Blocklist struct {
+	// CIDRs like 10.0.0.0/8
+	CIDRs []string `yaml:"cidrs" json:"cidrs"`
+	// ASNs numbers of autonomous systems, looked up in ASNDatabase
+	ASNs []uint32 `yaml:"asns" json:"asns"`
+}
+
+// ResponseRule classifies answer got through forward proxy, every condition given has to match
+type ResponseRule struct {
+	Name string `yaml:"name"`
+	// Domains rule applies to with their subdomains, empty for all
+	Domains     []string `yaml:"domains"`
+	StatusCodes []int    `yaml:"status-codes"`
+	// Headers by name with regular expressions their values have to match
+	Headers map[string]string `yaml:"headers"`
+	// Body regular expression for the beginning of the answer body
+	Body string `yaml:"body"`
+	// Verdict is success, soft-fail or ban
+	Verdict string `yaml:"verdict"`
+	// Reason given to MarkDead, banned for ban and custom for soft-fail if empty
+	Reason string `yaml:"reason"`
+}
+
+// BackoffTiers backoff policies for all proxies and separately for proxyrack and free proxies
+type BackoffTiers struct {
+	Default *Backoff `yaml:"default"`
+	Rack    *Backoff `yaml:"rack"`
+	Free    *Backoff `yaml:"free"`
+}
+
+type scraperConfig struct {
+	Scraper         string `yaml:"name"`
+	PolicyOverrides `yaml:",inline"`
+}
+
+type blocklistConfig struct {
+	Blocklist   `yaml:",inline"`
+	ASNDatabase string `yaml:"asn-database"`
+}
+
+type groupConfig struct {
+	Name    string   `yaml:"name"`
+	Members []string `yaml:"members"`
+}
+
 type config struct {
 	Proxyrack []struct {
 		Host      string `yaml:"host"`
@@ -25,31 +133,78 @@ type config struct {
 		MongoDatabase string `yaml:"mongo-database"`
 		GinHostPort   string `yaml:"gin-hostport"`
 	}
-	MongoCollection string `yaml:"mongo-collection"`
-	MongoReplicaSet string `yaml:"mongo-replicaset"`
-	MongoHosts      string `yaml:"mongo-hosts"`
-	Scrapers        []struct {
-		Scraper string `yaml:"name"`
-	}
-	UseProxyRack string `yaml:"useproxyrack"`
-	Newproxies   struct {
+	MongoCollection         string `yaml:"mongo-collection"`
+	MongoScrapersCollection string `yaml:"mongo-scrapers-collection"`
+	MongoActionsCollection  string `yaml:"mongo-actions-collection"`
+	AutoCreateScrapers      string `yaml:"auto-create-scrapers"`
+	MongoReplicaSet         string `yaml:"mongo-replicaset"`
+	MongoHosts              string `yaml:"mongo-hosts"`
+	Scrapers                []scraperConfig
+	Groups                  []groupConfig
+	UseProxyRack            string `yaml:"useproxyrack"`
+	Newproxies              struct {
 		ResourceLink      string `yaml:"url"`
 		ProxyListUsername string `yaml:"username"`
 		ProxyListPassword string `yaml:"password"`
+		Timeout           uint64 `yaml:"timeout"`
+		Retries           int    `yaml:"retries"`
+		RetryBackoff      uint64 `yaml:"retry-backoff"`
+		MaxShrinkPercent  int    `yaml:"max-shrink-percent"`
 	}
 	SchedulerTimings struct {
 		LoadProxiesTime     uint64 `yaml:"loadProxies"`
 		LogStatsTime        uint64 `yaml:"logStats"`
 		ReturnPostponedTime uint64 `yaml:"returnPostponed"`
 		SaveToMongoTime     uint64 `yaml:"saveToMongo"`
+		CheckProxiesTime    uint64 `yaml:"checkProxies"`
+	}
+	Checker struct {
+		Enabled          string `yaml:"enabled"`
+		URL              string `yaml:"url"`
+		Timeout          uint64 `yaml:"timeout"`
+		Concurrency      int    `yaml:"concurrency"`
+		BatchSize        int    `yaml:"batch-size"`
+		ExpectedStatus   int    `yaml:"expected-status"`
+		EchoURL          string `yaml:"echo-url"`
+		RealIP           string `yaml:"real-ip"`
+		AnonymityRecheck int64  `yaml:"anonymity-recheck"`
+	}
+	ForwardProxy struct {
+		Enabled        string `yaml:"enabled"`
+		Listen         string `yaml:"listen"`
+		Password       string `yaml:"password"`
+		DialTimeout    uint64 `yaml:"dial-timeout"`
+		BanStatusCodes []int  `yaml:"ban-status-codes"`
+		SOCKSListen    string `yaml:"socks-listen"`
+		SessionTTL     int64  `yaml:"session-ttl"`
+		Retries        int    `yaml:"retries"`
+		MaxRetries     int    `yaml:"max-retries"`
+
+		BodyScanSize int            `yaml:"body-scan-size"`
+		Rules        []ResponseRule `yaml:"rules"`
+	} `yaml:"forward-proxy"`
+	GRPC struct {
+		Enabled  string `yaml:"enabled"`
+		Listen   string `yaml:"listen"`
+		MaxBatch int    `yaml:"max-batch"`
+	}
+	Events struct {
+		AllowedOrigins []string `yaml:"allowed-origins"`
 	}
 	ProxyRelated struct {
-		MaxGoodAttempts            int32 `yaml:"max-good-attempts"`
-		BackoffTimeForGoodAttempts int64 `yaml:"backoff-time-for-good-attempts-attempts"`
-		ProxyRackBackoffTime       int64 `yaml:"proxyrack-backoff-time"`
-		RemoveDeadDays             int64 `yaml:"remove-dead-days"`
+		MaxGoodAttempts            int32          `yaml:"max-good-attempts"`
+		BackoffTimeForGoodAttempts int64          `yaml:"backoff-time-for-good-attempts-attempts"`
+		ProxyRackBackoffTime       int64          `yaml:"proxyrack-backoff-time"`
+		RemoveDeadDays             int64          `yaml:"remove-dead-days"`
+		LatencySmoothing           float64        `yaml:"latency-smoothing"`
+		RateLimit                  RateLimit      `yaml:"rate-limit"`
+		Quota                      Quota          `yaml:"quota"`
+		CircuitBreaker             CircuitBreaker `yaml:"circuit-breaker"`
 	}
-	StatsFileName string `yaml:"stats-filename"`
+	FailurePolicies map[string]FailurePolicy `yaml:"failure-policies"`
+	Backoff         BackoffTiers             `yaml:"backoff"`
+	Blocklist       blocklistConfig          `yaml:"blocklist"`
+	StatsFileName   string                   `yaml:"stats-filename"`
 }
 
 var (
@@ -60,10 +215,20 @@ var (
 	ProxyListUsername string
 	// ProxyListPassword password for getting new proxies
 	ProxyListPassword string
+	// ProxyListTimeout timeout for one download of new proxies in seconds
+	ProxyListTimeout uint64
+	// ProxyListRetries how many times failed download is repeated
+	ProxyListRetries int
+	// ProxyListRetryBackoff pause before the first retry in seconds, doubled on every next one
+	ProxyListRetryBackoff uint64
+	// ProxyListMaxShrinkPercent refuse new list if it is smaller than previous by more than this percent, 0 to disable
+	ProxyListMaxShrinkPercent int
 	// GinHostPort host & port for Gin server
 	GinHostPort string
 	// Scrapers list of scrapers
 	Scrapers []string
+	// Groups members of scraper groups by group, members of a group share one proxy pool
+	Groups map[string][]string
 	// UseProxyRack for use/not use Proxyrack proxies
 	UseProxyRack  bool
 	mongoUser     string
@@ -72,7 +237,13 @@ var (
 	MongoDatabase string
 	// MongoCollection collection in mongo
 	MongoCollection string
-	mongoHosts      string
+	// MongoScrapersCollection collection in mongo for scrapers registered in runtime
+	MongoScrapersCollection string
+	// MongoActionsCollection collection in mongo for proxies quarantined, pinned and blocklisted by operators
+	MongoActionsCollection string
+	// AutoCreateScrapers registers unknown scraper on its first /get-random or /add-proxies
+	AutoCreateScrapers bool
+	mongoHosts         string
 	// MongoURI link to mongo
 	MongoURI string
 	// ProxyrackProxyIP ip's of proxyrack proxies
@@ -85,6 +256,56 @@ var (
 	ReturnPostponedTime uint64
 	// SaveToMongoTime interval to save to mongo in seconds
 	SaveToMongoTime uint64
+	// CheckProxiesTime interval to run active health check of unchecked proxies in seconds
+	CheckProxiesTime uint64
+	// CheckerEnabled for use/not use active health check
+	CheckerEnabled bool
+	// CheckerURL target requested through proxies during health check
+	CheckerURL string
+	// CheckerTimeout timeout for one health check request in seconds
+	CheckerTimeout uint64
+	// CheckerConcurrency how many proxies are probed at the same time
+	CheckerConcurrency int
+	// CheckerBatchSize max number of proxies probed in one run, 0 for unlimited
+	CheckerBatchSize int
+	// CheckerExpectedStatus status code expected from target, 0 for any 2xx
+	CheckerExpectedStatus int
+	// CheckerEchoURL echo endpoint requested through proxies to find out exit ip and anonymity, empty to disable
+	CheckerEchoURL string
+	// CheckerRealIP own ip of the server, found out through echo endpoint if empty
+	CheckerRealIP string
+	// CheckerAnonymityRecheck period in seconds to probe anonymity again, 0 to probe only once
+	CheckerAnonymityRecheck int64
+	// ForwardProxyEnabled to listen as forward proxy routing requests through pool proxies
+	ForwardProxyEnabled bool
+	// ForwardProxyListen address forward proxy listens on
+	ForwardProxyListen string
+	// ForwardProxyPassword clients have to give with scraper name as username, empty for no password
+	ForwardProxyPassword string
+	// ForwardProxyDialTimeout timeout for connecting through pool proxy in seconds
+	ForwardProxyDialTimeout uint64
+	// ForwardProxyBanStatusCodes upstream status codes meaning the proxy is banned
+	ForwardProxyBanStatusCodes []int
+	// ForwardProxySOCKSListen address SOCKS5 front end listens on, empty to not listen
+	ForwardProxySOCKSListen string
+	// ForwardProxySessionTTL seconds a session keeps its proxy since it was last used
+	ForwardProxySessionTTL int64
+	// ForwardProxyRetries times a failed request is sent again through another proxy
+	ForwardProxyRetries int
+	// ForwardProxyMaxRetries limit for retries asked by client in request header
+	ForwardProxyMaxRetries int
+	// ForwardProxyBodyScanSize KB of answer body checked by rules
+	ForwardProxyBodyScanSize int
+	// ForwardProxyRules classify answers got through forward proxy, the first matching rule wins
+	ForwardProxyRules []ResponseRule
+	// GRPCEnabled to serve gRPC API alongside HTTP one
+	GRPCEnabled bool
+	// GRPCListen address gRPC API listens on
+	GRPCListen string
+	// GRPCMaxBatch limits proxies taken and outcomes reported in one gRPC call
+	GRPCMaxBatch int
+	// EventsAllowedOrigins pages besides pmserver own allowed to open events WebSocket, "*" for any
+	EventsAllowedOrigins []string
 	// MaxGoodAttempts shows how many good attempts can be passed before proxy postpone
 	MaxGoodAttempts int32
 	// ProxyrackBackoffTime time for proxyrack proxies backoff
@@ -93,6 +314,23 @@ var (
 	BackoffTimeForGoodAttempts int64
 	// RemoveDeadTime after how many seconds dead proxies are deleted
 	RemoveDeadTime int64
+	// LatencySmoothing weight of the newest sample in rolling latency estimate, from 0 to 1
+	LatencySmoothing float64
+	// ProxyRateLimit limits how often one proxy is handed out to a scraper
+	ProxyRateLimit RateLimit
+	// ScraperQuota limits how many proxies a scraper takes from its pool
+	ScraperQuota Quota
+	// ScraperCircuitBreaker detects proxies of a scraper failing en masse
+	ScraperCircuitBreaker CircuitBreaker
+	// GlobalBlocklist ranges and autonomous systems whose proxies no scraper uses
+	GlobalBlocklist Blocklist
+	// ASNDatabase file mapping ip ranges to autonomous systems, tab separated range start, range end and
+	// AS number per line as in ip2asn-v4.tsv
+	ASNDatabase string
+	// FailurePolicies policies for proxies marked dead with reason, by reason
+	FailurePolicies map[string]FailurePolicy
+	// GlobalBackoff backoff policies for all scrapers
+	GlobalBackoff BackoffTiers
 	// StatsFileName name for stats file
 	StatsFileName string
 )
@@ -111,6 +349,10 @@ func ParseConfig() {
 	ResourceLink = yamlConfig.Newproxies.ResourceLink
 	ProxyListUsername = yamlConfig.Newproxies.ProxyListUsername
 	ProxyListPassword = yamlConfig.Newproxies.ProxyListPassword
+	ProxyListTimeout = yamlConfig.Newproxies.Timeout
+	ProxyListRetries = yamlConfig.Newproxies.Retries
+	ProxyListRetryBackoff = yamlConfig.Newproxies.RetryBackoff
+	ProxyListMaxShrinkPercent = yamlConfig.Newproxies.MaxShrinkPercent
 	if os.Getenv("pmserver") == "development" {
 		mongoUser = yamlConfig.Debug.MongoUser
 		mongoPassword = yamlConfig.Debug.MongoPassword
@@ -123,15 +365,27 @@ func ParseConfig() {
 		GinHostPort = yamlConfig.Prod.GinHostPort
 	}
 	MongoCollection = yamlConfig.MongoCollection
+	MongoScrapersCollection = yamlConfig.MongoScrapersCollection
+	if MongoScrapersCollection == "" {
+		MongoScrapersCollection = defaultScrapersCollection
+	}
+	MongoActionsCollection = yamlConfig.MongoActionsCollection
+	if MongoActionsCollection == "" {
+		MongoActionsCollection = defaultActionsCollection
+	}
+	AutoCreateScrapers = yamlConfig.AutoCreateScrapers == "yes"
 	mongoHosts = yamlConfig.MongoHosts + MongoDatabase + "?replicaSet=" + yamlConfig.MongoReplicaSet
 	if os.Getenv("pmserver_local_run") == "local" {
 		MongoURI = "mongodb://localhost:27017"
 	} else {
 		MongoURI = "mongodb://" + mongoUser + ":" + mongoPassword + "@" + mongoHosts + ""
 	}
+	ScraperOverrides = make(map[string]PolicyOverrides)
 	for _, scraper := range yamlConfig.Scrapers {
 		Scrapers = append(Scrapers, scraper.Scraper)
+		ScraperOverrides[scraper.Scraper] = scraper.PolicyOverrides
 	}
+	Groups = parseGroups()
 	for _, record := range yamlConfig.Proxyrack {
 		ProxyrackProxyIP = append(ProxyrackProxyIP, record.Host)
 	}
@@ -144,9 +398,75 @@ func ParseConfig() {
 	LogStatsTime = yamlConfig.SchedulerTimings.LogStatsTime
 	ReturnPostponedTime = yamlConfig.SchedulerTimings.ReturnPostponedTime
 	SaveToMongoTime = yamlConfig.SchedulerTimings.SaveToMongoTime
+	CheckProxiesTime = yamlConfig.SchedulerTimings.CheckProxiesTime
+	CheckerEnabled = yamlConfig.Checker.Enabled == "yes"
+	CheckerURL = yamlConfig.Checker.URL
+	CheckerTimeout = yamlConfig.Checker.Timeout
+	CheckerConcurrency = yamlConfig.Checker.Concurrency
+	CheckerBatchSize = yamlConfig.Checker.BatchSize
+	CheckerExpectedStatus = yamlConfig.Checker.ExpectedStatus
+	CheckerEchoURL = yamlConfig.Checker.EchoURL
+	CheckerRealIP = yamlConfig.Checker.RealIP
+	CheckerAnonymityRecheck = yamlConfig.Checker.AnonymityRecheck
+	ForwardProxyEnabled = yamlConfig.ForwardProxy.Enabled == "yes"
+	ForwardProxyListen = yamlConfig.ForwardProxy.Listen
+	ForwardProxyPassword = yamlConfig.ForwardProxy.Password
+	ForwardProxyDialTimeout = yamlConfig.ForwardProxy.DialTimeout
+	ForwardProxyBanStatusCodes = yamlConfig.ForwardProxy.BanStatusCodes
+	ForwardProxySOCKSListen = yamlConfig.ForwardProxy.SOCKSListen
+	ForwardProxySessionTTL = yamlConfig.ForwardProxy.SessionTTL
+	ForwardProxyRetries = yamlConfig.ForwardProxy.Retries
+	ForwardProxyMaxRetries = yamlConfig.ForwardProxy.MaxRetries
+	ForwardProxyBodyScanSize = yamlConfig.ForwardProxy.BodyScanSize
+	ForwardProxyRules = yamlConfig.ForwardProxy.Rules
+	GRPCEnabled = yamlConfig.GRPC.Enabled == "yes"
+	GRPCListen = yamlConfig.GRPC.Listen
+	GRPCMaxBatch = yamlConfig.GRPC.MaxBatch
+	EventsAllowedOrigins = yamlConfig.Events.AllowedOrigins
 	MaxGoodAttempts = yamlConfig.ProxyRelated.MaxGoodAttempts
 	BackoffTimeForGoodAttempts = yamlConfig.ProxyRelated.BackoffTimeForGoodAttempts
 	ProxyrackBackoffTime = yamlConfig.ProxyRelated.ProxyRackBackoffTime
-	RemoveDeadTime = yamlConfig.ProxyRelated.RemoveDeadDays * 24 * 60 * 60
+	RemoveDeadTime = yamlConfig.ProxyRelated.RemoveDeadDays * secsInDay
+	LatencySmoothing = yamlConfig.ProxyRelated.LatencySmoothing
+	ProxyRateLimit = yamlConfig.ProxyRelated.RateLimit
+	ScraperQuota = yamlConfig.ProxyRelated.Quota
+	ScraperCircuitBreaker = yamlConfig.ProxyRelated.CircuitBreaker
+	GlobalBlocklist = yamlConfig.Blocklist.Blocklist
+	ASNDatabase = yamlConfig.Blocklist.ASNDatabase
+	if LatencySmoothing <= 0 || LatencySmoothing > 1 {
+		LatencySmoothing = defaultLatencySmoothing
+	}
+	FailurePolicies = yamlConfig.FailurePolicies
+	GlobalBackoff = yamlConfig.Backoff
 	StatsFileName = yamlConfig.StatsFileName
+	ResolvePolicies()
+}
+
+// parseGroups checks scraper groups from config, group can't be named as a scraper
+// and scraper can't be a member of two groups
+func parseGroups() map[string][]string {
+	groups := make(map[string][]string)
+	groupOf := make(map[string]string)
+	for _, group := range yamlConfig.Groups {
+		if group.Name == "" {
+			log.Fatal().Msg("Scraper group without name in config file")
+		}
+		if _, ok := groups[group.Name]; ok {
+			log.Fatal().Str("group", group.Name).Msg("Scraper group listed in config file twice")
+		}
+		for _, scraper := range Scrapers {
+			if scraper == group.Name {
+				log.Fatal().Str("group", group.Name).Msg("Scraper group is named as a scraper")
+			}
+		}
+		for _, member := range group.Members {
+			if otherGroup, ok := groupOf[member]; ok {
+				log.Fatal().Str("scraper", member).Str("group", group.Name).Str("other_group", otherGroup).
+					Msg("Scraper is a member of two groups")
+			}
+			groupOf[member] = group.Name
+		}
+		groups[group.Name] = group.Members
+	}
+	return groups
 }
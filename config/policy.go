@@ -0,0 +1,161 @@
+package config
+
+import "sync"
+
+const secsInDay = 24 * 60 * 60
+
+// PolicyOverrides proxy related settings of a scraper overriding the global ones, nil for not overridden
+type PolicyOverrides struct {
+	MaxGoodAttempts            *int32                   `yaml:"max-good-attempts"`
+	BackoffTimeForGoodAttempts *int64                   `yaml:"backoff-time-for-good-attempts-attempts"`
+	ProxyRackBackoffTime       *int64                   `yaml:"proxyrack-backoff-time"`
+	RemoveDeadDays             *int64                   `yaml:"remove-dead-days"`
+	LatencySmoothing           *float64                 `yaml:"latency-smoothing"`
+	RateLimit                  *RateLimit               `yaml:"rate-limit"`
+	Quota                      *Quota                   `yaml:"quota"`
+	CircuitBreaker             *CircuitBreaker          `yaml:"circuit-breaker"`
+	Blocklist                  Blocklist                `yaml:"blocklist"`
+	FailurePolicies            map[string]FailurePolicy `yaml:"failure-policies"`
+	Backoff                    BackoffTiers             `yaml:"backoff"`
+}
+
+// ProxyPolicy proxy related settings effective for a scraper
+type ProxyPolicy struct {
+	MaxGoodAttempts            int32                    `json:"max_good_attempts"`
+	BackoffTimeForGoodAttempts int64                    `json:"backoff_time_for_good_attempts"`
+	ProxyrackBackoffTime       int64                    `json:"proxyrack_backoff_time"`
+	RemoveDeadTime             int64                    `json:"remove_dead_time"`
+	LatencySmoothing           float64                  `json:"latency_smoothing"`
+	RateLimit                  RateLimit                `json:"rate_limit"`
+	Quota                      Quota                    `json:"quota"`
+	CircuitBreaker             CircuitBreaker           `json:"circuit_breaker"`
+	Blocklist                  Blocklist                `json:"blocklist"`
+	FailurePolicies            map[string]FailurePolicy `json:"failure_policies"`
+}
+
+var (
+	// ScraperOverrides settings of scrapers overriding the global ones, by scraper
+	ScraperOverrides map[string]PolicyOverrides
+	// policies of scrapers with overrides resolved by ResolvePolicies, globalPolicy is for the rest
+	policies       map[string]ProxyPolicy
+	globalPolicy   ProxyPolicy
+	overridesMutex sync.RWMutex
+)
+
+// OverridesFor returns settings overridden by scraper
+func OverridesFor(scraper string) (overrides PolicyOverrides, ok bool) {
+	overridesMutex.RLock()
+	defer overridesMutex.RUnlock()
+	overrides, ok = ScraperOverrides[scraper]
+	return
+}
+
+// RenameOverrides moves overridden settings of renamed scraper to its new name
+func RenameOverrides(from, to string) {
+	overridesMutex.Lock()
+	defer overridesMutex.Unlock()
+	if overrides, ok := ScraperOverrides[from]; ok {
+		ScraperOverrides[to] = overrides
+		delete(ScraperOverrides, from)
+		policies[to] = policies[from]
+		delete(policies, from)
+	}
+}
+
+// SetMaxGoodAttempts changes global max good attempts, scrapers overriding it keep their own
+func SetMaxGoodAttempts(attempts int32) {
+	overridesMutex.Lock()
+	defer overridesMutex.Unlock()
+	MaxGoodAttempts = attempts
+	resolvePolicies()
+}
+
+// SetRemoveDeadTime changes global time in seconds dead proxy is kept, scrapers overriding it keep their own
+func SetRemoveDeadTime(seconds int64) {
+	overridesMutex.Lock()
+	defer overridesMutex.Unlock()
+	RemoveDeadTime = seconds
+	resolvePolicies()
+}
+
+// PolicyFor returns settings effective for scraper
+func PolicyFor(scraper string) ProxyPolicy {
+	overridesMutex.RLock()
+	defer overridesMutex.RUnlock()
+	if policy, ok := policies[scraper]; ok {
+		return policy
+	}
+	return globalPolicy
+}
+
+// ResolvePolicies merges overrides of every scraper with global settings, it is done once config is parsed
+// so PolicyFor does not merge them on every call
+func ResolvePolicies() {
+	overridesMutex.Lock()
+	defer overridesMutex.Unlock()
+	resolvePolicies()
+}
+
+func resolvePolicies() {
+	globalPolicy = ProxyPolicy{
+		MaxGoodAttempts:            MaxGoodAttempts,
+		BackoffTimeForGoodAttempts: BackoffTimeForGoodAttempts,
+		ProxyrackBackoffTime:       ProxyrackBackoffTime,
+		RemoveDeadTime:             RemoveDeadTime,
+		LatencySmoothing:           LatencySmoothing,
+		RateLimit:                  ProxyRateLimit,
+		Quota:                      ScraperQuota,
+		CircuitBreaker:             ScraperCircuitBreaker,
+		Blocklist:                  GlobalBlocklist,
+		FailurePolicies:            FailurePolicies,
+	}
+	policies = make(map[string]ProxyPolicy, len(ScraperOverrides))
+	for scraper, overrides := range ScraperOverrides {
+		policies[scraper] = resolve(globalPolicy, overrides)
+	}
+}
+
+// resolve puts overridden settings in place of global ones,
+// failure policies are overridden reason by reason, blocklist of scraper is added to the global one
+func resolve(policy ProxyPolicy, overrides PolicyOverrides) ProxyPolicy {
+	if overrides.MaxGoodAttempts != nil {
+		policy.MaxGoodAttempts = *overrides.MaxGoodAttempts
+	}
+	if overrides.BackoffTimeForGoodAttempts != nil {
+		policy.BackoffTimeForGoodAttempts = *overrides.BackoffTimeForGoodAttempts
+	}
+	if overrides.ProxyRackBackoffTime != nil {
+		policy.ProxyrackBackoffTime = *overrides.ProxyRackBackoffTime
+	}
+	if overrides.RemoveDeadDays != nil {
+		policy.RemoveDeadTime = *overrides.RemoveDeadDays * secsInDay
+	}
+	if overrides.LatencySmoothing != nil && *overrides.LatencySmoothing > 0 && *overrides.LatencySmoothing <= 1 {
+		policy.LatencySmoothing = *overrides.LatencySmoothing
+	}
+	if overrides.RateLimit != nil {
+		policy.RateLimit = *overrides.RateLimit
+	}
+	if overrides.Quota != nil {
+		policy.Quota = *overrides.Quota
+	}
+	if overrides.CircuitBreaker != nil {
+		policy.CircuitBreaker = *overrides.CircuitBreaker
+	}
+	if len(overrides.Blocklist.CIDRs) > 0 || len(overrides.Blocklist.ASNs) > 0 {
+		policy.Blocklist = Blocklist{
+			CIDRs: append(append([]string(nil), GlobalBlocklist.CIDRs...), overrides.Blocklist.CIDRs...),
+			ASNs:  append(append([]uint32(nil), GlobalBlocklist.ASNs...), overrides.Blocklist.ASNs...),
+		}
+	}
+	if len(overrides.FailurePolicies) > 0 {
+		policy.FailurePolicies = make(map[string]FailurePolicy, len(FailurePolicies)+len(overrides.FailurePolicies))
+		for reason, failurePolicy := range FailurePolicies {
+			policy.FailurePolicies[reason] = failurePolicy
+		}
+		for reason, failurePolicy := range overrides.FailurePolicies {
+			policy.FailurePolicies[reason] = failurePolicy
+		}
+	}
+	return policy
+}
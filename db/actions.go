@@ -0,0 +1,199 @@
+package db
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/AlexeyYurko/go-pmserver/now"
+)
+
+// Actions operators take on single proxies
+const (
+	// ActionQuarantine keeps proxy with its history but never hands it out until released
+	ActionQuarantine = "quarantine"
+	// ActionPin keeps proxy always available, it is never marked dead, busy or postponed
+	ActionPin = "pin"
+	// ActionBlock removes proxy and never adds it again until released
+	ActionBlock = "block"
+)
+
+// ErrNoAction returned on releasing proxy no action was taken on
+var ErrNoAction = errors.New("no action on proxy")
+
+// ProxyAction is action an operator took on proxy for one scraper, or for all of them if Scraper is empty
+type ProxyAction struct {
+	Scraper string `bson:"scraper" json:"scraper"`
+	Proxy   string `bson:"proxy" json:"proxy"`
+	Action  string `bson:"action" json:"action"`
+	Reason  string `bson:"reason" json:"reason"`
+	Actor   string `bson:"actor" json:"actor"`
+	At      int64  `bson:"at" json:"at"`
+}
+
+// proxyActions keeps actions by proxy pool, empty pool is for actions on all scrapers
+type proxyActions struct {
+	*sync.RWMutex
+	byPool map[string]map[string]ProxyAction
+}
+
+// Actions taken by operators on single proxies
+var Actions = proxyActions{RWMutex: &sync.RWMutex{}, byPool: make(map[string]map[string]ProxyAction)}
+
+// ValidAction checks if action is one of known actions
+func ValidAction(action string) bool {
+	return action == ActionQuarantine || action == ActionPin || action == ActionBlock
+}
+
+// TakeAction applies action on proxy and saves it to MongoDB, action for a scraper takes place of action for all scrapers
+func TakeAction(action ProxyAction) {
+	if action.Scraper != "" {
+		action.Scraper = poolOf(action.Scraper)
+	}
+	action.At = now.Time()
+	Actions.store(action)
+	saveAction(action)
+
+	switch action.Action {
+	case ActionBlock:
+		Base.RemoveProxies(action.Scraper, []string{action.Proxy})
+	case ActionPin:
+		for _, scraper := range actionScrapers(action.Scraper) {
+			if Base.Exist(scraper, action.Proxy) {
+				Base.CleanNextCheck(scraper, action.Proxy)
+				Set.Good(scraper, action.Proxy)
+			}
+		}
+	}
+	log.Info().
+		Str("scraper", action.Scraper).
+		Str("proxy", action.Proxy).
+		Str("action", action.Action).
+		Str("reason", action.Reason).
+		Str("actor", action.Actor).
+		Msg("action taken on proxy")
+}
+
+// ReleaseProxy cancels action taken on proxy for scraper, or for all scrapers if scraper is empty
+func ReleaseProxy(scraper, proxy, actor string) error {
+	if scraper != "" {
+		scraper = poolOf(scraper)
+	}
+	if !Actions.remove(scraper, proxy) {
+		return ErrNoAction
+	}
+	removeAction(scraper, proxy)
+	log.Info().
+		Str("scraper", scraper).
+		Str("proxy", proxy).
+		Str("actor", actor).
+		Msg("proxy released")
+	return nil
+}
+
+// Of returns action effective for proxy of scraper
+func (a *proxyActions) Of(scraper, proxy string) (action ProxyAction, ok bool) {
+	pool := poolOf(scraper)
+	a.RLock()
+	defer a.RUnlock()
+	if action, ok = a.byPool[pool][proxy]; ok {
+		return
+	}
+	action, ok = a.byPool[""][proxy]
+	return
+}
+
+// Is checks if action is effective for proxy of scraper
+func (a *proxyActions) Is(scraper, proxy, action string) bool {
+	if !a.Any() {
+		return false
+	}
+	taken, ok := a.Of(scraper, proxy)
+	return ok && taken.Action == action
+}
+
+// Any checks if any action was taken at all
+func (a *proxyActions) Any() bool {
+	a.RLock()
+	defer a.RUnlock()
+	for _, actions := range a.byPool {
+		if len(actions) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// List returns actions taken for scraper with actions for all scrapers, all actions if scraper is empty
+func (a *proxyActions) List(scraper string) (actions []ProxyAction) {
+	scraperPool := poolOf(scraper)
+	a.RLock()
+	defer a.RUnlock()
+	for pool, poolActions := range a.byPool {
+		if scraper != "" && pool != "" && pool != scraperPool {
+			continue
+		}
+		for _, action := range poolActions {
+			actions = append(actions, action)
+		}
+	}
+	sort.Slice(actions, func(i, j int) bool {
+		return actions[i].At > actions[j].At
+	})
+	return
+}
+
+// store keeps action by its Scraper, which is already a pool name
+func (a *proxyActions) store(action ProxyAction) {
+	a.Lock()
+	defer a.Unlock()
+	if _, ok := a.byPool[action.Scraper]; !ok {
+		a.byPool[action.Scraper] = make(map[string]ProxyAction)
+	}
+	a.byPool[action.Scraper][action.Proxy] = action
+}
+
+func (a *proxyActions) remove(pool, proxy string) bool {
+	a.Lock()
+	defer a.Unlock()
+	if _, ok := a.byPool[pool][proxy]; !ok {
+		return false
+	}
+	delete(a.byPool[pool], proxy)
+	return true
+}
+
+func (a *proxyActions) renamePool(from, to string) {
+	a.Lock()
+	defer a.Unlock()
+	if actions, ok := a.byPool[from]; ok {
+		for proxy, action := range actions {
+			action.Scraper = to
+			actions[proxy] = action
+		}
+		a.byPool[to] = actions
+		delete(a.byPool, from)
+	}
+}
+
+func (a *proxyActions) forgetPool(pool string) {
+	a.Lock()
+	defer a.Unlock()
+	delete(a.byPool, pool)
+}
+
+func (a *proxyActions) reset() {
+	a.Lock()
+	defer a.Unlock()
+	a.byPool = make(map[string]map[string]ProxyAction)
+}
+
+// actionScrapers returns scrapers action for scraper applies to, all of them for empty scraper
+func actionScrapers(scraper string) []string {
+	if scraper == "" {
+		return pools()
+	}
+	return []string{scraper}
+}
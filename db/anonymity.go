@@ -0,0 +1,61 @@
+package db
+
+import "sync/atomic"
+
+// Anonymity levels of proxy from the worst to the best
+const (
+	AnonymityUnknown     = ""
+	AnonymityTransparent = "transparent"
+	AnonymityAnonymous   = "anonymous"
+	AnonymityElite       = "elite"
+)
+
+var anonymityRanks = map[string]int{
+	AnonymityUnknown:     0,
+	AnonymityTransparent: 1,
+	AnonymityAnonymous:   2,
+	AnonymityElite:       3,
+}
+
+// ValidAnonymity checks if level is one of known anonymity levels
+func ValidAnonymity(level string) bool {
+	_, ok := anonymityRanks[level]
+	return ok && level != AnonymityUnknown
+}
+
+// AnonymityAtLeast reports whether level is the same or better than minLevel
+func AnonymityAtLeast(level, minLevel string) bool {
+	return anonymityRanks[level] >= anonymityRanks[minLevel]
+}
+
+// StoreAnonymity saves exit ip and anonymity level of proxy for every scraper it belongs to
+func (c *localBase) StoreAnonymity(proxy, exitIP, level string, checkedAt int64) {
+	c.Lock()
+	defer c.Unlock()
+	for scraper := range c.base {
+		pInfo, ok := c.base[scraper][proxy]
+		if !ok {
+			continue
+		}
+		pInfo.ExitIP = exitIP
+		pInfo.Anonymity = level
+		atomic.StoreInt64(&pInfo.AnonymityChecked, checkedAt)
+		c.base[scraper][proxy] = pInfo
+	}
+}
+
+// Anonymity returns anonymity level of proxy
+func (c *localBase) Anonymity(scraper, proxy string) string {
+	scraper = poolOf(scraper)
+	c.RLock()
+	defer c.RUnlock()
+	return c.base[scraper][proxy].Anonymity
+}
+
+// AnonymityChecked returns time of the last anonymity probe of proxy, 0 if it was never probed
+func (c *localBase) AnonymityChecked(scraper, proxy string) int64 {
+	scraper = poolOf(scraper)
+	c.RLock()
+	defer c.RUnlock()
+	return c.base[scraper][proxy].AnonymityChecked
+}
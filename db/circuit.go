@@ -0,0 +1,62 @@
+package db
+
+import "sync"
+
+// Circuit is state of scraper circuit breaker with requests counted in the current window
+type Circuit struct {
+	State       string `json:"state"`
+	Since       int64  `json:"since"`
+	WindowStart int64  `json:"window_start"`
+	Successes   int    `json:"successes"`
+	Failures    int    `json:"failures"`
+}
+
+type circuitBreakers struct {
+	*sync.Mutex
+	byScraper map[string]*Circuit
+}
+
+// Circuits circuit breakers of scrapers, by scraper, not saved to MongoDB
+var Circuits = circuitBreakers{Mutex: &sync.Mutex{}, byScraper: make(map[string]*Circuit)}
+
+// Update runs update on circuit of scraper with circuits locked, fresh is true
+// for scraper which had no circuit yet and gets an empty one to set up
+func (b *circuitBreakers) Update(scraper string, update func(circuit *Circuit, fresh bool)) {
+	b.Lock()
+	defer b.Unlock()
+	circuit, ok := b.byScraper[scraper]
+	if !ok {
+		circuit = &Circuit{}
+		b.byScraper[scraper] = circuit
+	}
+	update(circuit, !ok)
+}
+
+// Known checks if scraper has a circuit
+func (b *circuitBreakers) Known(scraper string) bool {
+	b.Lock()
+	defer b.Unlock()
+	_, ok := b.byScraper[scraper]
+	return ok
+}
+
+func (b *circuitBreakers) rename(from, to string) {
+	b.Lock()
+	defer b.Unlock()
+	if circuit, ok := b.byScraper[from]; ok {
+		b.byScraper[to] = circuit
+		delete(b.byScraper, from)
+	}
+}
+
+func (b *circuitBreakers) forget(scraper string) {
+	b.Lock()
+	defer b.Unlock()
+	delete(b.byScraper, scraper)
+}
+
+func (b *circuitBreakers) reset() {
+	b.Lock()
+	defer b.Unlock()
+	b.byScraper = make(map[string]*Circuit)
+}
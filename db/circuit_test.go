@@ -0,0 +1,41 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+)
+
+func TestCircuitFollowsScraper(t *testing.T) {
+	t.Cleanup(func() { config.Groups = nil })
+	config.Scrapers = []string{"solo", "greedy", "modest"}
+	config.Groups = map[string][]string{"shop": {"greedy", "modest"}}
+	config.ProxyrackProxyIP = []string{"9.9.9.9"}
+	Init()
+	for _, scraper := range config.Scrapers {
+		Circuits.Update(scraper, func(circuit *Circuit, _ bool) { circuit.State = "open" })
+	}
+
+	for from, to := range map[string]string{"solo": "single", "greedy": "hungry"} {
+		if err := renameScraper(from, to); err != nil {
+			t.Fatalf("rename %s: %v", from, err)
+		}
+		if Circuits.Known(from) || !Circuits.Known(to) {
+			t.Errorf("circuit of %s not moved to %s", from, to)
+		}
+		Circuits.Update(to, func(circuit *Circuit, fresh bool) {
+			if fresh || circuit.State != "open" {
+				t.Errorf("circuit of %s lost its state", to)
+			}
+		})
+	}
+
+	for _, scraper := range []string{"single", "modest"} {
+		if _, err := removeScraper(scraper); err != nil {
+			t.Fatalf("remove %s: %v", scraper, err)
+		}
+		if Circuits.Known(scraper) {
+			t.Errorf("circuit of removed %s kept", scraper)
+		}
+	}
+}
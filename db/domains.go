@@ -0,0 +1,162 @@
+package db
+
+import "sort"
+
+// domainHealth is state of proxy on one target domain of scraper, proxy dead on a domain
+// is still handed out for other domains
+type domainHealth struct {
+	FailedAttempts int32 `bson:"failed_attempts"`
+	LastBackoff    int64 `bson:"last_backoff"`
+	DeadUntil      int64 `bson:"dead_until"`
+}
+
+// domainRecord is health of proxy on one domain as it is saved to MongoDB,
+// domains are kept in array as dotted names are not valid field names there
+type domainRecord struct {
+	Domain         string `bson:"domain"`
+	FailedAttempts int32  `bson:"failed_attempts"`
+	LastBackoff    int64  `bson:"last_backoff"`
+	DeadUntil      int64  `bson:"dead_until"`
+}
+
+// domainRecords converts health by domain to records sorted by domain
+func domainRecords(domains map[string]domainHealth) []domainRecord {
+	records := make([]domainRecord, 0, len(domains))
+	for domain, health := range domains {
+		records = append(records, domainRecord{
+			Domain:         domain,
+			FailedAttempts: health.FailedAttempts,
+			LastBackoff:    health.LastBackoff,
+			DeadUntil:      health.DeadUntil,
+		})
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Domain < records[j].Domain
+	})
+	return records
+}
+
+// domainsOf converts records loaded from MongoDB back to health by domain
+func domainsOf(records []domainRecord) map[string]domainHealth {
+	if len(records) == 0 {
+		return nil
+	}
+	domains := make(map[string]domainHealth, len(records))
+	for _, record := range records {
+		domains[record.Domain] = domainHealth{
+			FailedAttempts: record.FailedAttempts,
+			LastBackoff:    record.LastBackoff,
+			DeadUntil:      record.DeadUntil,
+		}
+	}
+	return domains
+}
+
+// ForgetExpiredDomains drops health of proxies on domains they stopped being dead on before the given time,
+// returns how many were dropped
+func (c *localBase) ForgetExpiredDomains(scraper string, before int64) (forgotten int) {
+	scraper = poolOf(scraper)
+	c.Lock()
+	defer c.Unlock()
+	for proxy, pInfo := range c.base[scraper] {
+		for domain, health := range pInfo.Domains {
+			if health.DeadUntil < before {
+				pInfo.Domains = withDomain(pInfo.Domains, domain, nil)
+				forgotten++
+			}
+		}
+		c.base[scraper][proxy] = pInfo
+	}
+	return
+}
+
+// IncDomainFailures counts failure of proxy on domain and returns failures in a row with the last backoff
+// given on that domain
+func (c *localBase) IncDomainFailures(scraper, proxy, domain string) (failedAttempts int32, lastBackoff int64) {
+	scraper = poolOf(scraper)
+	c.Lock()
+	defer c.Unlock()
+	pInfo, ok := c.base[scraper][proxy]
+	if !ok {
+		return
+	}
+	health := pInfo.Domains[domain]
+	health.FailedAttempts++
+	pInfo.Domains = withDomain(pInfo.Domains, domain, &health)
+	c.base[scraper][proxy] = pInfo
+	return health.FailedAttempts, health.LastBackoff
+}
+
+// StoreDomainBackoff marks proxy dead on domain for backoff seconds since deadFrom
+func (c *localBase) StoreDomainBackoff(scraper, proxy, domain string, backoff, deadFrom int64) {
+	scraper = poolOf(scraper)
+	c.Lock()
+	defer c.Unlock()
+	pInfo, ok := c.base[scraper][proxy]
+	if !ok {
+		return
+	}
+	health := pInfo.Domains[domain]
+	health.LastBackoff = backoff
+	health.DeadUntil = deadFrom + backoff
+	pInfo.Domains = withDomain(pInfo.Domains, domain, &health)
+	c.base[scraper][proxy] = pInfo
+}
+
+// StoreDomainDeadUntil marks proxy dead on domain until the given time keeping its last backoff,
+// so the next backoff on the domain is not escalated by this one
+func (c *localBase) StoreDomainDeadUntil(scraper, proxy, domain string, deadUntil int64) {
+	scraper = poolOf(scraper)
+	c.Lock()
+	defer c.Unlock()
+	pInfo, ok := c.base[scraper][proxy]
+	if !ok {
+		return
+	}
+	health := pInfo.Domains[domain]
+	health.DeadUntil = deadUntil
+	pInfo.Domains = withDomain(pInfo.Domains, domain, &health)
+	c.base[scraper][proxy] = pInfo
+}
+
+// ClearDomain forgets failures of proxy on domain after it worked there
+func (c *localBase) ClearDomain(scraper, proxy, domain string) {
+	scraper = poolOf(scraper)
+	c.Lock()
+	defer c.Unlock()
+	pInfo, ok := c.base[scraper][proxy]
+	if !ok {
+		return
+	}
+	if _, known := pInfo.Domains[domain]; !known {
+		return
+	}
+	pInfo.Domains = withDomain(pInfo.Domains, domain, nil)
+	c.base[scraper][proxy] = pInfo
+}
+
+// AliveOnDomain checks proxy is not dead on domain at the given time
+func (c *localBase) AliveOnDomain(scraper, proxy, domain string, at int64) bool {
+	scraper = poolOf(scraper)
+	c.RLock()
+	defer c.RUnlock()
+	return c.base[scraper][proxy].Domains[domain].DeadUntil <= at
+}
+
+// withDomain returns copy of domains with health of domain replaced, nil health removes the domain,
+// copies of record given out by RangeScraper share the map, so it is never changed in place
+func withDomain(domains map[string]domainHealth, domain string, health *domainHealth) map[string]domainHealth {
+	updated := make(map[string]domainHealth, len(domains)+1)
+	for knownDomain, knownHealth := range domains {
+		updated[knownDomain] = knownHealth
+	}
+	if health == nil {
+		delete(updated, domain)
+	} else {
+		updated[domain] = *health
+	}
+	if len(updated) == 0 {
+		return nil
+	}
+	return updated
+}
@@ -0,0 +1,136 @@
+package db
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/AlexeyYurko/go-pmserver/now"
+)
+
+// Event types published to Events
+const (
+	// EventStatus proxy moved from one status to another, From is empty for new proxy, Scraper is the pool name
+	EventStatus = "status"
+	// EventRemoved proxy removed from the pool of scraper, Scraper is the pool name
+	EventRemoved = "removed"
+	// EventReload proxy list reloaded from source, Count is size of the list
+	EventReload = "reload"
+	// EventReloadFailed proxy list could not be reloaded, Message tells why
+	EventReloadFailed = "reload-failed"
+	// EventReanimate Count proxies of the pool reanimated, Scraper is the pool name
+	EventReanimate = "reanimate"
+	// EventCircuit circuit breaker of scraper moved From one state To another
+	EventCircuit = "circuit"
+)
+
+// EventTypes lists every event type
+var EventTypes = []string{EventStatus, EventRemoved, EventReload, EventReloadFailed, EventReanimate, EventCircuit}
+
+const eventBuffer = 256
+
+// Event is change of proxies published to subscribers of Events, Member is the group member
+// status or removed event was made for, empty when it was made for the whole pool
+type Event struct {
+	Type    string `json:"type"`
+	Scraper string `json:"scraper,omitempty"`
+	Member  string `json:"member,omitempty"`
+	Proxy   string `json:"proxy,omitempty"`
+	From    string `json:"from,omitempty"`
+	To      string `json:"to,omitempty"`
+	Count   int    `json:"count,omitempty"`
+	Message string `json:"message,omitempty"`
+	At      int64  `json:"at"`
+}
+
+// EventFilter selects events of subscription, empty list allows any
+type EventFilter struct {
+	Scrapers []string
+	Types    []string
+}
+
+func (f EventFilter) matches(event Event) bool {
+	if len(f.Types) > 0 && !slices.Contains(f.Types, event.Type) {
+		return false
+	}
+	// events of every scraper, like reload, go to everybody
+	if len(f.Scrapers) == 0 || event.Scraper == "" || slices.Contains(f.Scrapers, event.Scraper) {
+		return true
+	}
+	// status, removed and reanimate events name the pool, members of its group get them too
+	return slices.ContainsFunc(f.Scrapers, func(scraper string) bool { return poolOf(scraper) == event.Scraper })
+}
+
+// Subscription receives matching events from C until it is cancelled,
+// events are dropped while C is full
+type Subscription struct {
+	C <-chan Event
+
+	events  chan Event
+	filter  EventFilter
+	dropped atomic.Int64
+}
+
+// Dropped returns how many events were dropped since the previous call
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Swap(0)
+}
+
+type eventBus struct {
+	sync.RWMutex
+	subscribers map[*Subscription]struct{}
+	active      atomic.Int32
+}
+
+// Events publishes changes of proxies, it is kept over Init
+var Events = eventBus{subscribers: make(map[*Subscription]struct{})}
+
+// Subscribe starts receiving events matching filter
+func (b *eventBus) Subscribe(filter EventFilter) *Subscription {
+	events := make(chan Event, eventBuffer)
+	subscription := &Subscription{C: events, events: events, filter: filter}
+	b.Lock()
+	defer b.Unlock()
+	b.subscribers[subscription] = struct{}{}
+	b.active.Add(1)
+	return subscription
+}
+
+// Cancel stops subscription, its channel is closed
+func (b *eventBus) Cancel(subscription *Subscription) {
+	b.Lock()
+	defer b.Unlock()
+	if _, ok := b.subscribers[subscription]; !ok {
+		return
+	}
+	delete(b.subscribers, subscription)
+	b.active.Add(-1)
+	close(subscription.events)
+}
+
+// Active checks if anybody listens, so publishers can skip building events
+func (b *eventBus) Active() bool {
+	return b.active.Load() > 0
+}
+
+// Publish sends event to every matching subscriber without waiting for slow ones
+func (b *eventBus) Publish(event Event) {
+	if !b.Active() {
+		return
+	}
+	if event.At == 0 {
+		event.At = now.Time()
+	}
+	b.RLock()
+	defer b.RUnlock()
+	for subscription := range b.subscribers {
+		if !subscription.filter.matches(event) {
+			continue
+		}
+		select {
+		case subscription.events <- event:
+		default:
+			subscription.dropped.Add(1)
+		}
+	}
+}
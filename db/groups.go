@@ -0,0 +1,198 @@
+package db
+
+import (
+	"sort"
+	"sync"
+)
+
+// usage is success stats of proxy collected for one member of scraper group
+type usage struct {
+	LastSuccessfullyUsed   int64 `bson:"last_successfully_used"`
+	NumberOfSuccessfulUses int32 `bson:"number_of_successful_uses"`
+	LastFailureUsed        int64 `bson:"last_failure_used"`
+	NumberOfFailures       int32 `bson:"number_of_failures"`
+}
+
+// scraperGroups keeps group of every grouped scraper, members of a group share one proxy pool
+// named after the group
+type scraperGroups struct {
+	*sync.RWMutex
+	groupOf map[string]string
+}
+
+var groups = scraperGroups{RWMutex: &sync.RWMutex{}, groupOf: make(map[string]string)}
+
+// poolOf returns name of proxy pool used by scraper, it is the group name for grouped scraper
+// and the scraper itself otherwise
+func poolOf(scraper string) string {
+	groups.RLock()
+	defer groups.RUnlock()
+	if group, ok := groups.groupOf[scraper]; ok {
+		return group
+	}
+	return scraper
+}
+
+// memberOf returns scraper if it is a member of group, empty for scraper not in group and for the group itself
+func memberOf(scraper string) string {
+	if _, ok := GroupOf(scraper); ok {
+		return scraper
+	}
+	return ""
+}
+
+// GroupOf returns group of scraper, ok is false for scraper not in group
+func GroupOf(scraper string) (group string, ok bool) {
+	groups.RLock()
+	defer groups.RUnlock()
+	group, ok = groups.groupOf[scraper]
+	return
+}
+
+// GroupMembers returns registered scrapers of group sorted by name
+func GroupMembers(group string) (members []string) {
+	for _, scraper := range Scrapers() {
+		if memberOf, ok := GroupOf(scraper); ok && memberOf == group {
+			members = append(members, scraper)
+		}
+	}
+	sort.Strings(members)
+	return
+}
+
+// pools returns names of proxy pools of all registered scrapers, every pool listed once
+func pools() (poolNames []string) {
+	seen := make(map[string]bool)
+	for _, scraper := range Scrapers() {
+		pool := poolOf(scraper)
+		if seen[pool] {
+			continue
+		}
+		seen[pool] = true
+		poolNames = append(poolNames, pool)
+	}
+	return
+}
+
+// poolInUse checks if any registered scraper uses pool
+func poolInUse(pool string) bool {
+	for _, scraper := range Scrapers() {
+		if poolOf(scraper) == pool {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *scraperGroups) init(groupMembers map[string][]string) {
+	g.Lock()
+	defer g.Unlock()
+	g.groupOf = make(map[string]string)
+	for group, members := range groupMembers {
+		for _, member := range members {
+			g.groupOf[member] = group
+		}
+	}
+}
+
+func (g *scraperGroups) rename(from, to string) {
+	g.Lock()
+	defer g.Unlock()
+	if group, ok := g.groupOf[from]; ok {
+		g.groupOf[to] = group
+		delete(g.groupOf, from)
+	}
+}
+
+// withMemberUsage returns record of grouped proxy with success stats of member instead of the whole group
+func (record proxy) withMemberUsage(member string) proxy {
+	memberUsage := record.MemberUsage[member]
+	record.LastSuccessfullyUsed = memberUsage.LastSuccessfullyUsed
+	record.NumberOfSuccessfulUses = memberUsage.NumberOfSuccessfulUses
+	record.LastFailureUsed = memberUsage.LastFailureUsed
+	record.NumberOfFailures = memberUsage.NumberOfFailures
+	return record
+}
+
+// mergedWith returns record of pool proxy merged with record of the same proxy kept by a member
+// before it joined the group: the longer backoff wins, usage stats add up
+func (record proxy) mergedWith(other proxy) proxy {
+	if other.NextCheck > record.NextCheck {
+		record.Status = other.Status
+		record.StartGetProxyTime = other.StartGetProxyTime
+		record.NextCheck = other.NextCheck
+		record.GoodAttempts = other.GoodAttempts
+		record.FailedAttempts = other.FailedAttempts
+		record.LastBackoff = other.LastBackoff
+	}
+	record.LastSuccessfullyUsed = max(record.LastSuccessfullyUsed, other.LastSuccessfullyUsed)
+	record.NumberOfSuccessfulUses += other.NumberOfSuccessfulUses
+	record.LastFailureUsed = max(record.LastFailureUsed, other.LastFailureUsed)
+	record.NumberOfFailures += other.NumberOfFailures
+	if samples := record.LatencySamples + other.LatencySamples; samples > 0 {
+		record.Latency = (record.Latency*float64(record.LatencySamples) + other.Latency*float64(other.LatencySamples)) /
+			float64(samples)
+		record.LatencySamples = samples
+	}
+	if other.AnonymityChecked > record.AnonymityChecked {
+		record.ExitIP = other.ExitIP
+		record.Anonymity = other.Anonymity
+		record.AnonymityChecked = other.AnonymityChecked
+	}
+
+	failureReasons := make(map[string]int32, len(record.FailureReasons)+len(other.FailureReasons))
+	for _, reasons := range []map[string]int32{record.FailureReasons, other.FailureReasons} {
+		for reason, failures := range reasons {
+			failureReasons[reason] += failures
+		}
+	}
+	record.FailureReasons = failureReasons
+
+	memberUsages := make(map[string]usage, len(record.MemberUsage)+len(other.MemberUsage))
+	for _, usages := range []map[string]usage{record.MemberUsage, other.MemberUsage} {
+		for member, memberUsage := range usages {
+			memberUsages[member] = memberUsage
+		}
+	}
+	record.MemberUsage = memberUsages
+
+	for domain, health := range other.Domains {
+		if known, ok := record.Domains[domain]; !ok || health.DeadUntil > known.DeadUntil {
+			record.Domains = withDomain(record.Domains, domain, &health)
+		}
+	}
+	return record
+}
+
+// updateMemberUsage applies change to success stats of member, copies of record given out by RangeScraper
+// share the map, so it is replaced instead of changed
+func (record *proxy) updateMemberUsage(member string, change func(*usage)) {
+	memberUsages := make(map[string]usage, len(record.MemberUsage)+1)
+	for knownMember, memberUsage := range record.MemberUsage {
+		memberUsages[knownMember] = memberUsage
+	}
+	memberUsage := memberUsages[member]
+	change(&memberUsage)
+	memberUsages[member] = memberUsage
+	record.MemberUsage = memberUsages
+}
+
+// renameMember moves success stats of renamed member in all proxies of pool
+func (c *localBase) renameMember(pool, from, to string) {
+	c.Lock()
+	defer c.Unlock()
+	for proxy, record := range c.base[pool] {
+		if _, ok := record.MemberUsage[from]; !ok {
+			continue
+		}
+		memberUsages := make(map[string]usage, len(record.MemberUsage))
+		for member, memberUsage := range record.MemberUsage {
+			if member == from {
+				member = to
+			}
+			memberUsages[member] = memberUsage
+		}
+		record.MemberUsage = memberUsages
+		c.base[pool][proxy] = record
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/rs/zerolog/log"
 
+	"github.com/AlexeyYurko/go-pmserver/blocklist"
 	"github.com/AlexeyYurko/go-pmserver/config"
 	"github.com/AlexeyYurko/go-pmserver/now"
 )
@@ -24,6 +25,8 @@ const (
 )
 
 var (
+	// statsMu guards internal stats, they are written by concurrent requests and checker probes
+	statsMu sync.Mutex
 	// GoodPostponeTimeoutsForStats internal stats
 	GoodPostponeTimeoutsForStats map[string][]int64
 	// ProxySuccessUsageTimeForStats internal stats
@@ -40,6 +43,25 @@ type RequestsRate struct {
 	Counter              int
 }
 
+// AddStat appends value to internal stats of scraper
+func AddStat(stats map[string][]int64, scraper string, value int64) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	stats[scraper] = append(stats[scraper], value)
+}
+
+// CountSuccessfulGet counts proxy handed out to scraper, counting starts at the first one
+func CountSuccessfulGet(scraper string, at int64) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	rate := SuccessfulGetRandomProxyRequestRate[scraper]
+	if rate.Counter == 0 {
+		rate.TimeForStartCounting = at
+	}
+	rate.Counter++
+	SuccessfulGetRandomProxyRequestRate[scraper] = rate
+}
+
 // proxy for store info only about proxy inside scraper
 type proxy struct {
 	Status                 string
@@ -51,6 +73,15 @@ type proxy struct {
 	NumberOfSuccessfulUses int32
 	LastFailureUsed        int64
 	NumberOfFailures       int32
+	Latency                float64
+	LatencySamples         int32
+	ExitIP                 string
+	Anonymity              string
+	AnonymityChecked       int64
+	FailureReasons         map[string]int32
+	LastBackoff            int64
+	MemberUsage            map[string]usage
+	Domains                map[string]domainHealth
 }
 
 type localBase struct {
@@ -62,18 +93,24 @@ type localBase struct {
 var Base localBase
 
 func (c *localBase) Store(scraper, proxy string, value proxy) {
+	scraper = poolOf(scraper)
 	c.Lock()
 	defer c.Unlock()
+	if _, ok := c.base[scraper]; !ok {
+		return
+	}
 	c.base[scraper][proxy] = value
 }
 
 func (c *localBase) Delete(scraper, proxy string) {
+	scraper = poolOf(scraper)
 	c.Lock()
 	defer c.Unlock()
 	delete(c.base[scraper], proxy)
 }
 
 func (c *localBase) Exist(scraper, proxy string) (proxyExist bool) {
+	scraper = poolOf(scraper)
 	c.RLock()
 	defer c.RUnlock()
 	_, proxyExist = c.base[scraper][proxy]
@@ -81,6 +118,7 @@ func (c *localBase) Exist(scraper, proxy string) (proxyExist bool) {
 }
 
 func (c *localBase) ProxyTime(scraper, proxy string) (proxyTime int64) {
+	scraper = poolOf(scraper)
 	c.RLock()
 	defer c.RUnlock()
 	proxyTime = c.base[scraper][proxy].StartGetProxyTime
@@ -88,6 +126,7 @@ func (c *localBase) ProxyTime(scraper, proxy string) (proxyTime int64) {
 }
 
 func (c *localBase) ProxyNotInBase(scraper, proxy string) bool {
+	scraper = poolOf(scraper)
 	c.RLock()
 	defer c.RUnlock()
 	if _, ok := c.base[scraper][proxy]; !ok {
@@ -100,6 +139,18 @@ func (c *localBase) ProxyNotInBase(scraper, proxy string) bool {
 	return false
 }
 
+// ProxiesInBase checks which of proxies are in the pool of scraper under one lock
+func (c *localBase) ProxiesInBase(scraper string, proxies []string) (known map[string]bool) {
+	scraper = poolOf(scraper)
+	known = make(map[string]bool, len(proxies))
+	c.RLock()
+	defer c.RUnlock()
+	for _, proxy := range proxies {
+		_, known[proxy] = c.base[scraper][proxy]
+	}
+	return
+}
+
 func (c *localBase) rangeProxyInScraper(scraper string) (proxiesInScraper []string) {
 	c.RLock()
 	defer c.RUnlock()
@@ -109,54 +160,183 @@ func (c *localBase) rangeProxyInScraper(scraper string) (proxiesInScraper []stri
 	return
 }
 
+// RangeScraper returns records of all proxies of scraper, success stats of grouped scraper are its own
 func (c *localBase) RangeScraper(scraper string) (proxiesInScraper map[string]proxy) {
+	_, grouped := GroupOf(scraper)
+	proxiesInScraper = c.rangePool(poolOf(scraper))
+	if grouped {
+		for proxy, record := range proxiesInScraper {
+			proxiesInScraper[proxy] = record.withMemberUsage(scraper)
+		}
+	}
+	return
+}
+
+func (c *localBase) rangePool(pool string) (proxiesInPool map[string]proxy) {
 	c.RLock()
 	defer c.RUnlock()
-	proxiesInScraper = make(map[string]proxy)
-	for proxy, record := range c.base[scraper] {
-		proxiesInScraper[proxy] = record
+	proxiesInPool = make(map[string]proxy)
+	for proxy, record := range c.base[pool] {
+		proxiesInPool[proxy] = record
 	}
 	return
 }
 
 func (c *localBase) ProxyTimeToNow(scraper, proxy string) {
+	scraper = poolOf(scraper)
 	c.Lock()
 	defer c.Unlock()
-	pInfo := c.base[scraper][proxy]
+	pInfo, ok := c.base[scraper][proxy]
+	if !ok {
+		return
+	}
 	atomic.StoreInt64(&pInfo.StartGetProxyTime, now.Time())
 	c.base[scraper][proxy] = pInfo
 }
 
 func (c *localBase) IncProxyGoodAttempts(scraper, proxy string) (attempts int32) {
+	member := scraper
+	_, grouped := GroupOf(member)
+	scraper = poolOf(scraper)
 	c.Lock()
 	defer c.Unlock()
-	pInfo := c.base[scraper][proxy]
+	pInfo, ok := c.base[scraper][proxy]
+	if !ok {
+		return
+	}
+	usedAt := now.Time()
 	atomic.AddInt32(&pInfo.GoodAttempts, 1)
 	atomic.AddInt32(&pInfo.NumberOfSuccessfulUses, 1)
-	atomic.StoreInt64(&pInfo.LastSuccessfullyUsed, now.Time())
+	atomic.StoreInt64(&pInfo.LastSuccessfullyUsed, usedAt)
+	if grouped {
+		pInfo.updateMemberUsage(member, func(memberUsage *usage) {
+			memberUsage.NumberOfSuccessfulUses++
+			memberUsage.LastSuccessfullyUsed = usedAt
+		})
+	}
 	c.base[scraper][proxy] = pInfo
 	attempts = pInfo.GoodAttempts
 	return
 }
 
 func (c *localBase) IncFailureAttempts(scraper, proxy string) {
+	c.incFailures(scraper, proxy, true)
+}
+
+// CountFailedUse counts failed use of proxy in usage stats keeping failed attempts in a row,
+// which escalate backoff, as they are
+func (c *localBase) CountFailedUse(scraper, proxy string) {
+	c.incFailures(scraper, proxy, false)
+}
+
+func (c *localBase) incFailures(scraper, proxy string, inRow bool) {
+	member := scraper
+	_, grouped := GroupOf(member)
+	scraper = poolOf(scraper)
 	c.Lock()
 	defer c.Unlock()
-	pInfo := c.base[scraper][proxy]
-	atomic.AddInt32(&pInfo.FailedAttempts, 1)
+	pInfo, ok := c.base[scraper][proxy]
+	if !ok {
+		return
+	}
+	usedAt := now.Time()
+	if inRow {
+		atomic.AddInt32(&pInfo.FailedAttempts, 1)
+	}
 	atomic.AddInt32(&pInfo.NumberOfFailures, 1)
-	atomic.StoreInt64(&pInfo.LastFailureUsed, now.Time())
+	atomic.StoreInt64(&pInfo.LastFailureUsed, usedAt)
+	if grouped {
+		pInfo.updateMemberUsage(member, func(memberUsage *usage) {
+			memberUsage.NumberOfFailures++
+			memberUsage.LastFailureUsed = usedAt
+		})
+	}
 	c.base[scraper][proxy] = pInfo
 }
 
+// IncFailureReason counts failure of proxy with reason and returns how many times it failed so
+func (c *localBase) IncFailureReason(scraper, proxy, reason string) (failures int32) {
+	scraper = poolOf(scraper)
+	c.Lock()
+	defer c.Unlock()
+	pInfo, ok := c.base[scraper][proxy]
+	if !ok {
+		return
+	}
+	// copies of record given out by RangeScraper share the map, so it is replaced instead of changed
+	reasons := make(map[string]int32, len(pInfo.FailureReasons)+1)
+	for knownReason, counter := range pInfo.FailureReasons {
+		reasons[knownReason] = counter
+	}
+	reasons[reason]++
+	pInfo.FailureReasons = reasons
+	c.base[scraper][proxy] = pInfo
+	failures = reasons[reason]
+	return
+}
+
 func (c *localBase) FailedAttempts(scraper, proxy string) (failedAttempts int32) {
+	scraper = poolOf(scraper)
 	c.Lock()
 	defer c.Unlock()
 	failedAttempts = c.base[scraper][proxy].FailedAttempts
 	return
 }
 
+// StoreLatency folds new request duration in ms into rolling latency estimate of proxy,
+// smoothing is the weight of the new sample
+func (c *localBase) StoreLatency(scraper, proxy string, latency, smoothing float64) {
+	scraper = poolOf(scraper)
+	c.Lock()
+	defer c.Unlock()
+	pInfo, ok := c.base[scraper][proxy]
+	if !ok {
+		return
+	}
+	if pInfo.LatencySamples == 0 {
+		pInfo.Latency = latency
+	} else {
+		pInfo.Latency += smoothing * (latency - pInfo.Latency)
+	}
+	pInfo.LatencySamples++
+	c.base[scraper][proxy] = pInfo
+}
+
+// Latency returns rolling latency estimate of proxy in ms, known is false if nothing was measured yet
+func (c *localBase) Latency(scraper, proxy string) (latency float64, known bool) {
+	scraper = poolOf(scraper)
+	c.RLock()
+	defer c.RUnlock()
+	pInfo, ok := c.base[scraper][proxy]
+	if !ok {
+		return
+	}
+	return pInfo.Latency, pInfo.LatencySamples > 0
+}
+
+// LastBackoff returns backoff in seconds given to proxy when it was marked dead last time
+func (c *localBase) LastBackoff(scraper, proxy string) (backoff int64) {
+	scraper = poolOf(scraper)
+	c.RLock()
+	defer c.RUnlock()
+	backoff = c.base[scraper][proxy].LastBackoff
+	return
+}
+
+func (c *localBase) StoreBackoff(scraper, proxy string, backoff int64) {
+	scraper = poolOf(scraper)
+	c.Lock()
+	defer c.Unlock()
+	pInfo, ok := c.base[scraper][proxy]
+	if !ok {
+		return
+	}
+	atomic.StoreInt64(&pInfo.LastBackoff, backoff)
+	c.base[scraper][proxy] = pInfo
+}
+
 func (c *localBase) LoadNextCheck(scraper, proxy string) (nextCheck int64) {
+	scraper = poolOf(scraper)
 	c.RLock()
 	defer c.RUnlock()
 	nextCheck = c.base[scraper][proxy].NextCheck
@@ -164,17 +344,25 @@ func (c *localBase) LoadNextCheck(scraper, proxy string) (nextCheck int64) {
 }
 
 func (c *localBase) StoreNextCheck(scraper, proxy string, nextCheck int64) {
+	scraper = poolOf(scraper)
 	c.Lock()
 	defer c.Unlock()
-	pInfo := c.base[scraper][proxy]
+	pInfo, ok := c.base[scraper][proxy]
+	if !ok {
+		return
+	}
 	atomic.StoreInt64(&pInfo.NextCheck, nextCheck)
 	c.base[scraper][proxy] = pInfo
 }
 
 func (c *localBase) CleanProxyInfo(scraper, proxy string) {
+	scraper = poolOf(scraper)
 	c.Lock()
 	defer c.Unlock()
-	pInfo := c.base[scraper][proxy]
+	pInfo, ok := c.base[scraper][proxy]
+	if !ok {
+		return
+	}
 	atomic.StoreInt32(&pInfo.GoodAttempts, 0)
 	atomic.StoreInt64(&pInfo.NextCheck, 0)
 	atomic.StoreInt64(&pInfo.StartGetProxyTime, 0)
@@ -183,17 +371,25 @@ func (c *localBase) CleanProxyInfo(scraper, proxy string) {
 }
 
 func (c *localBase) CleanGoodAttempts(scraper, proxy string) {
+	scraper = poolOf(scraper)
 	c.Lock()
 	defer c.Unlock()
-	pInfo := c.base[scraper][proxy]
+	pInfo, ok := c.base[scraper][proxy]
+	if !ok {
+		return
+	}
 	atomic.StoreInt32(&pInfo.GoodAttempts, 0)
 	c.base[scraper][proxy] = pInfo
 }
 
 func (c *localBase) CleanNextCheck(scraper, proxy string) {
+	scraper = poolOf(scraper)
 	c.Lock()
 	defer c.Unlock()
-	pInfo := c.base[scraper][proxy]
+	pInfo, ok := c.base[scraper][proxy]
+	if !ok {
+		return
+	}
 	atomic.StoreInt64(&pInfo.NextCheck, 0)
 	c.base[scraper][proxy] = pInfo
 }
@@ -201,7 +397,8 @@ func (c *localBase) CleanNextCheck(scraper, proxy string) {
 func (c *localBase) RemoveProxies(scraperToRemove string, proxyList []string) {
 	var scrapersToRemove []string
 	if scraperToRemove == "" {
-		scrapersToRemove = append(scrapersToRemove, config.Scrapers...)
+		scrapersToRemove = append(scrapersToRemove, pools()...)
+		shared.remove(proxyList)
 	} else {
 		scrapersToRemove = append(scrapersToRemove, scraperToRemove)
 	}
@@ -210,42 +407,62 @@ func (c *localBase) RemoveProxies(scraperToRemove string, proxyList []string) {
 		for _, proxy := range proxyList {
 			c.removeProxy(scraper, proxy)
 		}
-		Remove(scraper, proxyList)
+		Remove(poolOf(scraper), proxyList)
 	}
 }
 
 func (c *localBase) removeProxy(scraper, proxy string) {
+	if Events.Active() && c.Exist(scraper, proxy) {
+		defer Events.Publish(Event{Type: EventRemoved, Scraper: poolOf(scraper), Member: memberOf(scraper), Proxy: proxy})
+	}
 	c.Delete(scraper, proxy)
 	var statuses = []string{available, good, postponed, busy, dead, unchecked, isProxyrack}
 	for _, status := range statuses {
 		Set.Delete(scraper, status, proxy)
 	}
+	RateLimits.forget(scraper, proxy)
 }
 
 func (c *localBase) AliveFromDead(scraper string) {
+	var reanimated int
+	scraper = poolOf(scraper)
 	log.Debug().Str("scraper", scraper).Msg("Move all proxies from 'dead' to 'unchecked'")
 	for _, proxy := range Set.GetDead(scraper) {
 		c.Lock()
-		pInfo := c.base[scraper][proxy]
+		pInfo, ok := c.base[scraper][proxy]
+		if !ok {
+			c.Unlock()
+			continue
+		}
 		atomic.StoreInt64(&pInfo.StartGetProxyTime, 0)
 		atomic.StoreInt64(&pInfo.NextCheck, 0)
 		atomic.StoreInt32(&pInfo.GoodAttempts, 0)
 		atomic.StoreInt32(&pInfo.FailedAttempts, 0)
+		atomic.StoreInt64(&pInfo.LastBackoff, 0)
 		c.base[scraper][proxy] = pInfo
 		c.Unlock()
 		Set.Unchecked(scraper, proxy)
+		reanimated++
+	}
+	if reanimated > 0 {
+		Events.Publish(Event{Type: EventReanimate, Scraper: scraper, Count: reanimated})
 	}
 }
 
 func (c *localBase) ClearUsefulnessStats() {
-	for _, scraper := range config.Scrapers {
+	for _, scraper := range pools() {
 		for _, proxy := range c.rangeProxyInScraper(scraper) {
 			c.Lock()
-			pInfo := c.base[scraper][proxy]
+			pInfo, ok := c.base[scraper][proxy]
+			if !ok {
+				c.Unlock()
+				continue
+			}
 			atomic.StoreInt64(&pInfo.LastSuccessfullyUsed, 0)
 			atomic.StoreInt32(&pInfo.NumberOfSuccessfulUses, 0)
 			atomic.StoreInt64(&pInfo.LastFailureUsed, 0)
 			atomic.StoreInt32(&pInfo.NumberOfFailures, 0)
+			pInfo.MemberUsage = nil
 			c.base[scraper][proxy] = pInfo
 			c.Unlock()
 		}
@@ -261,31 +478,34 @@ func Init() {
 		&sync.RWMutex{},
 		make(map[string]map[string]map[string]bool)}
 	Set.set = make(map[string]map[string]map[string]bool)
+	statsMu.Lock()
 	GoodPostponeTimeoutsForStats = make(map[string][]int64)
 	ProxySuccessUsageTimeForStats = make(map[string][]int64)
 	TimeStatsForUnavailableProxies = make(map[string][]int64)
 	SuccessfulGetRandomProxyRequestRate = make(map[string]RequestsRate)
-	successfulGetStat := RequestsRate{
-		TimeForStartCounting: 0,
-		Counter:              0,
-	}
-	var statuses = []string{available, good, postponed, busy, dead, unchecked, isProxyrack}
+	statsMu.Unlock()
+	registry = scraperRegistry{RWMutex: &sync.RWMutex{}}
+	shared = sharedPool{RWMutex: &sync.RWMutex{}, proxies: make(map[string]bool)}
+	groups.init(config.Groups)
+	RateLimits.reset()
+	Quotas.reset()
+	Circuits.reset()
+	Actions.reset()
 	for _, scraper := range config.Scrapers {
-		Base.base[scraper] = make(map[string]proxy)
-		Set.set[scraper] = make(map[string]map[string]bool)
-		for _, status := range statuses {
-			Set.set[scraper][status] = make(map[string]bool)
+		if err := addScraper(scraper); err != nil {
+			log.Warn().Err(err).Str("scraper", scraper).Msg("scraper listed in config twice")
 		}
-		SuccessfulGetRandomProxyRequestRate[scraper] = successfulGetStat
 	}
 }
 
-// StoreProxies put new proxies to local db
-func StoreProxies(scraperToAdd string, proxyList []string) {
+// StoreProxies put new proxies to local db, returns how many proxies were filtered out by blocklists, by scraper
+func StoreProxies(scraperToAdd string, proxyList []string) (filtered map[string]int) {
+	filtered = make(map[string]int)
 	var scrapersToAdd []string
 
 	if scraperToAdd == "" {
-		scrapersToAdd = append(scrapersToAdd, config.Scrapers...)
+		scrapersToAdd = append(scrapersToAdd, pools()...)
+		shared.add(proxyList)
 	} else {
 		scrapersToAdd = append(scrapersToAdd, scraperToAdd)
 	}
@@ -308,6 +528,13 @@ func StoreProxies(scraperToAdd string, proxyList []string) {
 			if found := Base.Exist(scraper, currentProxy); found {
 				continue
 			}
+			if Actions.Is(scraper, currentProxy, ActionBlock) {
+				continue
+			}
+			if blocklist.For(scraper).Blocked(currentProxy) {
+				filtered[scraper]++
+				continue
+			}
 			if InProxyrack(currentProxy) {
 				if config.UseProxyRack {
 					Set.Store(scraper, isProxyrack, currentProxy)
@@ -321,6 +548,7 @@ func StoreProxies(scraperToAdd string, proxyList []string) {
 		}
 		log.Debug().Str("scraper", scraper).Int("count", counter).Msg("To added new records")
 	}
+	return
 }
 
 // InProxyrack checks if the proxy belongs to the proxyrack service
@@ -16,6 +16,7 @@ type statusSet struct {
 var Set statusSet
 
 func (c *statusSet) Load(scraper, status, proxy string) (value bool) {
+	scraper = poolOf(scraper)
 	c.RLock()
 	defer c.RUnlock()
 	value = c.set[scraper][status][proxy]
@@ -23,18 +24,28 @@ func (c *statusSet) Load(scraper, status, proxy string) (value bool) {
 }
 
 func (c *statusSet) Store(scraper, status, proxy string) {
+	scraper = poolOf(scraper)
 	c.Lock()
 	defer c.Unlock()
-	c.set[scraper][status][proxy] = true
+	c.store(scraper, status, proxy)
+}
+
+// store adds proxy to status of pool if pool has it; the caller holds the lock
+func (c *statusSet) store(pool, status, proxy string) {
+	if proxies, ok := c.set[pool][status]; ok {
+		proxies[proxy] = true
+	}
 }
 
 func (c *statusSet) Delete(scraper, status, proxy string) {
+	scraper = poolOf(scraper)
 	c.Lock()
 	defer c.Unlock()
 	delete(c.set[scraper][status], proxy)
 }
 
 func (c *statusSet) Length(scraper, status string) (length int) {
+	scraper = poolOf(scraper)
 	c.RLock()
 	defer c.RUnlock()
 	length = len(c.set[scraper][status])
@@ -42,6 +53,7 @@ func (c *statusSet) Length(scraper, status string) (length int) {
 }
 
 func (c *statusSet) Range(scraper, status string) (proxyList []string) {
+	scraper = poolOf(scraper)
 	c.RLock()
 	defer c.RUnlock()
 	proxyStatusRange := c.set[scraper][status]
@@ -52,6 +64,7 @@ func (c *statusSet) Range(scraper, status string) (proxyList []string) {
 }
 
 func (c *statusSet) LengthWithProxyRackAffected(scraper, status, proxyType string) int {
+	scraper = poolOf(scraper)
 	c.RLock()
 	copySet := make(map[string]map[string]map[string]bool)
 	for k, v := range c.set {
@@ -105,19 +118,48 @@ func (c *statusSet) ProxyAlreadyDead(scraper, proxy string) bool {
 	return c.Load(scraper, dead, proxy)
 }
 
+func (c *statusSet) ProxyUnchecked(scraper, proxy string) bool {
+	return c.Load(scraper, unchecked, proxy)
+}
+
+func (c *statusSet) ProxyBusy(scraper, proxy string) bool {
+	return c.Load(scraper, busy, proxy)
+}
+
+// status moves proxy to toStatus under one lock, so the status it is moved from is the one replaced
 func (c *statusSet) status(scraper, proxy, toStatus string) {
+	pool := poolOf(scraper)
+	c.Lock()
+	fromStatus := c.statusOf(pool, proxy)
 	var mainStatuses = []string{available, good, postponed, busy, dead, unchecked}
 	for _, status := range mainStatuses {
-		c.Delete(scraper, status, proxy)
+		delete(c.set[pool][status], proxy)
 	}
-	c.Store(scraper, toStatus, proxy)
+	c.store(pool, toStatus, proxy)
 	var statusToAddToAvailable = []string{unchecked, good}
 	if found := find(statusToAddToAvailable, toStatus); found {
-		c.Store(scraper, available, proxy)
+		c.store(pool, available, proxy)
+	}
+	c.Unlock()
+	if fromStatus != toStatus && Events.Active() {
+		Events.Publish(Event{
+			Type: EventStatus, Scraper: pool, Member: memberOf(scraper), Proxy: proxy, From: fromStatus, To: toStatus,
+		})
+	}
+}
+
+// statusOf returns status of proxy in pool, empty if it has none; the caller holds the lock
+func (c *statusSet) statusOf(pool, proxy string) string {
+	for _, status := range []string{good, postponed, busy, dead, unchecked} {
+		if c.set[pool][status][proxy] {
+			return status
+		}
 	}
+	return ""
 }
 
 func (c *statusSet) GetRandomKey(scraper string) (string, error) {
+	scraper = poolOf(scraper)
 	length := c.Length(scraper, available)
 	if length == 0 {
 		return "", errors.New("no proxies")
@@ -135,6 +177,20 @@ func (c *statusSet) GetRandomKey(scraper string) (string, error) {
 	return "", errors.New("no proxies")
 }
 
+// GetRandomKeyWhere finds random available proxy accepted by filter
+func (c *statusSet) GetRandomKeyWhere(scraper string, accept func(proxy string) bool) (string, error) {
+	candidates := make([]string, 0, c.Length(scraper, available))
+	for _, proxy := range c.Range(scraper, available) {
+		if accept(proxy) {
+			candidates = append(candidates, proxy)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", errors.New("no proxies")
+	}
+	return candidates[rand.Intn(len(candidates))], nil
+}
+
 func (c *statusSet) ProxiesExceptDeadSize(scraper string) int {
 	return c.busyPostponedSize(scraper) + c.AvailableSize(scraper)
 }
@@ -143,6 +199,10 @@ func (c *statusSet) busyPostponedSize(scraper string) int {
 	return c.Length(scraper, busy) + c.Length(scraper, postponed)
 }
 
+func (c *statusSet) BusySize(scraper string) int {
+	return c.Length(scraper, busy)
+}
+
 func (c *statusSet) AvailableSize(scraper string) int {
 	return c.Length(scraper, available)
 }
@@ -152,6 +212,11 @@ func (c *statusSet) GetDead(scraper string) (deadProxies []string) {
 	return
 }
 
+func (c *statusSet) GetUnchecked(scraper string) (uncheckedProxies []string) {
+	uncheckedProxies = c.Range(scraper, unchecked)
+	return
+}
+
 func (c *statusSet) GetWorking(scraper string) (workingProxies []string) {
 	workingProxies = append(workingProxies, c.Range(scraper, busy)...)
 	workingProxies = append(workingProxies, c.Range(scraper, postponed)...)
@@ -2,6 +2,8 @@ package db
 
 import (
 	"context"
+	"slices"
+	"sort"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -14,24 +16,41 @@ import (
 
 // Record structure
 type Record struct {
-	Scraper                string  `bson:"scraper"`
-	Proxy                  string  `bson:"proxy"`
-	Status                 string  `bson:"status"`
-	StartGetProxyTime      float64 `bson:"start_get_proxy_time"`
-	NextCheck              float64 `bson:"next_check"`
-	GoodAttempts           int32   `bson:"good_attempts"`
-	FailedAttempts         int32   `bson:"failed_attempts"`
-	DeadState              string  `bson:"dead_state"`
-	LastSuccessfullyUsed   float64 `bson:"last_successfully_used"`
-	NumberOfSuccessfulUses int32   `bson:"number_of_successful_uses"`
-	LastFailureUsed        float64 `bson:"last_failure_used"`
-	NumberOfFailures       int32   `bson:"number_of_failures"`
+	Scraper                string           `bson:"scraper"`
+	Proxy                  string           `bson:"proxy"`
+	Status                 string           `bson:"status"`
+	StartGetProxyTime      float64          `bson:"start_get_proxy_time"`
+	NextCheck              float64          `bson:"next_check"`
+	GoodAttempts           int32            `bson:"good_attempts"`
+	FailedAttempts         int32            `bson:"failed_attempts"`
+	DeadState              string           `bson:"dead_state"`
+	LastSuccessfullyUsed   float64          `bson:"last_successfully_used"`
+	NumberOfSuccessfulUses int32            `bson:"number_of_successful_uses"`
+	LastFailureUsed        float64          `bson:"last_failure_used"`
+	NumberOfFailures       int32            `bson:"number_of_failures"`
+	Latency                float64          `bson:"latency"`
+	LatencySamples         int32            `bson:"latency_samples"`
+	ExitIP                 string           `bson:"exit_ip"`
+	Anonymity              string           `bson:"anonymity"`
+	AnonymityChecked       float64          `bson:"anonymity_checked"`
+	FailureReasons         map[string]int32 `bson:"failure_reasons"`
+	LastBackoff            float64          `bson:"last_backoff"`
+	MemberUsage            map[string]usage `bson:"member_usage"`
+	Domains                []domainRecord   `bson:"domain_health"`
 }
 
 type recordsInMongo map[string]map[string]bool
 
 const expectedSize = 10
 
+// scraperRecord is a scraper registered, removed or renamed in runtime
+type scraperRecord struct {
+	Name    string `bson:"name"`
+	Deleted bool   `bson:"deleted"`
+	// RenamedTo is the new name of deleted scraper if it was renamed
+	RenamedTo string `bson:"renamed_to"`
+}
+
 // Load initial load DB from MongoDB
 func Load() {
 	var records []Record
@@ -40,6 +59,9 @@ func Load() {
 	client := connectToMongo()
 	defer closeMongo(client)
 
+	loadScrapers(client)
+	actionMembers, migratedActions := loadActions(client)
+
 	collection := client.Database(config.MongoDatabase).Collection(config.MongoCollection)
 	cur, err := collection.Find(context.TODO(), filter)
 	if err != nil {
@@ -52,12 +74,37 @@ func Load() {
 		return
 	}
 
+	members := loadRecords(records)
+	for _, member := range actionMembers {
+		if !slices.Contains(members, member) {
+			members = append(members, member)
+		}
+	}
+	migrateMembers(members, migratedActions)
+}
+
+// loadRecords puts records to memory and returns members whose records, kept before they joined a group,
+// were merged into the pool of the group
+func loadRecords(records []Record) (members []string) {
 	counter := 0
+	skipped := 0
+	dropped := make(map[string]int)
+	merged := make(map[string]bool)
 	for recordIndex := range records {
 		record := &records[recordIndex]
-		scraper := record.Scraper
+		// records are kept by proxy pool, that is by group for grouped scrapers
+		scraper := poolOf(record.Scraper)
 		currentProxy := record.Proxy
 
+		if !poolInUse(scraper) {
+			dropped[record.Scraper]++
+			continue
+		}
+		if Actions.Is(scraper, currentProxy, ActionBlock) {
+			skipped++
+			continue
+		}
+
 		if InProxyrack(currentProxy) {
 			if config.UseProxyRack {
 				Set.Store(scraper, isProxyrack, currentProxy)
@@ -66,30 +113,248 @@ func Load() {
 			}
 		}
 
-		status := record.Status
-		if status == "" {
-			status = unchecked
+		proxyInfo := proxyOf(record)
+		if scraper != record.Scraper {
+			// success stats of the record are the member's own
+			proxyInfo.MemberUsage = map[string]usage{record.Scraper: {
+				LastSuccessfullyUsed:   proxyInfo.LastSuccessfullyUsed,
+				NumberOfSuccessfulUses: proxyInfo.NumberOfSuccessfulUses,
+				LastFailureUsed:        proxyInfo.LastFailureUsed,
+				NumberOfFailures:       proxyInfo.NumberOfFailures,
+			}}
+			merged[record.Scraper] = true
 		}
-		localStartGetProxyTime := int64(record.StartGetProxyTime)
-		localNextCheck := int64(record.NextCheck)
-		localLastSuccessfullyUsed := int64(record.LastSuccessfullyUsed)
-		localLastFailureUsed := int64(record.LastFailureUsed)
-		proxyInfo := proxy{
-			Status:                 status,
-			StartGetProxyTime:      localStartGetProxyTime,
-			NextCheck:              localNextCheck,
-			GoodAttempts:           record.GoodAttempts,
-			FailedAttempts:         record.FailedAttempts,
-			LastSuccessfullyUsed:   localLastSuccessfullyUsed,
-			NumberOfSuccessfulUses: record.NumberOfSuccessfulUses,
-			LastFailureUsed:        localLastFailureUsed,
-			NumberOfFailures:       record.NumberOfFailures,
+		Base.RLock()
+		known, ok := Base.base[scraper][currentProxy]
+		Base.RUnlock()
+		if ok {
+			proxyInfo = known.mergedWith(proxyInfo)
 		}
 		Base.Store(scraper, currentProxy, proxyInfo)
-		Set.status(scraper, currentProxy, status)
+		Set.status(scraper, currentProxy, proxyInfo.Status)
 		counter++
 	}
-	log.Info().Int("count", counter).Msg("From MongoDB loaded records")
+	for scraper, count := range dropped {
+		log.Warn().Str("scraper", scraper).Int("count", count).Msg("records of scraper not in use are not loaded")
+	}
+	log.Info().Int("count", counter).Int("skipped", skipped).Msg("From MongoDB loaded records")
+
+	for member := range merged {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
+// proxyOf converts record loaded from MongoDB to proxy kept in memory
+func proxyOf(record *Record) proxy {
+	status := record.Status
+	if status == "" {
+		status = unchecked
+	}
+	return proxy{
+		Status:                 status,
+		StartGetProxyTime:      int64(record.StartGetProxyTime),
+		NextCheck:              int64(record.NextCheck),
+		GoodAttempts:           record.GoodAttempts,
+		FailedAttempts:         record.FailedAttempts,
+		LastSuccessfullyUsed:   int64(record.LastSuccessfullyUsed),
+		NumberOfSuccessfulUses: record.NumberOfSuccessfulUses,
+		LastFailureUsed:        int64(record.LastFailureUsed),
+		NumberOfFailures:       record.NumberOfFailures,
+		Latency:                record.Latency,
+		LatencySamples:         record.LatencySamples,
+		ExitIP:                 record.ExitIP,
+		Anonymity:              record.Anonymity,
+		AnonymityChecked:       int64(record.AnonymityChecked),
+		FailureReasons:         record.FailureReasons,
+		LastBackoff:            int64(record.LastBackoff),
+		MemberUsage:            record.MemberUsage,
+		Domains:                domainsOf(record.Domains),
+	}
+}
+
+// migrateMembers moves records and actions of members merged into pools of their groups in MongoDB,
+// records of members are removed only after the pools are saved with them
+func migrateMembers(members []string, actions []ProxyAction) {
+	if len(members) == 0 && len(actions) == 0 {
+		return
+	}
+	if !save() {
+		log.Warn().Strs("members", members).Msg("records of group members are kept until pools are saved")
+		return
+	}
+	for _, action := range actions {
+		saveAction(action)
+	}
+	for _, member := range members {
+		removeScraperRecords(member)
+	}
+	log.Info().Strs("members", members).Int("actions", len(actions)).Msg("records of group members moved to their pools")
+}
+
+// loadScrapers applies scrapers added and removed in runtime on top of the ones from config
+func loadScrapers(client *mongo.Client) {
+	var scrapers []scraperRecord
+	collection := client.Database(config.MongoDatabase).Collection(config.MongoScrapersCollection)
+	cur, err := collection.Find(context.TODO(), bson.M{})
+	if err != nil {
+		log.Warn().Err(err).Msg("Error on finding scrapers")
+		return
+	}
+	if err = cur.All(context.TODO(), &scrapers); err != nil {
+		log.Warn().Err(err).Msg("Error on grabbing scrapers")
+		return
+	}
+	renames := make(map[string]string)
+	for _, scraper := range scrapers {
+		if scraper.Deleted && scraper.RenamedTo != "" {
+			renames[scraper.Name] = scraper.RenamedTo
+		}
+	}
+	applyRenames(renames)
+	for _, scraper := range scrapers {
+		switch {
+		case scraper.Deleted && scraper.RenamedTo != "":
+		case scraper.Deleted:
+			_, _ = removeScraper(scraper.Name)
+		default:
+			_ = addScraper(scraper.Name)
+		}
+	}
+}
+
+// applyRenames renames scrapers from config again, so they keep overridden settings and groups under new names,
+// renames are applied in chains, scraper renamed to a name taken since then is removed
+func applyRenames(renames map[string]string) {
+	for renamed := true; renamed; {
+		renamed = false
+		for from, to := range renames {
+			if !ScraperExists(from) {
+				continue
+			}
+			if err := renameScraper(from, to); err != nil {
+				_, _ = removeScraper(from)
+			}
+			delete(renames, from)
+			renamed = true
+		}
+	}
+}
+
+// saveScraper remembers scraper added, removed or renamed to renamedTo in runtime
+func saveScraper(scraper string, deleted bool, renamedTo string) {
+	client := connectToMongo()
+	defer closeMongo(client)
+	collection := client.Database(config.MongoDatabase).Collection(config.MongoScrapersCollection)
+	_, err := collection.UpdateOne(context.TODO(),
+		bson.M{"name": scraper},
+		bson.M{"$set": bson.M{"deleted": deleted, "renamed_to": renamedTo}},
+		options.Update().SetUpsert(true))
+	if err != nil {
+		log.Warn().Err(err).Str("scraper", scraper).Msg("Error on saving scraper to MongoDB")
+	}
+}
+
+// removeScraperRecords removes all records and proxy actions of scraper from MongoDB
+func removeScraperRecords(scraper string) {
+	client := connectToMongo()
+	defer closeMongo(client)
+	for _, collectionName := range []string{config.MongoCollection, config.MongoActionsCollection} {
+		collection := client.Database(config.MongoDatabase).Collection(collectionName)
+		if _, err := collection.DeleteMany(context.TODO(), bson.M{"scraper": scraper}); err != nil {
+			log.Warn().Err(err).Str("scraper", scraper).Msg("Error on removing scraper records from MongoDB")
+		}
+	}
+}
+
+// renameScraperRecords moves all records and proxy actions of scraper to its new name in MongoDB
+func renameScraperRecords(from, to string) {
+	client := connectToMongo()
+	defer closeMongo(client)
+	for _, collectionName := range []string{config.MongoCollection, config.MongoActionsCollection} {
+		collection := client.Database(config.MongoDatabase).Collection(collectionName)
+		if _, err := collection.UpdateMany(context.TODO(), bson.M{"scraper": from}, bson.M{"$set": bson.M{"scraper": to}}); err != nil {
+			log.Warn().Err(err).Str("from", from).Str("to", to).Msg("Error on renaming scraper records in MongoDB")
+		}
+	}
+}
+
+// loadActions restores actions taken on proxies by operators, actions of members kept before they joined
+// a group are moved to the pool of the group and returned with the members to migrate them in MongoDB
+func loadActions(client *mongo.Client) (members []string, migrated []ProxyAction) {
+	var actions []ProxyAction
+	collection := client.Database(config.MongoDatabase).Collection(config.MongoActionsCollection)
+	cur, err := collection.Find(context.TODO(), bson.M{})
+	if err != nil {
+		log.Warn().Err(err).Msg("Error on finding proxy actions")
+		return nil, nil
+	}
+	if err = cur.All(context.TODO(), &actions); err != nil {
+		log.Warn().Err(err).Msg("Error on grabbing proxy actions")
+		return nil, nil
+	}
+	members, migrated = applyActions(actions)
+	log.Info().Int("count", len(actions)).Msg("From MongoDB loaded proxy actions")
+	return members, migrated
+}
+
+// applyActions puts actions to memory, the latest action of members on the same proxy is taken for their pool
+func applyActions(actions []ProxyAction) (members []string, migrated []ProxyAction) {
+	dropped := make(map[string]int)
+	for _, action := range actions {
+		if action.Scraper == "" {
+			Actions.store(action)
+			continue
+		}
+		pool := poolOf(action.Scraper)
+		if !poolInUse(pool) {
+			dropped[action.Scraper]++
+			continue
+		}
+		if pool != action.Scraper {
+			if !slices.Contains(members, action.Scraper) {
+				members = append(members, action.Scraper)
+			}
+			action.Scraper = pool
+			Actions.RLock()
+			taken, ok := Actions.byPool[pool][action.Proxy]
+			Actions.RUnlock()
+			if ok && taken.At > action.At {
+				continue
+			}
+			migrated = append(migrated, action)
+		}
+		Actions.store(action)
+	}
+	for scraper, count := range dropped {
+		log.Warn().Str("scraper", scraper).Int("count", count).Msg("proxy actions of scraper not in use are not loaded")
+	}
+	return members, migrated
+}
+
+// saveAction remembers action taken on proxy, it takes place of the previous one
+func saveAction(action ProxyAction) {
+	client := connectToMongo()
+	defer closeMongo(client)
+	collection := client.Database(config.MongoDatabase).Collection(config.MongoActionsCollection)
+	_, err := collection.ReplaceOne(context.TODO(),
+		bson.M{"scraper": action.Scraper, "proxy": action.Proxy},
+		action,
+		options.Replace().SetUpsert(true))
+	if err != nil {
+		log.Warn().Err(err).Str("proxy", action.Proxy).Msg("Error on saving proxy action to MongoDB")
+	}
+}
+
+// removeAction forgets action taken on proxy
+func removeAction(scraper, proxy string) {
+	client := connectToMongo()
+	defer closeMongo(client)
+	collection := client.Database(config.MongoDatabase).Collection(config.MongoActionsCollection)
+	if _, err := collection.DeleteOne(context.TODO(), bson.M{"scraper": scraper, "proxy": proxy}); err != nil {
+		log.Warn().Err(err).Str("proxy", proxy).Msg("Error on removing proxy action from MongoDB")
+	}
 }
 
 func connectToMongo() (client *mongo.Client) {
@@ -143,6 +408,11 @@ func Remove(scraper string, removedList []string) {
 
 // Save to MongoDB
 func Save() {
+	save()
+}
+
+// save writes records of all pools to MongoDB, saved is false if they could not be written
+func save() (saved bool) {
 	log.Info().Msg("Save to Mongo")
 	var records []Record
 	var operations []mongo.WriteModel
@@ -161,13 +431,13 @@ func Save() {
 	cur, err := collection.Find(context.TODO(), filter)
 	if err != nil {
 		log.Warn().Err(err).Msg("Error on finding all the documents")
-		return
+		return false
 	}
 
 	// load all records from mongodb to var records
 	if err = cur.All(context.TODO(), &records); err != nil {
 		log.Warn().Err(err).Msg("Error on grabbing all the documents")
-		return
+		return false
 	}
 
 	if len(records) == 0 {
@@ -196,38 +466,23 @@ func Save() {
 	proxyStatuses := convertSetsToMap()
 	newCounter := 0
 	updateCounter := 0
-	for _, scraper := range config.Scrapers {
-		for proxy, record := range Base.RangeScraper(scraper) {
+	for _, scraper := range pools() {
+		for proxy, record := range Base.rangePool(scraper) {
 			if savedRecords[scraper][proxy] {
 				updateCounter++
 				var updateRecord update
 				updateRecord.filter = bson.M{"scraper": scraper, "proxy": proxy}
-				updateRecord.updates = bson.M{"$set": bson.M{
-					"status":                    proxyStatuses[scraper][proxy],
-					"start_get_proxy_time":      record.StartGetProxyTime,
-					"next_check":                record.NextCheck,
-					"good_attempts":             record.GoodAttempts,
-					"failed_attempts":           record.FailedAttempts,
-					"last_successfully_used":    record.LastSuccessfullyUsed,
-					"number_of_successful_uses": record.NumberOfSuccessfulUses,
-					"last_failure_used":         record.LastFailureUsed,
-					"number_of_failures":        record.NumberOfFailures}}
+				updateRecord.updates = bson.M{
+					"$set": recordFields(proxyStatuses[scraper][proxy], &record),
+					// domains were saved as field names before, they can't be queried there
+					"$unset": bson.M{"domains": ""},
+				}
 				operations = append(operations, mongo.NewUpdateManyModel().SetFilter(updateRecord.filter).SetUpdate(updateRecord.updates))
 			} else {
 				newCounter++
-				var insert = bson.M{
-					"scraper":                   scraper,
-					"proxy":                     proxy,
-					"status":                    proxyStatuses[scraper][proxy],
-					"next_check":                record.NextCheck,
-					"start_get_proxy_time":      record.StartGetProxyTime,
-					"good_attempts":             record.GoodAttempts,
-					"failed_attempts":           record.FailedAttempts,
-					"last_successfully_used":    record.LastSuccessfullyUsed,
-					"number_of_successful_uses": record.NumberOfSuccessfulUses,
-					"last_failure_used":         record.LastFailureUsed,
-					"number_of_failures":        record.NumberOfFailures,
-				}
+				var insert = recordFields(proxyStatuses[scraper][proxy], &record)
+				insert["scraper"] = scraper
+				insert["proxy"] = proxy
 				operations = append(operations, mongo.NewInsertOneModel().SetDocument(insert))
 			}
 		}
@@ -235,21 +490,46 @@ func Save() {
 	res, err := collection.BulkWrite(context.TODO(), operations)
 	if err != nil {
 		log.Warn().Err(err).Msg("Error on saving records to MongoDB")
-		return
+		return false
 	}
 	log.Info().Int64("inserted", res.InsertedCount).Int64("updated", res.ModifiedCount).Msg("MongoDB: insert: updated")
 	log.Info().Int("insert", newCounter).Int("updated", updateCounter).Msg("Inside counters: insert: updated")
+	return true
+}
+
+// recordFields returns fields of proxy record which are saved to MongoDB
+func recordFields(status string, record *proxy) bson.M {
+	return bson.M{
+		"status":                    status,
+		"start_get_proxy_time":      record.StartGetProxyTime,
+		"next_check":                record.NextCheck,
+		"good_attempts":             record.GoodAttempts,
+		"failed_attempts":           record.FailedAttempts,
+		"last_successfully_used":    record.LastSuccessfullyUsed,
+		"number_of_successful_uses": record.NumberOfSuccessfulUses,
+		"last_failure_used":         record.LastFailureUsed,
+		"number_of_failures":        record.NumberOfFailures,
+		"latency":                   record.Latency,
+		"latency_samples":           record.LatencySamples,
+		"exit_ip":                   record.ExitIP,
+		"anonymity":                 record.Anonymity,
+		"anonymity_checked":         record.AnonymityChecked,
+		"failure_reasons":           record.FailureReasons,
+		"last_backoff":              record.LastBackoff,
+		"member_usage":              record.MemberUsage,
+		"domain_health":             domainRecords(record.Domains),
+	}
 }
 
 func getRecordsSavedInMongo(records []Record) (savedRecords recordsInMongo) {
 	savedRecords = make(map[string]map[string]bool)
-	for _, scraper := range config.Scrapers {
-		savedRecords[scraper] = make(map[string]bool)
-	}
 	for recordIndex := range records {
 		record := &records[recordIndex]
 		recordScraper := record.Scraper
 		recordProxy := record.Proxy
+		if _, ok := savedRecords[recordScraper]; !ok {
+			savedRecords[recordScraper] = make(map[string]bool)
+		}
 		savedRecords[recordScraper][recordProxy] = true
 	}
 	return
@@ -258,7 +538,7 @@ func getRecordsSavedInMongo(records []Record) (savedRecords recordsInMongo) {
 func convertSetsToMap() (proxyStatuses map[string]map[string]string) {
 	toMongoStatuses := []string{good, postponed, busy, dead, unchecked}
 	proxyStatuses = make(map[string]map[string]string)
-	for _, scraper := range config.Scrapers {
+	for _, scraper := range pools() {
 		proxyStatuses[scraper] = make(map[string]string)
 		for _, status := range toMongoStatuses {
 			for _, proxy := range Set.Range(scraper, status) {
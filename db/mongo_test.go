@@ -0,0 +1,64 @@
+package db
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+)
+
+func TestLoadRecordsKeptBeforeGroup(t *testing.T) {
+	t.Cleanup(func() { config.Groups = nil })
+	config.Scrapers = []string{"greedy", "modest"}
+	config.Groups = map[string][]string{"shop": {"greedy", "modest"}}
+	config.ProxyrackProxyIP = []string{"9.9.9.9"}
+	Init()
+
+	members, migrated := applyActions([]ProxyAction{
+		{Scraper: "greedy", Proxy: "3.3.3.3:80", Action: ActionPin, At: 10},
+		{Scraper: "modest", Proxy: "3.3.3.3:80", Action: ActionQuarantine, At: 20},
+		{Scraper: "gone", Proxy: "3.3.3.3:80", Action: ActionBlock, At: 30},
+	})
+	if !slices.Equal(members, []string{"greedy", "modest"}) || len(migrated) != 2 {
+		t.Errorf("actions of members %v, migrated %v", members, migrated)
+	}
+	if action, ok := Actions.Of("greedy", "3.3.3.3:80"); !ok || action.Action != ActionQuarantine || action.Scraper != "shop" {
+		t.Errorf("action of pool %+v, want the latest one of its members", action)
+	}
+
+	members = loadRecords([]Record{
+		{Scraper: "greedy", Proxy: "1.1.1.1:80", Status: good, NumberOfSuccessfulUses: 3, LastSuccessfullyUsed: 100,
+			Latency: 100, LatencySamples: 1, FailureReasons: map[string]int32{"timeout": 1}},
+		{Scraper: "modest", Proxy: "1.1.1.1:80", Status: dead, NextCheck: 500, FailedAttempts: 2, NumberOfFailures: 2,
+			Latency: 400, LatencySamples: 3, FailureReasons: map[string]int32{"timeout": 2}},
+		{Scraper: "modest", Proxy: "2.2.2.2:80"},
+		{Scraper: "gone", Proxy: "4.4.4.4:80", Status: good},
+	})
+	if !slices.Equal(members, []string{"greedy", "modest"}) {
+		t.Errorf("merged members %v, want [greedy modest]", members)
+	}
+
+	record, ok := Base.base["shop"]["1.1.1.1:80"]
+	if !ok {
+		t.Fatal("record of member is not in the pool of its group")
+	}
+	if record.Status != dead || record.NextCheck != 500 || record.FailedAttempts != 2 {
+		t.Errorf("status %s next check %d failed %d, want the dead record to win",
+			record.Status, record.NextCheck, record.FailedAttempts)
+	}
+	if record.NumberOfSuccessfulUses != 3 || record.NumberOfFailures != 2 || record.FailureReasons["timeout"] != 3 {
+		t.Errorf("usage stats %+v don't add up", record)
+	}
+	if record.Latency != 325 || record.LatencySamples != 4 {
+		t.Errorf("latency %v of %d samples, want 325 of 4", record.Latency, record.LatencySamples)
+	}
+	if record.MemberUsage["greedy"].NumberOfSuccessfulUses != 3 || record.MemberUsage["modest"].NumberOfFailures != 2 {
+		t.Errorf("member usage %+v, want own stats of every member", record.MemberUsage)
+	}
+	if !Set.ProxyAlreadyDead("greedy", "1.1.1.1:80") || !Set.ProxyUnchecked("modest", "2.2.2.2:80") {
+		t.Error("statuses of merged records are not in the pool")
+	}
+	if Base.Exist("greedy", "4.4.4.4:80") {
+		t.Error("record of scraper not in use loaded")
+	}
+}
@@ -0,0 +1,185 @@
+package db
+
+import (
+	"sync"
+	"time"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+)
+
+const quotaWindow = time.Minute
+
+// quotaUsage is what scraper took from its pool within the last minute, busy keeps proxies
+// a group member holds busy in the pool it shares with other members, reserved counts
+// handouts let through by quota which have not got their proxy yet
+type quotaUsage struct {
+	handouts []time.Time
+	rejected int
+	reserved int
+	busy     map[string]bool
+}
+
+type quotas struct {
+	*sync.Mutex
+	usage map[string]*quotaUsage
+}
+
+// Quotas handouts of proxies counted for scraper quotas, by scraper, not saved to MongoDB
+var Quotas = quotas{Mutex: &sync.Mutex{}, usage: make(map[string]*quotaUsage)}
+
+// Handouts returns how many proxies scraper got within the minute before the given time
+func (q *quotas) Handouts(scraper string, at time.Time) int {
+	q.Lock()
+	defer q.Unlock()
+	usage, ok := q.usage[scraper]
+	if !ok {
+		return 0
+	}
+	usage.prune(at)
+	return len(usage.handouts)
+}
+
+// Reserve counts handout to scraper only if its quota allows it, returns which limit is exceeded
+// if it does not. Check and count are one step, so concurrent handouts can't both pass the quota,
+// handout stays reserved until Settle when scraper got its proxy or Release when there was none
+func (q *quotas) Reserve(scraper string, quota config.Quota, at time.Time) (exceeded string) {
+	q.Lock()
+	defer q.Unlock()
+	usage := q.usageOf(scraper)
+	usage.prune(at)
+	switch {
+	case quota.MaxBusy > 0 && q.busy(scraper)+usage.reserved >= quota.MaxBusy:
+		exceeded = "busy"
+	case quota.MaxPerMinute > 0 && len(usage.handouts) >= quota.MaxPerMinute:
+		exceeded = "per minute"
+	default:
+		usage.handouts = append(usage.handouts, at)
+		usage.reserved++
+		return ""
+	}
+	usage.rejected++
+	return exceeded
+}
+
+// Settle ends reservation of handout which got its proxy, busy proxy is counted by CountBusy from now on
+func (q *quotas) Settle(scraper string) {
+	q.Lock()
+	defer q.Unlock()
+	if usage, ok := q.usage[scraper]; ok && usage.reserved > 0 {
+		usage.reserved--
+	}
+}
+
+// Release gives back reservation of handout made at the given time which found no proxy
+func (q *quotas) Release(scraper string, at time.Time) {
+	q.Lock()
+	defer q.Unlock()
+	usage, ok := q.usage[scraper]
+	if !ok || usage.reserved == 0 {
+		return
+	}
+	usage.reserved--
+	for i := len(usage.handouts) - 1; i >= 0; i-- {
+		if usage.handouts[i].Equal(at) {
+			usage.handouts = append(usage.handouts[:i], usage.handouts[i+1:]...)
+			return
+		}
+	}
+}
+
+// CountBusy remembers proxy made busy by scraper, member of group which held it before has
+// given it back already, for scraper not in group busy proxies are counted in its pool
+func (q *quotas) CountBusy(scraper, proxy string) {
+	pool := poolOf(scraper)
+	if pool == scraper {
+		return
+	}
+	q.Lock()
+	defer q.Unlock()
+	for member, usage := range q.usage {
+		if member != scraper && poolOf(member) == pool {
+			delete(usage.busy, proxy)
+		}
+	}
+	usage := q.usageOf(scraper)
+	if usage.busy == nil {
+		usage.busy = make(map[string]bool)
+	}
+	usage.busy[proxy] = true
+}
+
+// Busy returns how many proxies scraper holds busy, for group member only proxies it took
+// itself and has not given back yet are counted
+func (q *quotas) Busy(scraper string) int {
+	q.Lock()
+	defer q.Unlock()
+	return q.busy(scraper)
+}
+
+func (q *quotas) busy(scraper string) int {
+	if poolOf(scraper) == scraper {
+		return Set.BusySize(scraper)
+	}
+	usage, ok := q.usage[scraper]
+	if !ok {
+		return 0
+	}
+	for proxy := range usage.busy {
+		if !Set.ProxyBusy(scraper, proxy) {
+			delete(usage.busy, proxy)
+		}
+	}
+	return len(usage.busy)
+}
+
+// Rejected returns how many requests of scraper were refused because of its quota
+func (q *quotas) Rejected(scraper string) int {
+	q.Lock()
+	defer q.Unlock()
+	if usage, ok := q.usage[scraper]; ok {
+		return usage.rejected
+	}
+	return 0
+}
+
+func (q *quotas) usageOf(scraper string) *quotaUsage {
+	usage, ok := q.usage[scraper]
+	if !ok {
+		usage = &quotaUsage{}
+		q.usage[scraper] = usage
+	}
+	return usage
+}
+
+func (q *quotas) rename(from, to string) {
+	q.Lock()
+	defer q.Unlock()
+	if usage, ok := q.usage[from]; ok {
+		q.usage[to] = usage
+		delete(q.usage, from)
+	}
+}
+
+func (q *quotas) forget(scraper string) {
+	q.Lock()
+	defer q.Unlock()
+	delete(q.usage, scraper)
+}
+
+func (q *quotas) reset() {
+	q.Lock()
+	defer q.Unlock()
+	q.usage = make(map[string]*quotaUsage)
+}
+
+// prune drops handouts older than a minute before the given time
+func (u *quotaUsage) prune(at time.Time) {
+	kept := 0
+	for _, handout := range u.handouts {
+		if at.Sub(handout) < quotaWindow {
+			u.handouts[kept] = handout
+			kept++
+		}
+	}
+	u.handouts = u.handouts[:kept]
+}
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"sync"
+	"time"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+)
+
+const defaultRateWindow = 60.0
+
+// rateBucket is token bucket of one proxy, tokens are refilled at MaxUses per Window
+type rateBucket struct {
+	tokens      float64
+	refilled    time.Time
+	lastHandout time.Time
+}
+
+type rateLimits struct {
+	*sync.Mutex
+	buckets map[string]map[string]*rateBucket
+}
+
+// RateLimits handouts of proxies counted for rate limiting, by proxy pool, not saved to MongoDB
+var RateLimits = rateLimits{Mutex: &sync.Mutex{}, buckets: make(map[string]map[string]*rateBucket)}
+
+// RateLimited checks if limit restricts anything
+func RateLimited(limit config.RateLimit) bool {
+	return limit.MaxUses > 0 || limit.MinInterval > 0
+}
+
+// Allows checks proxy can be handed out to scraper at the given time without breaking limit
+func (r *rateLimits) Allows(scraper, proxy string, limit config.RateLimit, at time.Time) bool {
+	scraper = poolOf(scraper)
+	r.Lock()
+	defer r.Unlock()
+	return r.allows(scraper, proxy, limit, at)
+}
+
+// Take counts handout of proxy to scraper
+func (r *rateLimits) Take(scraper, proxy string, limit config.RateLimit, at time.Time) {
+	scraper = poolOf(scraper)
+	r.Lock()
+	defer r.Unlock()
+	r.take(scraper, proxy, limit, at)
+}
+
+// TakeIfAllowed counts handout of proxy to scraper only if limit allows it, returns false if it does not.
+// Check and count are one step, so concurrent handouts can't both pass the limit
+func (r *rateLimits) TakeIfAllowed(scraper, proxy string, limit config.RateLimit, at time.Time) bool {
+	scraper = poolOf(scraper)
+	r.Lock()
+	defer r.Unlock()
+	if !r.allows(scraper, proxy, limit, at) {
+		return false
+	}
+	r.take(scraper, proxy, limit, at)
+	return true
+}
+
+func (r *rateLimits) allows(pool, proxy string, limit config.RateLimit, at time.Time) bool {
+	bucket, ok := r.buckets[pool][proxy]
+	if !ok {
+		return true
+	}
+	if limit.MinInterval > 0 && at.Sub(bucket.lastHandout).Seconds() < limit.MinInterval {
+		return false
+	}
+	return limit.MaxUses <= 0 || bucket.refill(limit, at) >= 1
+}
+
+func (r *rateLimits) take(pool, proxy string, limit config.RateLimit, at time.Time) {
+	if _, ok := r.buckets[pool]; !ok {
+		r.buckets[pool] = make(map[string]*rateBucket)
+	}
+	bucket, ok := r.buckets[pool][proxy]
+	if !ok {
+		bucket = &rateBucket{tokens: float64(limit.MaxUses), refilled: at}
+		r.buckets[pool][proxy] = bucket
+	}
+	if limit.MaxUses > 0 {
+		bucket.tokens = bucket.refill(limit, at) - 1
+		bucket.refilled = at
+	}
+	bucket.lastHandout = at
+}
+
+// ThrottledSize counts available proxies of type which can't be handed out to scraper at the given time
+// because of limit
+func (r *rateLimits) ThrottledSize(scraper, proxyType string, limit config.RateLimit, at time.Time) (counter int) {
+	if !RateLimited(limit) {
+		return
+	}
+	for _, proxy := range Set.Range(scraper, available) {
+		if proxyType != proxyTypeAll && Set.Load(scraper, isProxyrack, proxy) != (proxyType == proxyTypeRack) {
+			continue
+		}
+		if !r.Allows(scraper, proxy, limit, at) {
+			counter++
+		}
+	}
+	return
+}
+
+func (r *rateLimits) forget(scraper, proxy string) {
+	scraper = poolOf(scraper)
+	r.Lock()
+	defer r.Unlock()
+	delete(r.buckets[scraper], proxy)
+}
+
+func (r *rateLimits) forgetPool(pool string) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.buckets, pool)
+}
+
+func (r *rateLimits) renamePool(from, to string) {
+	r.Lock()
+	defer r.Unlock()
+	if buckets, ok := r.buckets[from]; ok {
+		r.buckets[to] = buckets
+		delete(r.buckets, from)
+	}
+}
+
+func (r *rateLimits) reset() {
+	r.Lock()
+	defer r.Unlock()
+	r.buckets = make(map[string]map[string]*rateBucket)
+}
+
+// refill returns tokens of bucket at the given time, never more than MaxUses
+func (b *rateBucket) refill(limit config.RateLimit, at time.Time) float64 {
+	window := limit.Window
+	if window <= 0 {
+		window = defaultRateWindow
+	}
+	tokens := b.tokens + at.Sub(b.refilled).Seconds()*float64(limit.MaxUses)/window
+	if tokens > float64(limit.MaxUses) {
+		tokens = float64(limit.MaxUses)
+	}
+	return tokens
+}
@@ -0,0 +1,244 @@
+package db
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+)
+
+var (
+	// ErrUnknownScraper returned for operations on scraper which is not registered
+	ErrUnknownScraper = errors.New("unknown scraper")
+	// ErrScraperExists returned when scraper with the same name is already registered
+	ErrScraperExists = errors.New("scraper already exists")
+)
+
+// scraperRegistry keeps names of registered scrapers in order of registration
+type scraperRegistry struct {
+	*sync.RWMutex
+	names []string
+}
+
+var registry = scraperRegistry{RWMutex: &sync.RWMutex{}}
+
+// sharedPool remembers proxies added to all scrapers, new scrapers start with them
+type sharedPool struct {
+	*sync.RWMutex
+	proxies map[string]bool
+}
+
+var shared = sharedPool{RWMutex: &sync.RWMutex{}, proxies: make(map[string]bool)}
+
+// Scrapers returns names of all registered scrapers
+func Scrapers() []string {
+	registry.RLock()
+	defer registry.RUnlock()
+	return append([]string(nil), registry.names...)
+}
+
+// ScraperExists checks if scraper is registered
+func ScraperExists(scraper string) bool {
+	registry.RLock()
+	defer registry.RUnlock()
+	return registry.index(scraper) >= 0
+}
+
+func (r *scraperRegistry) index(scraper string) int {
+	for i, name := range r.names {
+		if name == scraper {
+			return i
+		}
+	}
+	return -1
+}
+
+// AddScraper registers new scraper with all proxies shared between scrapers and saves it to MongoDB
+func AddScraper(scraper string) error {
+	if err := addScraper(scraper); err != nil {
+		return err
+	}
+	StoreProxies(scraper, shared.list())
+	saveScraper(scraper, false, "")
+	log.Info().Str("scraper", scraper).Msg("scraper added")
+	return nil
+}
+
+// RemoveScraper unregisters scraper, its proxies are removed from memory and MongoDB
+// unless they are still shared by other members of its group
+func RemoveScraper(scraper string) error {
+	removedPool, err := removeScraper(scraper)
+	if err != nil {
+		return err
+	}
+	if removedPool != "" {
+		removeScraperRecords(removedPool)
+	}
+	saveScraper(scraper, true, "")
+	log.Info().Str("scraper", scraper).Msg("scraper removed")
+	return nil
+}
+
+// RenameScraper gives scraper new name keeping its proxies, stats, overridden settings and group,
+// the rename is saved to MongoDB and applied again on start to scrapers from config
+func RenameScraper(from, to string) error {
+	_, grouped := GroupOf(from)
+	if err := renameScraper(from, to); err != nil {
+		return err
+	}
+	if !grouped {
+		renameScraperRecords(from, to)
+	}
+	saveScraper(from, true, to)
+	saveScraper(to, false, "")
+	log.Info().Str("from", from).Str("to", to).Msg("scraper renamed")
+	return nil
+}
+
+// addScraper creates empty maps of new scraper, grouped scraper joins the pool of its group
+func addScraper(scraper string) error {
+	registry.Lock()
+	defer registry.Unlock()
+	if registry.index(scraper) >= 0 {
+		return ErrScraperExists
+	}
+	registry.names = append(registry.names, scraper)
+
+	pool := poolOf(scraper)
+	Base.Lock()
+	if _, ok := Base.base[pool]; !ok {
+		Base.base[pool] = make(map[string]proxy)
+	}
+	Base.Unlock()
+
+	Set.Lock()
+	if _, ok := Set.set[pool]; !ok {
+		Set.set[pool] = make(map[string]map[string]bool)
+		for _, status := range []string{available, good, postponed, busy, dead, unchecked, isProxyrack} {
+			Set.set[pool][status] = make(map[string]bool)
+		}
+	}
+	Set.Unlock()
+
+	statsMu.Lock()
+	SuccessfulGetRandomProxyRequestRate[scraper] = RequestsRate{}
+	statsMu.Unlock()
+	return nil
+}
+
+// removeScraper drops scraper with its maps, removedPool is empty if the pool is still used by other members
+// of scraper group
+func removeScraper(scraper string) (removedPool string, err error) {
+	registry.Lock()
+	position := registry.index(scraper)
+	if position < 0 {
+		registry.Unlock()
+		return "", ErrUnknownScraper
+	}
+	registry.names = append(registry.names[:position], registry.names[position+1:]...)
+	registry.Unlock()
+
+	if pool := poolOf(scraper); !poolInUse(pool) {
+		Base.Lock()
+		delete(Base.base, pool)
+		Base.Unlock()
+
+		Set.Lock()
+		delete(Set.set, pool)
+		Set.Unlock()
+
+		RateLimits.forgetPool(pool)
+		Actions.forgetPool(pool)
+		removedPool = pool
+	}
+
+	statsMu.Lock()
+	delete(GoodPostponeTimeoutsForStats, scraper)
+	delete(ProxySuccessUsageTimeForStats, scraper)
+	delete(TimeStatsForUnavailableProxies, scraper)
+	delete(SuccessfulGetRandomProxyRequestRate, scraper)
+	statsMu.Unlock()
+	Quotas.forget(scraper)
+	Circuits.forget(scraper)
+	return removedPool, nil
+}
+
+func renameScraper(from, to string) error {
+	registry.Lock()
+	defer registry.Unlock()
+	position := registry.index(from)
+	if position < 0 {
+		return ErrUnknownScraper
+	}
+	if registry.index(to) >= 0 {
+		return ErrScraperExists
+	}
+	registry.names[position] = to
+	config.RenameOverrides(from, to)
+
+	if group, ok := GroupOf(from); ok {
+		groups.rename(from, to)
+		Base.renameMember(group, from, to)
+		moveScraperStats(from, to)
+		return nil
+	}
+
+	Base.Lock()
+	Base.base[to] = Base.base[from]
+	delete(Base.base, from)
+	Base.Unlock()
+
+	Set.Lock()
+	Set.set[to] = Set.set[from]
+	delete(Set.set, from)
+	Set.Unlock()
+
+	Actions.renamePool(from, to)
+	RateLimits.renamePool(from, to)
+
+	moveScraperStats(from, to)
+	return nil
+}
+
+func moveScraperStats(from, to string) {
+	statsMu.Lock()
+	defer statsMu.Unlock()
+	GoodPostponeTimeoutsForStats[to] = GoodPostponeTimeoutsForStats[from]
+	ProxySuccessUsageTimeForStats[to] = ProxySuccessUsageTimeForStats[from]
+	TimeStatsForUnavailableProxies[to] = TimeStatsForUnavailableProxies[from]
+	SuccessfulGetRandomProxyRequestRate[to] = SuccessfulGetRandomProxyRequestRate[from]
+	delete(GoodPostponeTimeoutsForStats, from)
+	delete(ProxySuccessUsageTimeForStats, from)
+	delete(TimeStatsForUnavailableProxies, from)
+	delete(SuccessfulGetRandomProxyRequestRate, from)
+	Quotas.rename(from, to)
+	Circuits.rename(from, to)
+}
+
+func (p *sharedPool) add(proxyList []string) {
+	p.Lock()
+	defer p.Unlock()
+	for _, proxy := range proxyList {
+		p.proxies[proxy] = true
+	}
+}
+
+func (p *sharedPool) remove(proxyList []string) {
+	p.Lock()
+	defer p.Unlock()
+	for _, proxy := range proxyList {
+		delete(p.proxies, proxy)
+	}
+}
+
+func (p *sharedPool) list() (proxyList []string) {
+	p.RLock()
+	defer p.RUnlock()
+	proxyList = make([]string, 0, len(p.proxies))
+	for proxy := range p.proxies {
+		proxyList = append(proxyList, proxy)
+	}
+	return
+}
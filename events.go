@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+	"github.com/AlexeyYurko/go-pmserver/db"
+)
+
+const (
+	eventsKeepAlive    = 30 * time.Second
+	eventsWriteTimeout = 10 * time.Second
+	// eventDropped tells subscriber how many events it missed being too slow
+	eventDropped = "dropped"
+)
+
+var errOriginNotAllowed = errors.New("origin not allowed")
+
+// eventFilterOf reads comma separated scraper and type of events request, writing 403 or 404 response if they are wrong
+func eventFilterOf(context *gin.Context) (filter db.EventFilter, ok bool) {
+	for _, scraper := range splitList(context.Query("scraper")) {
+		if !scraperRegistered(context, scraper, false) {
+			return filter, false
+		}
+
+		filter.Scrapers = append(filter.Scrapers, scraper)
+	}
+
+	for _, eventType := range splitList(context.Query("type")) {
+		if !slices.Contains(db.EventTypes, eventType) {
+			context.String(http.StatusForbidden, "Field type should be one of "+strings.Join(db.EventTypes, ", "))
+
+			return filter, false
+		}
+
+		filter.Types = append(filter.Types, eventType)
+	}
+
+	return filter, true
+}
+
+func splitList(list string) (items []string) {
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// routeEvents streams events as server-sent events named by event type, filtered by scraper and type
+func routeEvents(context *gin.Context) {
+	filter, ok := eventFilterOf(context)
+	if !ok {
+		return
+	}
+
+	subscription := db.Events.Subscribe(filter)
+	defer db.Events.Cancel(subscription)
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	context.Header("Content-Type", "text/event-stream")
+	context.Header("Cache-Control", "no-cache")
+	context.Header("X-Accel-Buffering", "no")
+	// headers go out at once so the client knows it is subscribed before the first event
+	context.Writer.WriteHeaderNow()
+	context.Writer.Flush()
+	context.Stream(func(io.Writer) bool {
+		select {
+		case event := <-subscription.C:
+			if dropped := subscription.Dropped(); dropped > 0 {
+				context.SSEvent(eventDropped, gin.H{"count": dropped})
+			}
+
+			context.SSEvent(event.Type, event)
+
+			return true
+		case <-keepAlive.C:
+			_, err := context.Writer.WriteString(": keep-alive\n\n")
+
+			return err == nil
+		case <-context.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// routeEventsWebSocket streams events as json messages over WebSocket, filtered by scraper and type
+func routeEventsWebSocket(context *gin.Context) {
+	filter, ok := eventFilterOf(context)
+	if !ok {
+		return
+	}
+
+	server := websocket.Server{
+		Handshake: func(_ *websocket.Config, request *http.Request) error {
+			if !originAllowed(request) {
+				return errOriginNotAllowed
+			}
+
+			return nil
+		},
+		Handler: func(conn *websocket.Conn) {
+			streamEvents(conn, filter)
+		},
+	}
+	server.ServeHTTP(context.Writer, context.Request)
+}
+
+// originAllowed checks page opening WebSocket is pmserver own or allowed in config,
+// clients which are not browsers send no origin
+func originAllowed(request *http.Request) bool {
+	origin := request.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	if slices.Contains(config.EventsAllowedOrigins, "*") || slices.Contains(config.EventsAllowedOrigins, origin) {
+		return true
+	}
+
+	originURL, err := url.Parse(origin)
+
+	return err == nil && strings.EqualFold(originURL.Host, request.Host)
+}
+
+func streamEvents(conn *websocket.Conn, filter db.EventFilter) {
+	subscription := db.Events.Subscribe(filter)
+	defer db.Events.Cancel(subscription)
+
+	// nothing is expected from the client, reading only finds out it has gone
+	closed := make(chan struct{})
+
+	go func() {
+		_, _ = io.Copy(io.Discard, conn)
+
+		close(closed)
+	}()
+
+	for {
+		select {
+		case event := <-subscription.C:
+			if err := conn.SetWriteDeadline(time.Now().Add(eventsWriteTimeout)); err != nil {
+				return
+			}
+
+			if dropped := subscription.Dropped(); dropped > 0 {
+				if err := websocket.JSON.Send(conn, gin.H{"type": eventDropped, "count": dropped}); err != nil {
+					return
+				}
+			}
+
+			if err := websocket.JSON.Send(conn, event); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
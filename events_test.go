@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+)
+
+func TestEventsWebSocketOrigin(t *testing.T) {
+	allowed := config.EventsAllowedOrigins
+	t.Cleanup(func() { config.EventsAllowedOrigins = allowed })
+
+	tests := []struct {
+		name    string
+		origin  string
+		allowed []string
+		want    bool
+	}{
+		{name: "no origin", want: true},
+		{name: "pmserver own page", origin: "http://pmserver.test:5000", want: true},
+		{name: "other page", origin: "https://evil.test"},
+		{name: "listed page", origin: "https://grafana.test", allowed: []string{"https://grafana.test"}, want: true},
+		{name: "page not listed", origin: "https://evil.test", allowed: []string{"https://grafana.test"}},
+		{name: "any page", origin: "https://evil.test", allowed: []string{"*"}, want: true},
+		{name: "unreadable origin", origin: "://", want: false},
+	}
+	for _, tt := range tests {
+		config.EventsAllowedOrigins = tt.allowed
+		request := httptest.NewRequest(http.MethodGet, "http://pmserver.test:5000/events/ws", nil)
+		if tt.origin != "" {
+			request.Header.Set("Origin", tt.origin)
+		}
+		if got := originAllowed(request); got != tt.want {
+			t.Errorf("%s: originAllowed = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
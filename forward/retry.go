@@ -0,0 +1,93 @@
+package forward
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AlexeyYurko/go-pmserver/manager"
+)
+
+const (
+	// RetriesHeader of client request asks for number of retries, up to MaxRetries
+	RetriesHeader = "X-Pmserver-Retries"
+	// ProxyHeader of answer names proxy which finally served the request
+	ProxyHeader = "X-Pmserver-Proxy"
+	// maxReplayableBody is the biggest request body kept in memory to be sent again
+	maxReplayableBody = 1 << 20
+)
+
+// retriesFor returns retries for request, asked in RetriesHeader or configured
+func (s *Server) retriesFor(r *http.Request) int {
+	retries := s.Retries
+	if asked := r.Header.Get(RetriesHeader); asked != "" {
+		if value, err := strconv.Atoi(asked); err == nil && value >= 0 {
+			retries = min(value, s.MaxRetries)
+		}
+	}
+	return retries
+}
+
+// connect dials target through proxy of scraper trying other proxies on failure,
+// proxy is empty if there was no proxy to try
+func (s *Server) connect(scraper, sessionKey, target string, retries int) (conn net.Conn, proxy string, err error) {
+	domain := targetDomain(target)
+	var tried []string
+	for attempt := 0; ; attempt++ {
+		picked, pickErr := s.sessions.pick(scraper, sessionKey, domain, tried)
+		if pickErr != nil {
+			if proxy == "" {
+				return nil, "", pickErr
+			}
+			// keep the error of the last proxy tried
+			return nil, proxy, err
+		}
+		proxy = picked
+		tried = append(tried, proxy)
+
+		started := time.Now()
+		conn, err = s.dialThrough(proxy, target)
+		s.report(scraper, proxy, domain, s.judge(domain, nil, err), started)
+		if err == nil || attempt >= retries {
+			return conn, proxy, err
+		}
+	}
+}
+
+// targetDomain is domain of host:port or host
+func targetDomain(target string) string {
+	host, _, err := net.SplitHostPort(target)
+	if err != nil {
+		host = target
+	}
+	return manager.NormalizeDomain(host)
+}
+
+// idempotent checks if request with method can be sent twice with the same effect
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// replayable reads request body into memory so request can be sent again, false if the body is too big
+func replayable(r *http.Request) bool {
+	if r.Body == nil || r.Body == http.NoBody {
+		return true
+	}
+	buffered, err := io.ReadAll(io.LimitReader(r.Body, maxReplayableBody+1))
+	if err != nil || len(buffered) > maxReplayableBody {
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(buffered), r.Body))
+		return false
+	}
+	r.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buffered)), nil
+	}
+	r.Body, _ = r.GetBody()
+	return true
+}
@@ -0,0 +1,57 @@
+package forward
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+	"github.com/AlexeyYurko/go-pmserver/db"
+)
+
+// proxyRequest is request of client sent to forward proxy as username
+func proxyRequest(target, username string) *http.Request {
+	request := httptest.NewRequest(http.MethodGet, target, nil)
+	request.Header.Set("Proxy-Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(username+":")))
+	return request
+}
+
+// banningProxy answers every request sent through it with 403 and counts them
+func banningProxy(t *testing.T, requests *atomic.Int32) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	t.Cleanup(server.Close)
+	return server.Listener.Addr().String()
+}
+
+func TestRetriesSkipTriedProxies(t *testing.T) {
+	config.Scrapers = []string{"shop"}
+	config.ProxyrackProxyIP = []string{"9.9.9.9"}
+	db.Init()
+	var first, second atomic.Int32
+	db.StoreProxies("", []string{banningProxy(t, &first), banningProxy(t, &second)})
+
+	s := New("", "", time.Second)
+	s.MaxRetries = 5
+	request := proxyRequest("http://target.test/", "shop")
+	request.Header.Set(RetriesHeader, strconv.Itoa(s.MaxRetries))
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, request)
+
+	if first.Load() != 1 || second.Load() != 1 {
+		t.Errorf("proxies got %d and %d requests, want one each", first.Load(), second.Load())
+	}
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("status %d, want answer of the last proxy %d", recorder.Code, http.StatusForbidden)
+	}
+	if recorder.Header().Get(ProxyHeader) == "" {
+		t.Errorf("no %s header", ProxyHeader)
+	}
+}
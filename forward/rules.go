@@ -0,0 +1,241 @@
+package forward
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/AlexeyYurko/go-pmserver/checker"
+	"github.com/AlexeyYurko/go-pmserver/config"
+	"github.com/AlexeyYurko/go-pmserver/manager"
+)
+
+// Verdicts on requests sent through proxy
+const (
+	// VerdictSuccess counts a good attempt
+	VerdictSuccess = "success"
+	// VerdictSoftFail marks proxy dead on the target domain only
+	VerdictSoftFail = "soft-fail"
+	// VerdictBan marks proxy dead
+	VerdictBan = "ban"
+)
+
+const defaultBodyScanSize = 64 << 10
+
+// outcome of request sent through proxy
+type outcome struct {
+	verdict string
+	reason  string
+	// rule which gave the verdict, empty for default classification
+	rule string
+}
+
+// Rule classifies answer got through proxy, every condition given has to match,
+// rules never see what goes through CONNECT tunnels and SOCKS5 connections
+type Rule struct {
+	Name        string
+	Domains     []string
+	StatusCodes []int
+	Headers     map[string]*regexp.Regexp
+	Body        *regexp.Regexp
+	Verdict     string
+	Reason      string
+}
+
+// NewRules checks and compiles rules from config
+func NewRules(configured []config.ResponseRule) ([]Rule, error) {
+	rules := make([]Rule, 0, len(configured))
+	for position, rule := range configured {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", position+1)
+		}
+		compiled := Rule{Name: name, StatusCodes: rule.StatusCodes, Verdict: rule.Verdict, Reason: rule.Reason}
+
+		switch rule.Verdict {
+		case VerdictSuccess:
+		case VerdictSoftFail:
+			if compiled.Reason == "" {
+				compiled.Reason = manager.ReasonCustom
+			}
+		case VerdictBan:
+			if compiled.Reason == "" {
+				compiled.Reason = manager.ReasonBanned
+			}
+		default:
+			return nil, fmt.Errorf("rule %s: verdict should be success, soft-fail or ban", name)
+		}
+		if !manager.ValidReason(compiled.Reason) {
+			return nil, fmt.Errorf("rule %s: unknown reason %s", name, compiled.Reason)
+		}
+
+		for _, domain := range rule.Domains {
+			compiled.Domains = append(compiled.Domains, manager.NormalizeDomain(domain))
+		}
+		if len(rule.Headers) > 0 {
+			compiled.Headers = make(map[string]*regexp.Regexp, len(rule.Headers))
+			for header, pattern := range rule.Headers {
+				expression, err := regexp.Compile(pattern)
+				if err != nil {
+					return nil, fmt.Errorf("rule %s: header %s: %w", name, header, err)
+				}
+				compiled.Headers[http.CanonicalHeaderKey(header)] = expression
+			}
+		}
+		if rule.Body != "" {
+			expression, err := regexp.Compile(rule.Body)
+			if err != nil {
+				return nil, fmt.Errorf("rule %s: body: %w", name, err)
+			}
+			compiled.Body = expression
+		}
+		rules = append(rules, compiled)
+	}
+	return rules, nil
+}
+
+// appliesTo checks if rule is for domain or its parent domain
+func (r *Rule) appliesTo(domain string) bool {
+	if len(r.Domains) == 0 {
+		return true
+	}
+	for _, ruleDomain := range r.Domains {
+		if domain == ruleDomain || strings.HasSuffix(domain, "."+ruleDomain) {
+			return true
+		}
+	}
+	return false
+}
+
+// matches checks answer against every condition of the rule, body is the scanned beginning of answer body
+func (r *Rule) matches(response *http.Response, body []byte) bool {
+	if len(r.StatusCodes) > 0 && !slices.Contains(r.StatusCodes, response.StatusCode) {
+		return false
+	}
+	for header, expression := range r.Headers {
+		values, ok := response.Header[header]
+		if !ok || !slices.ContainsFunc(values, expression.MatchString) {
+			return false
+		}
+	}
+	return r.Body == nil || r.Body.Match(body)
+}
+
+// judge classifies result of request to domain sent through proxy, answer body stays readable from the start
+func (s *Server) judge(domain string, response *http.Response, err error) outcome {
+	if errors.Is(err, errUnusableUpstream) {
+		return outcome{verdict: verdictUnusable}
+	}
+	if err != nil {
+		return outcome{verdict: VerdictBan, reason: checker.FailureReason(err)}
+	}
+	if response == nil {
+		return outcome{verdict: VerdictSuccess}
+	}
+
+	var body []byte
+	for i := range s.Rules {
+		rule := &s.Rules[i]
+		if !rule.appliesTo(domain) {
+			continue
+		}
+		if rule.Body != nil && body == nil {
+			body = decodeBody(response.Header.Get("Content-Encoding"), scanBody(response, s.BodyScanSize), s.BodyScanSize)
+		}
+		if rule.matches(response, body) {
+			return outcome{verdict: rule.Verdict, reason: rule.Reason, rule: rule.Name}
+		}
+	}
+
+	switch {
+	case slices.Contains(s.BanStatusCodes, response.StatusCode):
+		return outcome{verdict: VerdictBan, reason: manager.ReasonBanned}
+	case proxyError(response.StatusCode):
+		return outcome{verdict: VerdictBan, reason: manager.ReasonHTTP5xx}
+	}
+	return outcome{verdict: VerdictSuccess}
+}
+
+// scanBody reads up to size bytes of answer body and puts them back in front of the rest
+func scanBody(response *http.Response, size int) []byte {
+	if size <= 0 {
+		size = defaultBodyScanSize
+	}
+	body, _ := io.ReadAll(io.LimitReader(response.Body, int64(size)))
+	response.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(body), response.Body), Closer: response.Body}
+	// an empty body is scanned too, so it is never read again
+	if body == nil {
+		body = []byte{}
+	}
+	return body
+}
+
+// decodeBody decompresses scanned beginning of body sent with encoding, up to size bytes,
+// body in encoding which can't be decompressed is matched as is
+func decodeBody(encoding string, body []byte, size int) []byte {
+	if size <= 0 {
+		size = defaultBodyScanSize
+	}
+	var decoder io.Reader
+	var err error
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "gzip", "x-gzip":
+		decoder, err = gzip.NewReader(bytes.NewReader(body))
+	case "deflate":
+		// deflate answers are usually zlib streams, some servers send raw deflate
+		if decoder, err = zlib.NewReader(bytes.NewReader(body)); err != nil {
+			decoder, err = flate.NewReader(bytes.NewReader(body)), nil
+		}
+	default:
+		return body
+	}
+	if err != nil {
+		return body
+	}
+	// only the beginning of the stream was scanned, so it ends unexpectedly, what was decoded is kept
+	decoded, _ := io.ReadAll(io.LimitReader(decoder, int64(size)))
+	if decoded == nil {
+		decoded = []byte{}
+	}
+	return decoded
+}
+
+// scansBodies checks if any rule has body condition
+func (s *Server) scansBodies() bool {
+	return slices.ContainsFunc(s.Rules, func(rule Rule) bool {
+		return rule.Body != nil
+	})
+}
+
+// limitAcceptEncoding leaves in Accept-Encoding of request only encodings decodeBody can decompress,
+// without any of them the answer comes not compressed
+func limitAcceptEncoding(header http.Header) {
+	var kept []string
+	for _, value := range header.Values("Accept-Encoding") {
+		for _, coding := range strings.Split(value, ",") {
+			name, _, _ := strings.Cut(coding, ";")
+			switch strings.ToLower(strings.TrimSpace(name)) {
+			case "gzip", "x-gzip", "deflate", "identity":
+				kept = append(kept, strings.TrimSpace(coding))
+			}
+		}
+	}
+	header.Del("Accept-Encoding")
+	if len(kept) > 0 {
+		header.Set("Accept-Encoding", strings.Join(kept, ", "))
+	}
+}
+
+// readCloser reads from Reader and closes Closer
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,120 @@
+package forward
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+)
+
+const captcha = "<html><title>Are you a robot?</title>" +
+	"<body>please solve the captcha to continue</body></html>"
+
+func compressed(t *testing.T, encoding, content string) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	var writer io.WriteCloser
+	switch encoding {
+	case "gzip":
+		writer = gzip.NewWriter(&buffer)
+	case "zlib":
+		writer = zlib.NewWriter(&buffer)
+	case "flate":
+		writer, _ = flate.NewWriter(&buffer, flate.DefaultCompression)
+	}
+	if _, err := io.WriteString(writer, content); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
+
+func TestDecodeBody(t *testing.T) {
+	gzipped := compressed(t, "gzip", captcha)
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		size     int
+		want     string
+	}{
+		{name: "not compressed", body: []byte(captcha), want: captcha},
+		{name: "gzip", encoding: "gzip", body: gzipped, want: captcha},
+		{name: "x-gzip", encoding: "X-Gzip", body: gzipped, want: captcha},
+		{name: "zlib deflate", encoding: "deflate", body: compressed(t, "zlib", captcha), want: captcha},
+		{name: "raw deflate", encoding: "deflate", body: compressed(t, "flate", captcha), want: captcha},
+		{name: "decoded up to size", encoding: "gzip", body: gzipped, size: 10, want: captcha[:10]},
+		{name: "brotli is left as is", encoding: "br", body: []byte("\x1b\x03"), want: "\x1b\x03"},
+		{name: "broken gzip is left as is", encoding: "gzip", body: []byte("plain"), want: "plain"},
+	}
+	for _, tt := range tests {
+		if got := decodeBody(tt.encoding, tt.body, tt.size); string(got) != tt.want {
+			t.Errorf("%s: decoded %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// scanned beginning of a long gzip stream is decoded as far as it goes
+	long := strings.Repeat("filler ", 20000) + captcha
+	prefix := compressed(t, "gzip", long)[:256]
+	if got := decodeBody("gzip", prefix, defaultBodyScanSize); len(got) == 0 || !strings.HasPrefix(long, string(got)) {
+		t.Errorf("decoded prefix of %d bytes is not the beginning of the body", len(got))
+	}
+}
+
+func TestLimitAcceptEncoding(t *testing.T) {
+	tests := []struct {
+		values []string
+		want   string
+	}{
+		{values: []string{"gzip, deflate, br"}, want: "gzip, deflate"},
+		{values: []string{"br;q=1.0, gzip;q=0.8, *;q=0.1"}, want: "gzip;q=0.8"},
+		{values: []string{"zstd", "identity"}, want: "identity"},
+		{values: []string{"br"}},
+		{},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		for _, value := range tt.values {
+			header.Add("Accept-Encoding", value)
+		}
+		limitAcceptEncoding(header)
+		if got := strings.Join(header.Values("Accept-Encoding"), "|"); got != tt.want {
+			t.Errorf("Accept-Encoding %q became %q, want %q", tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestBodyRuleMatchesCompressedAnswer(t *testing.T) {
+	rules, err := NewRules([]config.ResponseRule{{Name: "captcha", Body: "solve the captcha", Verdict: VerdictBan}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New("", "", time.Second)
+	s.Rules = rules
+	if !s.scansBodies() {
+		t.Fatal("server with body rule does not scan bodies")
+	}
+
+	gzipped := compressed(t, "gzip", captcha)
+	response := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Encoding": {"gzip"}},
+		Body:       io.NopCloser(bytes.NewReader(gzipped)),
+	}
+	if result := s.judge("shop.test", response, nil); result.verdict != VerdictBan || result.rule != "captcha" {
+		t.Errorf("judged %+v, want ban by captcha rule", result)
+	}
+	// client still gets the answer as it came
+	if body, _ := io.ReadAll(response.Body); !bytes.Equal(body, gzipped) {
+		t.Error("answer body changed by scanning")
+	}
+}
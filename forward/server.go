@@ -0,0 +1,340 @@
+package forward
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+	"github.com/AlexeyYurko/go-pmserver/db"
+	"github.com/AlexeyYurko/go-pmserver/manager"
+)
+
+const (
+	defaultDialTimeout = 10 * time.Second
+	defaultMaxRetries  = 3
+	realm              = `Basic realm="pmserver"`
+)
+
+// hopHeaders are meaningful only for a single connection and are not forwarded
+var hopHeaders = []string{
+	"Connection",
+	"Proxy-Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Server is forward proxy routing every request through a pool proxy of the scraper named in proxy auth username
+type Server struct {
+	Listen string
+	// Password clients have to give, empty for no password
+	Password    string
+	DialTimeout time.Duration
+	// BanStatusCodes upstream answers marking the proxy dead as banned
+	BanStatusCodes []int
+	// SOCKSListen address of SOCKS5 front end, empty to not listen
+	SOCKSListen string
+	// Retries times failed request is sent again through another proxy
+	Retries int
+	// MaxRetries limit for retries asked by client with RetriesHeader
+	MaxRetries int
+	// Rules classify answers, the first matching rule wins, BanStatusCodes apply if none matches
+	Rules []Rule
+	// BodyScanSize bytes of answer body checked by rules
+	BodyScanSize int
+
+	sessions *sessions
+}
+
+// New creates forward proxy listening on address
+func New(listen, password string, dialTimeout time.Duration) *Server {
+	if dialTimeout <= 0 {
+		dialTimeout = defaultDialTimeout
+	}
+	return &Server{
+		Listen:         listen,
+		Password:       password,
+		DialTimeout:    dialTimeout,
+		BanStatusCodes: []int{http.StatusForbidden, http.StatusTooManyRequests},
+		MaxRetries:     defaultMaxRetries,
+		BodyScanSize:   defaultBodyScanSize,
+		sessions:       newSessions(defaultSessionTTL),
+	}
+}
+
+// NewFromConfig creates forward proxy with settings from config.yml
+func NewFromConfig() (*Server, error) {
+	rules, err := NewRules(config.ForwardProxyRules)
+	if err != nil {
+		return nil, err
+	}
+	s := New(config.ForwardProxyListen, config.ForwardProxyPassword,
+		time.Duration(config.ForwardProxyDialTimeout)*time.Second)
+	if len(config.ForwardProxyBanStatusCodes) > 0 {
+		s.BanStatusCodes = config.ForwardProxyBanStatusCodes
+	}
+	s.SOCKSListen = config.ForwardProxySOCKSListen
+	s.Retries = config.ForwardProxyRetries
+	if config.ForwardProxyMaxRetries > 0 {
+		s.MaxRetries = config.ForwardProxyMaxRetries
+	}
+	s.Rules = rules
+	if config.ForwardProxyBodyScanSize > 0 {
+		s.BodyScanSize = config.ForwardProxyBodyScanSize << 10
+	}
+	s.sessions = newSessions(time.Duration(config.ForwardProxySessionTTL) * time.Second)
+	return s, nil
+}
+
+// ListenAndServe accepts client connections until the listener fails
+func (s *Server) ListenAndServe() error {
+	log.Info().Str("listen", s.Listen).Msg("Forward proxy started")
+	server := &http.Server{
+		Addr:              s.Listen,
+		Handler:           s,
+		ReadHeaderTimeout: s.DialTimeout,
+	}
+	return server.ListenAndServe()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	username, ok := s.authenticate(r)
+	if !ok {
+		w.Header().Set("Proxy-Authenticate", realm)
+		http.Error(w, "Proxy authentication required, scraper is the username", http.StatusProxyAuthRequired)
+		return
+	}
+	scraper, sessionKey := parseUsername(username)
+	if !db.ScraperExists(scraper) {
+		http.Error(w, "Unknown scraper "+scraper, http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodConnect {
+		s.tunnel(w, r, scraper, sessionKey)
+		return
+	}
+	s.forward(w, r, scraper, sessionKey)
+}
+
+// authenticate finds username in Proxy-Authorization header checking the password
+func (s *Server) authenticate(r *http.Request) (username string, ok bool) {
+	header := r.Header.Get("Proxy-Authorization")
+	encoded, found := strings.CutPrefix(header, "Basic ")
+	if !found {
+		return "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", false
+	}
+	username, password, _ := strings.Cut(string(decoded), ":")
+	return username, s.allowed(username, password)
+}
+
+// allowed checks credentials given by client
+func (s *Server) allowed(username, password string) bool {
+	return username != "" && (s.Password == "" || password == s.Password)
+}
+
+// tunnel connects client to target of CONNECT request through pool proxy
+func (s *Server) tunnel(w http.ResponseWriter, r *http.Request, scraper, sessionKey string) {
+	upstream, proxy, err := s.connect(scraper, sessionKey, r.Host, s.retriesFor(r))
+	if proxy == "" {
+		writeNoProxy(w, err)
+		return
+	}
+	if err != nil {
+		w.Header().Set(ProxyHeader, proxy)
+		http.Error(w, "Can't connect through proxy", http.StatusBadGateway)
+		return
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		upstream.Close()
+		http.Error(w, "Tunnelling is not supported", http.StatusInternalServerError)
+		return
+	}
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		upstream.Close()
+		log.Warn().Err(err).Msg("Error on taking over client connection")
+		return
+	}
+	established := "HTTP/1.1 200 Connection established\r\n" + ProxyHeader + ": " + proxy + "\r\n\r\n"
+	if _, err = client.Write([]byte(established)); err != nil {
+		client.Close()
+		upstream.Close()
+		return
+	}
+	// client could send something right after CONNECT, it is already read into the buffer
+	if buffered.Reader.Buffered() > 0 {
+		if _, err = io.CopyN(upstream, buffered, int64(buffered.Reader.Buffered())); err != nil {
+			client.Close()
+			upstream.Close()
+			return
+		}
+	}
+	pipe(client, upstream)
+}
+
+// forward sends plain HTTP request through pool proxy and copies the answer to client,
+// idempotent request judged as failed is sent again through another proxy while there are retries left
+func (s *Server) forward(w http.ResponseWriter, r *http.Request, scraper, sessionKey string) {
+	retries := s.retriesFor(r)
+	if retries > 0 && !(idempotent(r.Method) && replayable(r)) {
+		retries = 0
+	}
+	if !r.URL.IsAbs() || r.URL.Host == "" {
+		http.Error(w, "Absolute URL with host is required", http.StatusBadRequest)
+		return
+	}
+	r.Header.Del(RetriesHeader)
+	domain := targetDomain(r.URL.Host)
+
+	var tried []string
+	// answer of the last failed attempt goes to client if there is no other proxy to retry through
+	var lastResponse *http.Response
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		proxy, err := s.sessions.pick(scraper, sessionKey, domain, tried)
+		if err != nil {
+			if len(tried) == 0 {
+				writeNoProxy(w, err)
+				return
+			}
+			answer(w, tried[len(tried)-1], lastResponse, lastErr)
+			return
+		}
+		tried = append(tried, proxy)
+		if lastResponse != nil {
+			lastResponse.Body.Close()
+			lastResponse = nil
+		}
+
+		started := time.Now()
+		response, err := s.roundTrip(r, proxy)
+		result := outcome{verdict: verdictCanceled}
+		if !canceled(r, err) {
+			result = s.judge(domain, response, err)
+		}
+		s.report(scraper, proxy, domain, result, started)
+		if result.verdict == verdictCanceled {
+			if response != nil {
+				response.Body.Close()
+			}
+			return
+		}
+		if attempt < retries && result.verdict != VerdictSuccess {
+			lastResponse, lastErr = response, err
+			log.Debug().Err(err).Str("reason", result.reason).Str("proxy", proxy).Msg("retrying request through another proxy")
+			continue
+		}
+		answer(w, proxy, response, err)
+		return
+	}
+}
+
+// answer sends client what came through proxy, error is answered as bad gateway
+func answer(w http.ResponseWriter, proxy string, response *http.Response, err error) {
+	w.Header().Set(ProxyHeader, proxy)
+	if err != nil {
+		http.Error(w, "Can't send request through proxy", http.StatusBadGateway)
+		return
+	}
+	copyResponse(w, response)
+}
+
+// roundTrip sends request through proxy, answer body has to be closed
+func (s *Server) roundTrip(r *http.Request, proxy string) (*http.Response, error) {
+	proxyURL, err := upstreamURL(proxy)
+	if err != nil {
+		return nil, err
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyURL(proxyURL),
+		DialContext:           (&net.Dialer{Timeout: s.DialTimeout}).DialContext,
+		ResponseHeaderTimeout: s.DialTimeout,
+		DisableKeepAlives:     true,
+	}
+
+	outgoing := r.Clone(r.Context())
+	outgoing.RequestURI = ""
+	if r.GetBody != nil {
+		if outgoing.Body, err = r.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	removeHopHeaders(outgoing.Header)
+	if s.scansBodies() {
+		// body rules have to read the answer, it can't come in encoding they can't decompress
+		limitAcceptEncoding(outgoing.Header)
+	}
+
+	// keep-alives are off, so the connection is closed once the body is read
+	return transport.RoundTrip(outgoing)
+}
+
+// copyResponse sends answer got through proxy to client
+func copyResponse(w http.ResponseWriter, response *http.Response) {
+	defer response.Body.Close()
+	removeHopHeaders(response.Header)
+	for name, values := range response.Header {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	w.WriteHeader(response.StatusCode)
+	_, _ = io.Copy(w, response.Body)
+}
+
+// writeNoProxy answers client when there is no proxy to route its request through
+func writeNoProxy(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, manager.ErrQuotaExceeded):
+		http.Error(w, "Quota exceeded", http.StatusTooManyRequests)
+	case errors.Is(err, manager.ErrCircuitOpen):
+		http.Error(w, "Circuit open", http.StatusServiceUnavailable)
+	default:
+		http.Error(w, "No proxies available", http.StatusServiceUnavailable)
+	}
+}
+
+func removeHopHeaders(header http.Header) {
+	for _, name := range strings.Split(header.Get("Connection"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			header.Del(name)
+		}
+	}
+	for _, name := range hopHeaders {
+		header.Del(name)
+	}
+}
+
+// pipe copies data both ways until one of connections is closed
+func pipe(client, upstream net.Conn) {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	copyAndClose := func(to, from net.Conn) {
+		defer wg.Done()
+		_, _ = io.Copy(to, from)
+		to.Close()
+		from.Close()
+	}
+	go copyAndClose(upstream, client)
+	go copyAndClose(client, upstream)
+	wg.Wait()
+}
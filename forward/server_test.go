@@ -0,0 +1,68 @@
+package forward
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+	"github.com/AlexeyYurko/go-pmserver/db"
+)
+
+func TestClientCancelKeepsProxyGood(t *testing.T) {
+	config.Scrapers = []string{"shop"}
+	config.ProxyrackProxyIP = []string{"9.9.9.9"}
+	db.Init()
+	arrived := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(arrived)
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	t.Cleanup(slow.Close)
+	proxy := slow.Listener.Addr().String()
+	db.StoreProxies("", []string{proxy})
+
+	s := New("", "", 10*time.Second)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	request := proxyRequest("http://target.test/", "shop").WithContext(ctx)
+	recorder := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.ServeHTTP(recorder, request)
+	}()
+	<-arrived
+	cancel()
+	<-done
+
+	if dead := db.Set.GetDead("shop"); len(dead) != 0 {
+		t.Errorf("proxy marked dead after client canceled the request: %v", dead)
+	}
+	if failures := db.Base.FailedAttempts("shop", proxy); failures != 0 {
+		t.Errorf("proxy got %d failures after client canceled the request", failures)
+	}
+}
+
+func TestRequestWithoutHostRejected(t *testing.T) {
+	config.Scrapers = []string{"shop"}
+	config.ProxyrackProxyIP = []string{"9.9.9.9"}
+	db.Init()
+	db.StoreProxies("", []string{"1.1.1.1:80"})
+
+	s := New("", "", time.Second)
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, proxyRequest("/path", "shop"))
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want %d", recorder.Code, http.StatusBadRequest)
+	}
+	if busy := db.Set.BusySize("shop"); busy != 0 {
+		t.Errorf("%d proxies handed out for request without host", busy)
+	}
+}
@@ -0,0 +1,114 @@
+package forward
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AlexeyYurko/go-pmserver/db"
+	"github.com/AlexeyYurko/go-pmserver/manager"
+	"github.com/AlexeyYurko/go-pmserver/now"
+)
+
+const (
+	// sessionSeparator divides scraper and session key in proxy username, as in ra-session-42
+	sessionSeparator  = "-session-"
+	defaultSessionTTL = 600 * time.Second
+)
+
+// session is proxy kept for requests with the same session key
+type session struct {
+	proxy    string
+	lastUsed time.Time
+}
+
+// sessions keeps proxies of sessions by scraper and session key
+type sessions struct {
+	sync.Mutex
+	ttl       time.Duration
+	byKey     map[string]session
+	lastSweep time.Time
+}
+
+func newSessions(ttl time.Duration) *sessions {
+	if ttl <= 0 {
+		ttl = defaultSessionTTL
+	}
+	return &sessions{ttl: ttl, byKey: make(map[string]session)}
+}
+
+// parseUsername splits proxy username into scraper and session key, session is empty if not given
+func parseUsername(username string) (scraper, sessionKey string) {
+	scraper, sessionKey, _ = strings.Cut(username, sessionSeparator)
+	return
+}
+
+// pick returns proxy of session while it is alive on domain and the manager lets scraper take it again,
+// new proxy from the manager otherwise, proxies already tried for the request are never picked.
+// Session is dropped when the manager refuses its proxy
+func (s *sessions) pick(scraper, sessionKey, domain string, tried []string) (string, error) {
+	selection := manager.Selection{Domain: domain, Exclude: tried}
+	if sessionKey == "" {
+		return manager.GetRandomProxy(scraper, selection)
+	}
+	key := scraper + sessionSeparator + sessionKey
+	currentTime := time.Now()
+
+	s.Lock()
+	s.sweep(currentTime)
+	kept, ok := s.byKey[key]
+	s.Unlock()
+	if ok && currentTime.Sub(kept.lastUsed) < s.ttl && !slices.Contains(tried, kept.proxy) && usable(scraper, kept.proxy, domain) {
+		err := manager.Reserve(scraper, kept.proxy)
+		if err == nil {
+			s.store(key, kept.proxy, currentTime)
+			return kept.proxy, nil
+		}
+		s.drop(key)
+		if errors.Is(err, manager.ErrQuotaExceeded) || errors.Is(err, manager.ErrCircuitOpen) {
+			return "", err
+		}
+	}
+
+	proxy, err := manager.GetRandomProxy(scraper, selection)
+	if err != nil {
+		return "", err
+	}
+	s.store(key, proxy, currentTime)
+	return proxy, nil
+}
+
+func (s *sessions) store(key, proxy string, currentTime time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	s.byKey[key] = session{proxy: proxy, lastUsed: currentTime}
+}
+
+func (s *sessions) drop(key string) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.byKey, key)
+}
+
+// sweep forgets sessions not used for ttl, at most once a ttl
+func (s *sessions) sweep(currentTime time.Time) {
+	if currentTime.Sub(s.lastSweep) < s.ttl {
+		return
+	}
+	for key, kept := range s.byKey {
+		if currentTime.Sub(kept.lastUsed) >= s.ttl {
+			delete(s.byKey, key)
+		}
+	}
+	s.lastSweep = currentTime
+}
+
+// usable checks if proxy kept by session can still be used for domain
+func usable(scraper, proxy, domain string) bool {
+	return !db.Base.ProxyNotInBase(scraper, proxy) &&
+		!db.Set.ProxyAlreadyDead(scraper, proxy) &&
+		!db.Actions.Is(scraper, proxy, db.ActionQuarantine) &&
+		(domain == "" || db.Base.AliveOnDomain(scraper, proxy, domain, now.Time()))
+}
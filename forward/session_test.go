@@ -0,0 +1,63 @@
+package forward
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+	"github.com/AlexeyYurko/go-pmserver/db"
+	"github.com/AlexeyYurko/go-pmserver/manager"
+)
+
+func TestStickyProxyGoesThroughAdmission(t *testing.T) {
+	quota, rateLimit := config.ScraperQuota, config.ProxyRateLimit
+	t.Cleanup(func() {
+		config.ScraperQuota, config.ProxyRateLimit = quota, rateLimit
+		config.ResolvePolicies()
+	})
+	config.Scrapers = []string{"shop"}
+	config.Groups = nil
+	config.ProxyrackProxyIP = []string{"9.9.9.9"}
+
+	t.Run("quota", func(t *testing.T) {
+		config.ScraperQuota, config.ProxyRateLimit = config.Quota{MaxPerMinute: 2}, config.RateLimit{}
+		config.ResolvePolicies()
+		db.Init()
+		db.StoreProxies("", []string{"1.1.1.1:80", "2.2.2.2:80"})
+		s := newSessions(time.Minute)
+
+		first, err := s.pick("shop", "42", "", nil)
+		if err != nil {
+			t.Fatalf("first pick: %v", err)
+		}
+		if again, err := s.pick("shop", "42", "", nil); err != nil || again != first {
+			t.Fatalf("second pick = %q, %v, want sticky %q", again, err, first)
+		}
+		if !db.Set.ProxyBusy("shop", first) {
+			t.Error("sticky proxy is not busy")
+		}
+		if _, err := s.pick("shop", "42", "", nil); !errors.Is(err, manager.ErrQuotaExceeded) {
+			t.Errorf("pick over quota err = %v, want ErrQuotaExceeded", err)
+		}
+		if _, kept := s.byKey["shop"+sessionSeparator+"42"]; kept {
+			t.Error("session kept after its proxy was refused")
+		}
+	})
+
+	t.Run("rate limit", func(t *testing.T) {
+		config.ScraperQuota, config.ProxyRateLimit = config.Quota{}, config.RateLimit{MinInterval: 60}
+		config.ResolvePolicies()
+		db.Init()
+		db.StoreProxies("", []string{"1.1.1.1:80", "2.2.2.2:80"})
+		s := newSessions(time.Minute)
+
+		first, err := s.pick("shop", "42", "", nil)
+		if err != nil {
+			t.Fatalf("first pick: %v", err)
+		}
+		if again, err := s.pick("shop", "42", "", nil); err != nil || again == first {
+			t.Errorf("second pick = %q, %v, want another proxy than rate limited %q", again, err, first)
+		}
+	})
+}
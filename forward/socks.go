@@ -0,0 +1,228 @@
+package forward
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/AlexeyYurko/go-pmserver/db"
+	"github.com/AlexeyYurko/go-pmserver/manager"
+)
+
+// SOCKS5 protocol values, RFC 1928 and RFC 1929
+const (
+	socksVersion         = 5
+	socksAuthVersion     = 1
+	socksMethodPassword  = 2
+	socksMethodNone      = 0xff
+	socksCommandConnect  = 1
+	socksAddressIPv4     = 1
+	socksAddressDomain   = 3
+	socksAddressIPv6     = 4
+	socksAuthSucceeded   = 0
+	socksAuthFailed      = 1
+	socksReplySucceeded  = 0
+	socksReplyFailure    = 1
+	socksReplyNotAllowed = 2
+	socksReplyUnreached  = 4
+	socksReplyCommand    = 7
+	socksReplyAddress    = 8
+)
+
+var errSOCKSVersion = errors.New("not a SOCKS5 client")
+
+// ListenAndServeSOCKS accepts SOCKS5 clients on SOCKSListen until the listener fails
+func (s *Server) ListenAndServeSOCKS() error {
+	listener, err := net.Listen("tcp", s.SOCKSListen)
+	if err != nil {
+		return err
+	}
+	log.Info().Str("listen", s.SOCKSListen).Msg("SOCKS5 proxy started")
+	return s.ServeSOCKS(listener)
+}
+
+// ServeSOCKS handles SOCKS5 clients coming to listener
+func (s *Server) ServeSOCKS(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serveSOCKSConn(conn)
+	}
+}
+
+func (s *Server) serveSOCKSConn(conn net.Conn) {
+	_ = conn.SetDeadline(time.Now().Add(s.DialTimeout))
+	reader := bufio.NewReader(conn)
+
+	username, err := s.socksAuthenticate(reader, conn)
+	if err != nil {
+		log.Debug().Err(err).Str("client", conn.RemoteAddr().String()).Msg("SOCKS5 handshake failed")
+		conn.Close()
+		return
+	}
+	target, err := readSOCKSRequest(reader, conn)
+	if err != nil {
+		log.Debug().Err(err).Str("client", conn.RemoteAddr().String()).Msg("SOCKS5 request failed")
+		conn.Close()
+		return
+	}
+
+	scraper, sessionKey := parseUsername(username)
+	if !db.ScraperExists(scraper) {
+		writeSOCKSReply(conn, socksReplyNotAllowed)
+		conn.Close()
+		return
+	}
+	upstream, proxy, err := s.connect(scraper, sessionKey, target, s.Retries)
+	if proxy == "" {
+		writeSOCKSReply(conn, socksNoProxyReply(err))
+		conn.Close()
+		return
+	}
+	if err != nil {
+		writeSOCKSReply(conn, socksReplyUnreached)
+		conn.Close()
+		return
+	}
+
+	if err = writeSOCKSReply(conn, socksReplySucceeded); err != nil {
+		conn.Close()
+		upstream.Close()
+		return
+	}
+	_ = conn.SetDeadline(time.Time{})
+	// client could send something right after the request, it is already read into the buffer
+	if reader.Buffered() > 0 {
+		if _, err = io.CopyN(upstream, reader, int64(reader.Buffered())); err != nil {
+			conn.Close()
+			upstream.Close()
+			return
+		}
+	}
+	pipe(conn, upstream)
+}
+
+// socksAuthenticate agrees on username and password authentication and checks them
+func (s *Server) socksAuthenticate(reader *bufio.Reader, conn net.Conn) (username string, err error) {
+	header := make([]byte, 2)
+	if _, err = io.ReadFull(reader, header); err != nil {
+		return "", err
+	}
+	if header[0] != socksVersion {
+		return "", errSOCKSVersion
+	}
+	methods := make([]byte, header[1])
+	if _, err = io.ReadFull(reader, methods); err != nil {
+		return "", err
+	}
+	offered := false
+	for _, method := range methods {
+		offered = offered || method == socksMethodPassword
+	}
+	if !offered {
+		_, _ = conn.Write([]byte{socksVersion, socksMethodNone})
+		return "", errors.New("client does not offer username and password")
+	}
+	if _, err = conn.Write([]byte{socksVersion, socksMethodPassword}); err != nil {
+		return "", err
+	}
+
+	version, err := reader.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	if version != socksAuthVersion {
+		return "", fmt.Errorf("unknown auth version %d", version)
+	}
+	username, err = readSOCKSString(reader)
+	if err != nil {
+		return "", err
+	}
+	password, err := readSOCKSString(reader)
+	if err != nil {
+		return "", err
+	}
+	if !s.allowed(username, password) {
+		_, _ = conn.Write([]byte{socksAuthVersion, socksAuthFailed})
+		return "", errors.New("wrong username or password")
+	}
+	_, err = conn.Write([]byte{socksAuthVersion, socksAuthSucceeded})
+	return username, err
+}
+
+// readSOCKSRequest reads CONNECT request and returns its target as host:port
+func readSOCKSRequest(reader *bufio.Reader, conn net.Conn) (target string, err error) {
+	header := make([]byte, 4)
+	if _, err = io.ReadFull(reader, header); err != nil {
+		return "", err
+	}
+	if header[0] != socksVersion {
+		return "", errSOCKSVersion
+	}
+
+	var host string
+	switch header[3] {
+	case socksAddressIPv4, socksAddressIPv6:
+		size := net.IPv4len
+		if header[3] == socksAddressIPv6 {
+			size = net.IPv6len
+		}
+		address := make([]byte, size)
+		if _, err = io.ReadFull(reader, address); err != nil {
+			return "", err
+		}
+		host = net.IP(address).String()
+	case socksAddressDomain:
+		if host, err = readSOCKSString(reader); err != nil {
+			return "", err
+		}
+	default:
+		writeSOCKSReply(conn, socksReplyAddress)
+		return "", fmt.Errorf("unknown address type %d", header[3])
+	}
+	port := make([]byte, 2)
+	if _, err = io.ReadFull(reader, port); err != nil {
+		return "", err
+	}
+
+	if header[1] != socksCommandConnect {
+		writeSOCKSReply(conn, socksReplyCommand)
+		return "", fmt.Errorf("unsupported command %d", header[1])
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(port[0])<<8|int(port[1]))), nil
+}
+
+// readSOCKSString reads string prefixed with its length byte
+func readSOCKSString(reader *bufio.Reader) (string, error) {
+	size, err := reader.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	value := make([]byte, size)
+	if _, err = io.ReadFull(reader, value); err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+// writeSOCKSReply answers request, bound address is never told
+func writeSOCKSReply(conn net.Conn, reply byte) error {
+	_, err := conn.Write([]byte{socksVersion, reply, 0, socksAddressIPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+// socksNoProxyReply is reply for client when there is no proxy to route its connection through
+func socksNoProxyReply(err error) byte {
+	if errors.Is(err, manager.ErrQuotaExceeded) || errors.Is(err, manager.ErrCircuitOpen) {
+		return socksReplyNotAllowed
+	}
+	return socksReplyFailure
+}
@@ -0,0 +1,220 @@
+package forward
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+	"github.com/AlexeyYurko/go-pmserver/db"
+	"github.com/AlexeyYurko/go-pmserver/manager"
+)
+
+// socksExchange sends input to serve over a pipe and returns everything serve answered
+func socksExchange(t *testing.T, input []byte, serve func(reader *bufio.Reader, conn net.Conn)) []byte {
+	t.Helper()
+	server, client := net.Pipe()
+	defer client.Close()
+	// truncated input leaves serve waiting for the rest
+	_ = server.SetDeadline(time.Now().Add(200 * time.Millisecond))
+	_ = client.SetDeadline(time.Now().Add(time.Second))
+
+	go func() { _, _ = client.Write(input) }()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer server.Close()
+		serve(bufio.NewReader(server), server)
+	}()
+	output, _ := io.ReadAll(client)
+	<-done
+	return output
+}
+
+// socksString is string prefixed with its length byte
+func socksString(value string) []byte {
+	return append([]byte{byte(len(value))}, value...)
+}
+
+func socksAuth(username, password string) []byte {
+	auth := append([]byte{socksAuthVersion}, socksString(username)...)
+	return append(auth, socksString(password)...)
+}
+
+func TestSOCKSAuthenticate(t *testing.T) {
+	offerPassword := []byte{socksVersion, 2, 0, socksMethodPassword}
+	tests := []struct {
+		name     string
+		password string
+		input    []byte
+		username string
+		output   []byte
+	}{
+		{
+			name:     "right password",
+			password: "secret",
+			input:    append(offerPassword, socksAuth("shop", "secret")...),
+			username: "shop",
+			output:   []byte{socksVersion, socksMethodPassword, socksAuthVersion, socksAuthSucceeded},
+		},
+		{
+			name:     "any password when none is set",
+			input:    append(offerPassword, socksAuth("shop-session-1", "whatever")...),
+			username: "shop-session-1",
+			output:   []byte{socksVersion, socksMethodPassword, socksAuthVersion, socksAuthSucceeded},
+		},
+		{
+			name:     "wrong password",
+			password: "secret",
+			input:    append(offerPassword, socksAuth("shop", "guess")...),
+			output:   []byte{socksVersion, socksMethodPassword, socksAuthVersion, socksAuthFailed},
+		},
+		{
+			name:   "empty username",
+			input:  append(offerPassword, socksAuth("", "")...),
+			output: []byte{socksVersion, socksMethodPassword, socksAuthVersion, socksAuthFailed},
+		},
+		{
+			name:   "no password method offered",
+			input:  []byte{socksVersion, 1, 0},
+			output: []byte{socksVersion, socksMethodNone},
+		},
+		{
+			name:   "unknown auth version",
+			input:  append(offerPassword, 2, 4, 's', 'h', 'o', 'p', 0),
+			output: []byte{socksVersion, socksMethodPassword},
+		},
+		{name: "SOCKS4 client", input: []byte{4, 1, 0, 80, 1, 2, 3, 4, 0}},
+		{name: "truncated methods", input: []byte{socksVersion, 3, socksMethodPassword}},
+		{
+			name:   "truncated password",
+			input:  append(offerPassword, socksAuthVersion, 4, 's', 'h', 'o', 'p', 6, 's'),
+			output: []byte{socksVersion, socksMethodPassword},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New("", tt.password, time.Second)
+			var username string
+			var err error
+			output := socksExchange(t, tt.input, func(reader *bufio.Reader, conn net.Conn) {
+				username, err = s.socksAuthenticate(reader, conn)
+			})
+			if tt.username == "" && err == nil {
+				t.Errorf("no error, username %q", username)
+			}
+			if tt.username != "" && (err != nil || username != tt.username) {
+				t.Errorf("username %q, err %v, want %q", username, err, tt.username)
+			}
+			if !bytes.Equal(output, tt.output) {
+				t.Errorf("answered %v, want %v", output, tt.output)
+			}
+		})
+	}
+}
+
+func TestReadSOCKSRequest(t *testing.T) {
+	connect := []byte{socksVersion, socksCommandConnect, 0}
+	tests := []struct {
+		name   string
+		input  []byte
+		target string
+		reply  byte
+	}{
+		{
+			name:   "IPv4",
+			input:  append(connect, socksAddressIPv4, 1, 2, 3, 4, 0x1f, 0x90),
+			target: "1.2.3.4:8080",
+		},
+		{
+			name:   "IPv6",
+			input:  append(append(connect, socksAddressIPv6), append(net.ParseIP("2001:db8::1"), 0, 80)...),
+			target: "[2001:db8::1]:80",
+		},
+		{
+			name:   "domain",
+			input:  append(append(connect, socksAddressDomain), append(socksString("example.com"), 1, 187)...),
+			target: "example.com:443",
+		},
+		{
+			name:  "bind command",
+			input: []byte{socksVersion, 2, 0, socksAddressIPv4, 1, 2, 3, 4, 0, 80},
+			reply: socksReplyCommand,
+		},
+		{
+			name:  "unknown address type",
+			input: append(connect, 9, 1, 2, 3, 4, 0, 80),
+			reply: socksReplyAddress,
+		},
+		{name: "wrong version", input: []byte{4, socksCommandConnect, 0, socksAddressIPv4, 1, 2, 3, 4, 0, 80}},
+		{name: "truncated port", input: append(connect, socksAddressIPv4, 1, 2, 3, 4, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var target string
+			var err error
+			output := socksExchange(t, tt.input, func(reader *bufio.Reader, conn net.Conn) {
+				target, err = readSOCKSRequest(reader, conn)
+			})
+			if tt.target != "" {
+				if err != nil || target != tt.target {
+					t.Errorf("target %q, err %v, want %q", target, err, tt.target)
+				}
+				if len(output) != 0 {
+					t.Errorf("answered %v before connecting", output)
+				}
+				return
+			}
+			if err == nil {
+				t.Errorf("no error, target %q", target)
+			}
+			var want []byte
+			if tt.reply != 0 {
+				want = []byte{socksVersion, tt.reply, 0, socksAddressIPv4, 0, 0, 0, 0, 0, 0}
+			}
+			if !bytes.Equal(output, want) {
+				t.Errorf("answered %v, want %v", output, want)
+			}
+		})
+	}
+}
+
+func TestSOCKSUnknownScraper(t *testing.T) {
+	config.Scrapers = []string{"shop"}
+	config.ProxyrackProxyIP = []string{"9.9.9.9"}
+	db.Init()
+
+	input := append([]byte{socksVersion, 1, socksMethodPassword}, socksAuth("missing", "")...)
+	input = append(input, socksVersion, socksCommandConnect, 0, socksAddressIPv4, 1, 2, 3, 4, 0, 80)
+	s := New("", "", time.Second)
+	output := socksExchange(t, input, func(_ *bufio.Reader, conn net.Conn) {
+		s.serveSOCKSConn(conn)
+	})
+	want := []byte{
+		socksVersion, socksMethodPassword, socksAuthVersion, socksAuthSucceeded,
+		socksVersion, socksReplyNotAllowed, 0, socksAddressIPv4, 0, 0, 0, 0, 0, 0,
+	}
+	if !bytes.Equal(output, want) {
+		t.Errorf("answered %v, want %v", output, want)
+	}
+}
+
+func TestSOCKSNoProxyReply(t *testing.T) {
+	tests := []struct {
+		err   error
+		reply byte
+	}{
+		{err: manager.ErrQuotaExceeded, reply: socksReplyNotAllowed},
+		{err: manager.ErrCircuitOpen, reply: socksReplyNotAllowed},
+		{err: errors.New("no proxies"), reply: socksReplyFailure},
+	}
+	for _, tt := range tests {
+		if reply := socksNoProxyReply(tt.err); reply != tt.reply {
+			t.Errorf("socksNoProxyReply(%v) = %d, want %d", tt.err, reply, tt.reply)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package forward
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	netproxy "golang.org/x/net/proxy"
+
+	"github.com/AlexeyYurko/go-pmserver/checker"
+	"github.com/AlexeyYurko/go-pmserver/manager"
+)
+
+// errUnusableUpstream is returned for pool proxy written in a way it can't be used as upstream,
+// nothing was sent through it, so it is not a failure of the proxy
+var errUnusableUpstream = errors.New("unusable upstream proxy")
+
+// Verdicts which are not reported to manager
+const (
+	// verdictUnusable is for proxy whose address can't be used as upstream
+	verdictUnusable = "unusable"
+	// verdictCanceled is for request client has given up on, it tells nothing about the proxy
+	verdictCanceled = "canceled"
+)
+
+// upstreamURL is address of pool proxy, http and socks5 proxies can be used as upstream
+func upstreamURL(proxy string) (*url.URL, error) {
+	proxyURL, err := checker.ProxyURL(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errUnusableUpstream, err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "socks5", "socks5h":
+		return proxyURL, nil
+	}
+	return nil, fmt.Errorf("%w: unsupported scheme %s", errUnusableUpstream, proxyURL.Scheme)
+}
+
+// dialThrough opens connection to target through pool proxy
+func (s *Server) dialThrough(proxy, target string) (net.Conn, error) {
+	proxyURL, err := upstreamURL(proxy)
+	if err != nil {
+		return nil, err
+	}
+	if proxyURL.Scheme == "http" {
+		return s.connectThrough(proxyURL, target)
+	}
+
+	dialer, err := netproxy.FromURL(proxyURL, &net.Dialer{Timeout: s.DialTimeout})
+	if err != nil {
+		return nil, err
+	}
+	contextDialer, ok := dialer.(netproxy.ContextDialer)
+	if !ok {
+		return dialer.Dial("tcp", target)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.DialTimeout)
+	defer cancel()
+	return contextDialer.DialContext(ctx, "tcp", target)
+}
+
+// connectThrough opens tunnel to target through http proxy with CONNECT request
+func (s *Server) connectThrough(proxyURL *url.URL, target string) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", proxyURL.Host, s.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(s.DialTimeout))
+
+	request := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: target},
+		Host:   target,
+		Header: make(http.Header),
+	}
+	if proxyURL.User != nil {
+		password, _ := proxyURL.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + password))
+		request.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err = request.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, request)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, &checker.StatusError{StatusCode: response.StatusCode}
+	}
+	_ = conn.SetDeadline(time.Time{})
+	if reader.Buffered() > 0 {
+		// target already sent something after the proxy answer
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn reads first what was buffered while reading CONNECT answer
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// proxyError checks if status code is error of the proxy itself, other 5xx come from target
+func proxyError(statusCode int) bool {
+	return statusCode == http.StatusBadGateway || statusCode == http.StatusGatewayTimeout
+}
+
+// canceled checks if request through proxy ended because client went away
+func canceled(r *http.Request, err error) bool {
+	return r.Context().Err() != nil || errors.Is(err, context.Canceled)
+}
+
+// report tells manager how request to domain through proxy went, proxy which can't be used as upstream
+// and request canceled by client are only logged
+func (s *Server) report(scraper, proxy, domain string, result outcome, started time.Time) {
+	switch result.verdict {
+	case verdictUnusable:
+		log.Warn().Str("scraper", scraper).Str("proxy", proxy).Msg("proxy can't be used as upstream")
+		return
+	case verdictCanceled:
+		log.Debug().Str("scraper", scraper).Str("proxy", proxy).Msg("request canceled by client")
+		return
+	}
+	if result.rule != "" {
+		log.Debug().
+			Str("scraper", scraper).
+			Str("proxy", proxy).
+			Str("rule", result.rule).
+			Str("verdict", result.verdict).
+			Msg("answer matched rule")
+	}
+	switch {
+	case result.verdict == VerdictBan, result.verdict == VerdictSoftFail && domain == "":
+		manager.MarkDead(scraper, proxy, result.reason)
+	case result.verdict == VerdictSoftFail:
+		manager.MarkDeadOnDomain(scraper, proxy, domain, result.reason)
+	default:
+		manager.IncGoodAttempts(scraper, proxy)
+		manager.ReportLatency(scraper, proxy, float64(time.Since(started).Milliseconds()))
+		if domain != "" {
+			manager.DomainPassed(scraper, proxy, domain)
+		}
+	}
+}
@@ -0,0 +1,4 @@
+// Package pmserverpb is generated from pmserver.proto
+package pmserverpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative pmserver.proto
@@ -0,0 +1,1121 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        v5.29.3
+// source: pmserver.proto
+
+package pmserverpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Selection narrows down proxies to hand out, like query of /get-random.
+type Selection struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// max_latency in ms, 0 for no limit.
+	MaxLatency float64 `protobuf:"fixed64,1,opt,name=max_latency,json=maxLatency,proto3" json:"max_latency,omitempty"`
+	// require_latency skips proxies over max_latency or never measured instead of preferring others.
+	RequireLatency bool `protobuf:"varint,2,opt,name=require_latency,json=requireLatency,proto3" json:"require_latency,omitempty"`
+	// anonymity is the worst level allowed: transparent, anonymous or elite, empty for any.
+	Anonymity string `protobuf:"bytes,3,opt,name=anonymity,proto3" json:"anonymity,omitempty"`
+	// domain is target domain, proxies dead on it are skipped.
+	Domain        string `protobuf:"bytes,4,opt,name=domain,proto3" json:"domain,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Selection) Reset() {
+	*x = Selection{}
+	mi := &file_pmserver_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Selection) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Selection) ProtoMessage() {}
+
+func (x *Selection) ProtoReflect() protoreflect.Message {
+	mi := &file_pmserver_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Selection.ProtoReflect.Descriptor instead.
+func (*Selection) Descriptor() ([]byte, []int) {
+	return file_pmserver_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Selection) GetMaxLatency() float64 {
+	if x != nil {
+		return x.MaxLatency
+	}
+	return 0
+}
+
+func (x *Selection) GetRequireLatency() bool {
+	if x != nil {
+		return x.RequireLatency
+	}
+	return false
+}
+
+func (x *Selection) GetAnonymity() string {
+	if x != nil {
+		return x.Anonymity
+	}
+	return ""
+}
+
+func (x *Selection) GetDomain() string {
+	if x != nil {
+		return x.Domain
+	}
+	return ""
+}
+
+type CheckoutRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Scraper       string                 `protobuf:"bytes,1,opt,name=scraper,proto3" json:"scraper,omitempty"`
+	Selection     *Selection             `protobuf:"bytes,2,opt,name=selection,proto3" json:"selection,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckoutRequest) Reset() {
+	*x = CheckoutRequest{}
+	mi := &file_pmserver_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckoutRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckoutRequest) ProtoMessage() {}
+
+func (x *CheckoutRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pmserver_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckoutRequest.ProtoReflect.Descriptor instead.
+func (*CheckoutRequest) Descriptor() ([]byte, []int) {
+	return file_pmserver_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *CheckoutRequest) GetScraper() string {
+	if x != nil {
+		return x.Scraper
+	}
+	return ""
+}
+
+func (x *CheckoutRequest) GetSelection() *Selection {
+	if x != nil {
+		return x.Selection
+	}
+	return nil
+}
+
+type CheckoutResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Proxy         string                 `protobuf:"bytes,1,opt,name=proxy,proto3" json:"proxy,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckoutResponse) Reset() {
+	*x = CheckoutResponse{}
+	mi := &file_pmserver_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckoutResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckoutResponse) ProtoMessage() {}
+
+func (x *CheckoutResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pmserver_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckoutResponse.ProtoReflect.Descriptor instead.
+func (*CheckoutResponse) Descriptor() ([]byte, []int) {
+	return file_pmserver_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *CheckoutResponse) GetProxy() string {
+	if x != nil {
+		return x.Proxy
+	}
+	return ""
+}
+
+type CheckoutBatchRequest struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Scraper   string                 `protobuf:"bytes,1,opt,name=scraper,proto3" json:"scraper,omitempty"`
+	Selection *Selection             `protobuf:"bytes,2,opt,name=selection,proto3" json:"selection,omitempty"`
+	// count of proxies, up to the configured max-batch.
+	Count         int32 `protobuf:"varint,3,opt,name=count,proto3" json:"count,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckoutBatchRequest) Reset() {
+	*x = CheckoutBatchRequest{}
+	mi := &file_pmserver_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckoutBatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckoutBatchRequest) ProtoMessage() {}
+
+func (x *CheckoutBatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pmserver_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckoutBatchRequest.ProtoReflect.Descriptor instead.
+func (*CheckoutBatchRequest) Descriptor() ([]byte, []int) {
+	return file_pmserver_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *CheckoutBatchRequest) GetScraper() string {
+	if x != nil {
+		return x.Scraper
+	}
+	return ""
+}
+
+func (x *CheckoutBatchRequest) GetSelection() *Selection {
+	if x != nil {
+		return x.Selection
+	}
+	return nil
+}
+
+func (x *CheckoutBatchRequest) GetCount() int32 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+type CheckoutBatchResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Proxies       []string               `protobuf:"bytes,1,rep,name=proxies,proto3" json:"proxies,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CheckoutBatchResponse) Reset() {
+	*x = CheckoutBatchResponse{}
+	mi := &file_pmserver_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CheckoutBatchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CheckoutBatchResponse) ProtoMessage() {}
+
+func (x *CheckoutBatchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pmserver_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CheckoutBatchResponse.ProtoReflect.Descriptor instead.
+func (*CheckoutBatchResponse) Descriptor() ([]byte, []int) {
+	return file_pmserver_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *CheckoutBatchResponse) GetProxies() []string {
+	if x != nil {
+		return x.Proxies
+	}
+	return nil
+}
+
+// Outcome of using proxy, like /inc-good-attempts or /mark-dead.
+type Outcome struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Scraper string                 `protobuf:"bytes,1,opt,name=scraper,proto3" json:"scraper,omitempty"`
+	Proxy   string                 `protobuf:"bytes,2,opt,name=proxy,proto3" json:"proxy,omitempty"`
+	// failed marks proxy dead, otherwise its use was successful.
+	Failed bool `protobuf:"varint,3,opt,name=failed,proto3" json:"failed,omitempty"`
+	// reason of failure: timeout, refused, banned, captcha, http_5xx or custom.
+	Reason string `protobuf:"bytes,4,opt,name=reason,proto3" json:"reason,omitempty"`
+	// latency of successful request in ms.
+	Latency *float64 `protobuf:"fixed64,5,opt,name=latency,proto3,oneof" json:"latency,omitempty"`
+	// domain of request, failure marks proxy dead on this domain only.
+	Domain        string `protobuf:"bytes,6,opt,name=domain,proto3" json:"domain,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Outcome) Reset() {
+	*x = Outcome{}
+	mi := &file_pmserver_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Outcome) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Outcome) ProtoMessage() {}
+
+func (x *Outcome) ProtoReflect() protoreflect.Message {
+	mi := &file_pmserver_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Outcome.ProtoReflect.Descriptor instead.
+func (*Outcome) Descriptor() ([]byte, []int) {
+	return file_pmserver_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Outcome) GetScraper() string {
+	if x != nil {
+		return x.Scraper
+	}
+	return ""
+}
+
+func (x *Outcome) GetProxy() string {
+	if x != nil {
+		return x.Proxy
+	}
+	return ""
+}
+
+func (x *Outcome) GetFailed() bool {
+	if x != nil {
+		return x.Failed
+	}
+	return false
+}
+
+func (x *Outcome) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *Outcome) GetLatency() float64 {
+	if x != nil && x.Latency != nil {
+		return *x.Latency
+	}
+	return 0
+}
+
+func (x *Outcome) GetDomain() string {
+	if x != nil {
+		return x.Domain
+	}
+	return ""
+}
+
+type ReportBatchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Outcomes      []*Outcome             `protobuf:"bytes,1,rep,name=outcomes,proto3" json:"outcomes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReportBatchRequest) Reset() {
+	*x = ReportBatchRequest{}
+	mi := &file_pmserver_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReportBatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReportBatchRequest) ProtoMessage() {}
+
+func (x *ReportBatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pmserver_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReportBatchRequest.ProtoReflect.Descriptor instead.
+func (*ReportBatchRequest) Descriptor() ([]byte, []int) {
+	return file_pmserver_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ReportBatchRequest) GetOutcomes() []*Outcome {
+	if x != nil {
+		return x.Outcomes
+	}
+	return nil
+}
+
+type ReportResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// applied outcomes.
+	Applied int32 `protobuf:"varint,1,opt,name=applied,proto3" json:"applied,omitempty"`
+	// results of outcomes in order, like results of /report-outcomes: applied, ignored for success
+	// of proxy which is already dead or unknown_proxy for proxy not in the pool.
+	Results       []string `protobuf:"bytes,2,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ReportResponse) Reset() {
+	*x = ReportResponse{}
+	mi := &file_pmserver_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReportResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReportResponse) ProtoMessage() {}
+
+func (x *ReportResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pmserver_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReportResponse.ProtoReflect.Descriptor instead.
+func (*ReportResponse) Descriptor() ([]byte, []int) {
+	return file_pmserver_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ReportResponse) GetApplied() int32 {
+	if x != nil {
+		return x.Applied
+	}
+	return 0
+}
+
+func (x *ReportResponse) GetResults() []string {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+type ListScrapersRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListScrapersRequest) Reset() {
+	*x = ListScrapersRequest{}
+	mi := &file_pmserver_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListScrapersRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListScrapersRequest) ProtoMessage() {}
+
+func (x *ListScrapersRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pmserver_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListScrapersRequest.ProtoReflect.Descriptor instead.
+func (*ListScrapersRequest) Descriptor() ([]byte, []int) {
+	return file_pmserver_proto_rawDescGZIP(), []int{8}
+}
+
+type ListScrapersResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Scrapers      []string               `protobuf:"bytes,1,rep,name=scrapers,proto3" json:"scrapers,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListScrapersResponse) Reset() {
+	*x = ListScrapersResponse{}
+	mi := &file_pmserver_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListScrapersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListScrapersResponse) ProtoMessage() {}
+
+func (x *ListScrapersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pmserver_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListScrapersResponse.ProtoReflect.Descriptor instead.
+func (*ListScrapersResponse) Descriptor() ([]byte, []int) {
+	return file_pmserver_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ListScrapersResponse) GetScrapers() []string {
+	if x != nil {
+		return x.Scrapers
+	}
+	return nil
+}
+
+type GetPoolRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Scraper       string                 `protobuf:"bytes,1,opt,name=scraper,proto3" json:"scraper,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPoolRequest) Reset() {
+	*x = GetPoolRequest{}
+	mi := &file_pmserver_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPoolRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPoolRequest) ProtoMessage() {}
+
+func (x *GetPoolRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pmserver_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPoolRequest.ProtoReflect.Descriptor instead.
+func (*GetPoolRequest) Descriptor() ([]byte, []int) {
+	return file_pmserver_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *GetPoolRequest) GetScraper() string {
+	if x != nil {
+		return x.Scraper
+	}
+	return ""
+}
+
+type Pool struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Scraper       string                 `protobuf:"bytes,1,opt,name=scraper,proto3" json:"scraper,omitempty"`
+	Available     int32                  `protobuf:"varint,2,opt,name=available,proto3" json:"available,omitempty"`
+	Busy          int32                  `protobuf:"varint,3,opt,name=busy,proto3" json:"busy,omitempty"`
+	Postponed     int32                  `protobuf:"varint,4,opt,name=postponed,proto3" json:"postponed,omitempty"`
+	Unchecked     int32                  `protobuf:"varint,5,opt,name=unchecked,proto3" json:"unchecked,omitempty"`
+	Dead          int32                  `protobuf:"varint,6,opt,name=dead,proto3" json:"dead,omitempty"`
+	Quota         *Quota                 `protobuf:"bytes,7,opt,name=quota,proto3" json:"quota,omitempty"`
+	Circuit       *Circuit               `protobuf:"bytes,8,opt,name=circuit,proto3" json:"circuit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Pool) Reset() {
+	*x = Pool{}
+	mi := &file_pmserver_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Pool) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Pool) ProtoMessage() {}
+
+func (x *Pool) ProtoReflect() protoreflect.Message {
+	mi := &file_pmserver_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Pool.ProtoReflect.Descriptor instead.
+func (*Pool) Descriptor() ([]byte, []int) {
+	return file_pmserver_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *Pool) GetScraper() string {
+	if x != nil {
+		return x.Scraper
+	}
+	return ""
+}
+
+func (x *Pool) GetAvailable() int32 {
+	if x != nil {
+		return x.Available
+	}
+	return 0
+}
+
+func (x *Pool) GetBusy() int32 {
+	if x != nil {
+		return x.Busy
+	}
+	return 0
+}
+
+func (x *Pool) GetPostponed() int32 {
+	if x != nil {
+		return x.Postponed
+	}
+	return 0
+}
+
+func (x *Pool) GetUnchecked() int32 {
+	if x != nil {
+		return x.Unchecked
+	}
+	return 0
+}
+
+func (x *Pool) GetDead() int32 {
+	if x != nil {
+		return x.Dead
+	}
+	return 0
+}
+
+func (x *Pool) GetQuota() *Quota {
+	if x != nil {
+		return x.Quota
+	}
+	return nil
+}
+
+func (x *Pool) GetCircuit() *Circuit {
+	if x != nil {
+		return x.Circuit
+	}
+	return nil
+}
+
+type Quota struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Busy          int32                  `protobuf:"varint,1,opt,name=busy,proto3" json:"busy,omitempty"`
+	MaxBusy       int32                  `protobuf:"varint,2,opt,name=max_busy,json=maxBusy,proto3" json:"max_busy,omitempty"`
+	PerMinute     int32                  `protobuf:"varint,3,opt,name=per_minute,json=perMinute,proto3" json:"per_minute,omitempty"`
+	MaxPerMinute  int32                  `protobuf:"varint,4,opt,name=max_per_minute,json=maxPerMinute,proto3" json:"max_per_minute,omitempty"`
+	Rejected      int32                  `protobuf:"varint,5,opt,name=rejected,proto3" json:"rejected,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Quota) Reset() {
+	*x = Quota{}
+	mi := &file_pmserver_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Quota) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Quota) ProtoMessage() {}
+
+func (x *Quota) ProtoReflect() protoreflect.Message {
+	mi := &file_pmserver_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Quota.ProtoReflect.Descriptor instead.
+func (*Quota) Descriptor() ([]byte, []int) {
+	return file_pmserver_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *Quota) GetBusy() int32 {
+	if x != nil {
+		return x.Busy
+	}
+	return 0
+}
+
+func (x *Quota) GetMaxBusy() int32 {
+	if x != nil {
+		return x.MaxBusy
+	}
+	return 0
+}
+
+func (x *Quota) GetPerMinute() int32 {
+	if x != nil {
+		return x.PerMinute
+	}
+	return 0
+}
+
+func (x *Quota) GetMaxPerMinute() int32 {
+	if x != nil {
+		return x.MaxPerMinute
+	}
+	return 0
+}
+
+func (x *Quota) GetRejected() int32 {
+	if x != nil {
+		return x.Rejected
+	}
+	return 0
+}
+
+type Circuit struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// state is closed, open or half-open.
+	State         string `protobuf:"bytes,1,opt,name=state,proto3" json:"state,omitempty"`
+	Since         int64  `protobuf:"varint,2,opt,name=since,proto3" json:"since,omitempty"`
+	WindowStart   int64  `protobuf:"varint,3,opt,name=window_start,json=windowStart,proto3" json:"window_start,omitempty"`
+	Successes     int32  `protobuf:"varint,4,opt,name=successes,proto3" json:"successes,omitempty"`
+	Failures      int32  `protobuf:"varint,5,opt,name=failures,proto3" json:"failures,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Circuit) Reset() {
+	*x = Circuit{}
+	mi := &file_pmserver_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Circuit) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Circuit) ProtoMessage() {}
+
+func (x *Circuit) ProtoReflect() protoreflect.Message {
+	mi := &file_pmserver_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Circuit.ProtoReflect.Descriptor instead.
+func (*Circuit) Descriptor() ([]byte, []int) {
+	return file_pmserver_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *Circuit) GetState() string {
+	if x != nil {
+		return x.State
+	}
+	return ""
+}
+
+func (x *Circuit) GetSince() int64 {
+	if x != nil {
+		return x.Since
+	}
+	return 0
+}
+
+func (x *Circuit) GetWindowStart() int64 {
+	if x != nil {
+		return x.WindowStart
+	}
+	return 0
+}
+
+func (x *Circuit) GetSuccesses() int32 {
+	if x != nil {
+		return x.Successes
+	}
+	return 0
+}
+
+func (x *Circuit) GetFailures() int32 {
+	if x != nil {
+		return x.Failures
+	}
+	return 0
+}
+
+type ListProxiesRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Scraper string                 `protobuf:"bytes,1,opt,name=scraper,proto3" json:"scraper,omitempty"`
+	// status is working or dead, working if empty.
+	Status        string `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListProxiesRequest) Reset() {
+	*x = ListProxiesRequest{}
+	mi := &file_pmserver_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListProxiesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListProxiesRequest) ProtoMessage() {}
+
+func (x *ListProxiesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_pmserver_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListProxiesRequest.ProtoReflect.Descriptor instead.
+func (*ListProxiesRequest) Descriptor() ([]byte, []int) {
+	return file_pmserver_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *ListProxiesRequest) GetScraper() string {
+	if x != nil {
+		return x.Scraper
+	}
+	return ""
+}
+
+func (x *ListProxiesRequest) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+type ListProxiesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Proxies       []string               `protobuf:"bytes,1,rep,name=proxies,proto3" json:"proxies,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListProxiesResponse) Reset() {
+	*x = ListProxiesResponse{}
+	mi := &file_pmserver_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListProxiesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListProxiesResponse) ProtoMessage() {}
+
+func (x *ListProxiesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_pmserver_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListProxiesResponse.ProtoReflect.Descriptor instead.
+func (*ListProxiesResponse) Descriptor() ([]byte, []int) {
+	return file_pmserver_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *ListProxiesResponse) GetProxies() []string {
+	if x != nil {
+		return x.Proxies
+	}
+	return nil
+}
+
+var File_pmserver_proto protoreflect.FileDescriptor
+
+const file_pmserver_proto_rawDesc = "" +
+	"\n" +
+	"\x0epmserver.proto\x12\vpmserver.v1\"\x8b\x01\n" +
+	"\tSelection\x12\x1f\n" +
+	"\vmax_latency\x18\x01 \x01(\x01R\n" +
+	"maxLatency\x12'\n" +
+	"\x0frequire_latency\x18\x02 \x01(\bR\x0erequireLatency\x12\x1c\n" +
+	"\tanonymity\x18\x03 \x01(\tR\tanonymity\x12\x16\n" +
+	"\x06domain\x18\x04 \x01(\tR\x06domain\"a\n" +
+	"\x0fCheckoutRequest\x12\x18\n" +
+	"\ascraper\x18\x01 \x01(\tR\ascraper\x124\n" +
+	"\tselection\x18\x02 \x01(\v2\x16.pmserver.v1.SelectionR\tselection\"(\n" +
+	"\x10CheckoutResponse\x12\x14\n" +
+	"\x05proxy\x18\x01 \x01(\tR\x05proxy\"|\n" +
+	"\x14CheckoutBatchRequest\x12\x18\n" +
+	"\ascraper\x18\x01 \x01(\tR\ascraper\x124\n" +
+	"\tselection\x18\x02 \x01(\v2\x16.pmserver.v1.SelectionR\tselection\x12\x14\n" +
+	"\x05count\x18\x03 \x01(\x05R\x05count\"1\n" +
+	"\x15CheckoutBatchResponse\x12\x18\n" +
+	"\aproxies\x18\x01 \x03(\tR\aproxies\"\xac\x01\n" +
+	"\aOutcome\x12\x18\n" +
+	"\ascraper\x18\x01 \x01(\tR\ascraper\x12\x14\n" +
+	"\x05proxy\x18\x02 \x01(\tR\x05proxy\x12\x16\n" +
+	"\x06failed\x18\x03 \x01(\bR\x06failed\x12\x16\n" +
+	"\x06reason\x18\x04 \x01(\tR\x06reason\x12\x1d\n" +
+	"\alatency\x18\x05 \x01(\x01H\x00R\alatency\x88\x01\x01\x12\x16\n" +
+	"\x06domain\x18\x06 \x01(\tR\x06domainB\n" +
+	"\n" +
+	"\b_latency\"F\n" +
+	"\x12ReportBatchRequest\x120\n" +
+	"\boutcomes\x18\x01 \x03(\v2\x14.pmserver.v1.OutcomeR\boutcomes\"D\n" +
+	"\x0eReportResponse\x12\x18\n" +
+	"\aapplied\x18\x01 \x01(\x05R\aapplied\x12\x18\n" +
+	"\aresults\x18\x02 \x03(\tR\aresults\"\x15\n" +
+	"\x13ListScrapersRequest\"2\n" +
+	"\x14ListScrapersResponse\x12\x1a\n" +
+	"\bscrapers\x18\x01 \x03(\tR\bscrapers\"*\n" +
+	"\x0eGetPoolRequest\x12\x18\n" +
+	"\ascraper\x18\x01 \x01(\tR\ascraper\"\xfc\x01\n" +
+	"\x04Pool\x12\x18\n" +
+	"\ascraper\x18\x01 \x01(\tR\ascraper\x12\x1c\n" +
+	"\tavailable\x18\x02 \x01(\x05R\tavailable\x12\x12\n" +
+	"\x04busy\x18\x03 \x01(\x05R\x04busy\x12\x1c\n" +
+	"\tpostponed\x18\x04 \x01(\x05R\tpostponed\x12\x1c\n" +
+	"\tunchecked\x18\x05 \x01(\x05R\tunchecked\x12\x12\n" +
+	"\x04dead\x18\x06 \x01(\x05R\x04dead\x12(\n" +
+	"\x05quota\x18\a \x01(\v2\x12.pmserver.v1.QuotaR\x05quota\x12.\n" +
+	"\acircuit\x18\b \x01(\v2\x14.pmserver.v1.CircuitR\acircuit\"\x97\x01\n" +
+	"\x05Quota\x12\x12\n" +
+	"\x04busy\x18\x01 \x01(\x05R\x04busy\x12\x19\n" +
+	"\bmax_busy\x18\x02 \x01(\x05R\amaxBusy\x12\x1d\n" +
+	"\n" +
+	"per_minute\x18\x03 \x01(\x05R\tperMinute\x12$\n" +
+	"\x0emax_per_minute\x18\x04 \x01(\x05R\fmaxPerMinute\x12\x1a\n" +
+	"\brejected\x18\x05 \x01(\x05R\brejected\"\x92\x01\n" +
+	"\aCircuit\x12\x14\n" +
+	"\x05state\x18\x01 \x01(\tR\x05state\x12\x14\n" +
+	"\x05since\x18\x02 \x01(\x03R\x05since\x12!\n" +
+	"\fwindow_start\x18\x03 \x01(\x03R\vwindowStart\x12\x1c\n" +
+	"\tsuccesses\x18\x04 \x01(\x05R\tsuccesses\x12\x1a\n" +
+	"\bfailures\x18\x05 \x01(\x05R\bfailures\"F\n" +
+	"\x12ListProxiesRequest\x12\x18\n" +
+	"\ascraper\x18\x01 \x01(\tR\ascraper\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\tR\x06status\"/\n" +
+	"\x13ListProxiesResponse\x12\x18\n" +
+	"\aproxies\x18\x01 \x03(\tR\aproxies2\xdc\x04\n" +
+	"\bPmserver\x12G\n" +
+	"\bCheckout\x12\x1c.pmserver.v1.CheckoutRequest\x1a\x1d.pmserver.v1.CheckoutResponse\x12V\n" +
+	"\rCheckoutBatch\x12!.pmserver.v1.CheckoutBatchRequest\x1a\".pmserver.v1.CheckoutBatchResponse\x12;\n" +
+	"\x06Report\x12\x14.pmserver.v1.Outcome\x1a\x1b.pmserver.v1.ReportResponse\x12K\n" +
+	"\vReportBatch\x12\x1f.pmserver.v1.ReportBatchRequest\x1a\x1b.pmserver.v1.ReportResponse\x12C\n" +
+	"\fReportStream\x12\x14.pmserver.v1.Outcome\x1a\x1b.pmserver.v1.ReportResponse(\x01\x12S\n" +
+	"\fListScrapers\x12 .pmserver.v1.ListScrapersRequest\x1a!.pmserver.v1.ListScrapersResponse\x129\n" +
+	"\aGetPool\x12\x1b.pmserver.v1.GetPoolRequest\x1a\x11.pmserver.v1.Pool\x12P\n" +
+	"\vListProxies\x12\x1f.pmserver.v1.ListProxiesRequest\x1a .pmserver.v1.ListProxiesResponseB7Z5github.com/AlexeyYurko/go-pmserver/grpcapi/pmserverpbb\x06proto3"
+
+var (
+	file_pmserver_proto_rawDescOnce sync.Once
+	file_pmserver_proto_rawDescData []byte
+)
+
+func file_pmserver_proto_rawDescGZIP() []byte {
+	file_pmserver_proto_rawDescOnce.Do(func() {
+		file_pmserver_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_pmserver_proto_rawDesc), len(file_pmserver_proto_rawDesc)))
+	})
+	return file_pmserver_proto_rawDescData
+}
+
+var file_pmserver_proto_msgTypes = make([]protoimpl.MessageInfo, 16)
+var file_pmserver_proto_goTypes = []any{
+	(*Selection)(nil),             // 0: pmserver.v1.Selection
+	(*CheckoutRequest)(nil),       // 1: pmserver.v1.CheckoutRequest
+	(*CheckoutResponse)(nil),      // 2: pmserver.v1.CheckoutResponse
+	(*CheckoutBatchRequest)(nil),  // 3: pmserver.v1.CheckoutBatchRequest
+	(*CheckoutBatchResponse)(nil), // 4: pmserver.v1.CheckoutBatchResponse
+	(*Outcome)(nil),               // 5: pmserver.v1.Outcome
+	(*ReportBatchRequest)(nil),    // 6: pmserver.v1.ReportBatchRequest
+	(*ReportResponse)(nil),        // 7: pmserver.v1.ReportResponse
+	(*ListScrapersRequest)(nil),   // 8: pmserver.v1.ListScrapersRequest
+	(*ListScrapersResponse)(nil),  // 9: pmserver.v1.ListScrapersResponse
+	(*GetPoolRequest)(nil),        // 10: pmserver.v1.GetPoolRequest
+	(*Pool)(nil),                  // 11: pmserver.v1.Pool
+	(*Quota)(nil),                 // 12: pmserver.v1.Quota
+	(*Circuit)(nil),               // 13: pmserver.v1.Circuit
+	(*ListProxiesRequest)(nil),    // 14: pmserver.v1.ListProxiesRequest
+	(*ListProxiesResponse)(nil),   // 15: pmserver.v1.ListProxiesResponse
+}
+var file_pmserver_proto_depIdxs = []int32{
+	0,  // 0: pmserver.v1.CheckoutRequest.selection:type_name -> pmserver.v1.Selection
+	0,  // 1: pmserver.v1.CheckoutBatchRequest.selection:type_name -> pmserver.v1.Selection
+	5,  // 2: pmserver.v1.ReportBatchRequest.outcomes:type_name -> pmserver.v1.Outcome
+	12, // 3: pmserver.v1.Pool.quota:type_name -> pmserver.v1.Quota
+	13, // 4: pmserver.v1.Pool.circuit:type_name -> pmserver.v1.Circuit
+	1,  // 5: pmserver.v1.Pmserver.Checkout:input_type -> pmserver.v1.CheckoutRequest
+	3,  // 6: pmserver.v1.Pmserver.CheckoutBatch:input_type -> pmserver.v1.CheckoutBatchRequest
+	5,  // 7: pmserver.v1.Pmserver.Report:input_type -> pmserver.v1.Outcome
+	6,  // 8: pmserver.v1.Pmserver.ReportBatch:input_type -> pmserver.v1.ReportBatchRequest
+	5,  // 9: pmserver.v1.Pmserver.ReportStream:input_type -> pmserver.v1.Outcome
+	8,  // 10: pmserver.v1.Pmserver.ListScrapers:input_type -> pmserver.v1.ListScrapersRequest
+	10, // 11: pmserver.v1.Pmserver.GetPool:input_type -> pmserver.v1.GetPoolRequest
+	14, // 12: pmserver.v1.Pmserver.ListProxies:input_type -> pmserver.v1.ListProxiesRequest
+	2,  // 13: pmserver.v1.Pmserver.Checkout:output_type -> pmserver.v1.CheckoutResponse
+	4,  // 14: pmserver.v1.Pmserver.CheckoutBatch:output_type -> pmserver.v1.CheckoutBatchResponse
+	7,  // 15: pmserver.v1.Pmserver.Report:output_type -> pmserver.v1.ReportResponse
+	7,  // 16: pmserver.v1.Pmserver.ReportBatch:output_type -> pmserver.v1.ReportResponse
+	7,  // 17: pmserver.v1.Pmserver.ReportStream:output_type -> pmserver.v1.ReportResponse
+	9,  // 18: pmserver.v1.Pmserver.ListScrapers:output_type -> pmserver.v1.ListScrapersResponse
+	11, // 19: pmserver.v1.Pmserver.GetPool:output_type -> pmserver.v1.Pool
+	15, // 20: pmserver.v1.Pmserver.ListProxies:output_type -> pmserver.v1.ListProxiesResponse
+	13, // [13:21] is the sub-list for method output_type
+	5,  // [5:13] is the sub-list for method input_type
+	5,  // [5:5] is the sub-list for extension type_name
+	5,  // [5:5] is the sub-list for extension extendee
+	0,  // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_pmserver_proto_init() }
+func file_pmserver_proto_init() {
+	if File_pmserver_proto != nil {
+		return
+	}
+	file_pmserver_proto_msgTypes[5].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_pmserver_proto_rawDesc), len(file_pmserver_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   16,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_pmserver_proto_goTypes,
+		DependencyIndexes: file_pmserver_proto_depIdxs,
+		MessageInfos:      file_pmserver_proto_msgTypes,
+	}.Build()
+	File_pmserver_proto = out.File
+	file_pmserver_proto_goTypes = nil
+	file_pmserver_proto_depIdxs = nil
+}
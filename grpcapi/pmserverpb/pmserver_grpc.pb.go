@@ -0,0 +1,409 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: pmserver.proto
+
+package pmserverpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Pmserver_Checkout_FullMethodName      = "/pmserver.v1.Pmserver/Checkout"
+	Pmserver_CheckoutBatch_FullMethodName = "/pmserver.v1.Pmserver/CheckoutBatch"
+	Pmserver_Report_FullMethodName        = "/pmserver.v1.Pmserver/Report"
+	Pmserver_ReportBatch_FullMethodName   = "/pmserver.v1.Pmserver/ReportBatch"
+	Pmserver_ReportStream_FullMethodName  = "/pmserver.v1.Pmserver/ReportStream"
+	Pmserver_ListScrapers_FullMethodName  = "/pmserver.v1.Pmserver/ListScrapers"
+	Pmserver_GetPool_FullMethodName       = "/pmserver.v1.Pmserver/GetPool"
+	Pmserver_ListProxies_FullMethodName   = "/pmserver.v1.Pmserver/ListProxies"
+)
+
+// PmserverClient is the client API for Pmserver service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Pmserver hands out proxies of scrapers and takes reports how they worked,
+// the same pools as the HTTP API.
+type PmserverClient interface {
+	// Checkout hands out one proxy.
+	// NOT_FOUND for unknown scraper, RESOURCE_EXHAUSTED over quota,
+	// FAILED_PRECONDITION with open circuit, UNAVAILABLE with no proxy available.
+	Checkout(ctx context.Context, in *CheckoutRequest, opts ...grpc.CallOption) (*CheckoutResponse, error)
+	// CheckoutBatch hands out up to count proxies, fewer if the pool runs out.
+	// Fails the same way as Checkout only if no proxy was handed out.
+	CheckoutBatch(ctx context.Context, in *CheckoutBatchRequest, opts ...grpc.CallOption) (*CheckoutBatchResponse, error)
+	// Report tells outcome of using proxy.
+	Report(ctx context.Context, in *Outcome, opts ...grpc.CallOption) (*ReportResponse, error)
+	// ReportBatch checks every outcome first and applies them in order only if all are valid.
+	ReportBatch(ctx context.Context, in *ReportBatchRequest, opts ...grpc.CallOption) (*ReportResponse, error)
+	// ReportStream applies outcomes as they come, stopping at the first invalid one.
+	ReportStream(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Outcome, ReportResponse], error)
+	// ListScrapers returns registered scrapers.
+	ListScrapers(ctx context.Context, in *ListScrapersRequest, opts ...grpc.CallOption) (*ListScrapersResponse, error)
+	// GetPool returns sizes of the pool of scraper with its quota and circuit.
+	GetPool(ctx context.Context, in *GetPoolRequest, opts ...grpc.CallOption) (*Pool, error)
+	// ListProxies returns proxies of scraper with given status.
+	ListProxies(ctx context.Context, in *ListProxiesRequest, opts ...grpc.CallOption) (*ListProxiesResponse, error)
+}
+
+type pmserverClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPmserverClient(cc grpc.ClientConnInterface) PmserverClient {
+	return &pmserverClient{cc}
+}
+
+func (c *pmserverClient) Checkout(ctx context.Context, in *CheckoutRequest, opts ...grpc.CallOption) (*CheckoutResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CheckoutResponse)
+	err := c.cc.Invoke(ctx, Pmserver_Checkout_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pmserverClient) CheckoutBatch(ctx context.Context, in *CheckoutBatchRequest, opts ...grpc.CallOption) (*CheckoutBatchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CheckoutBatchResponse)
+	err := c.cc.Invoke(ctx, Pmserver_CheckoutBatch_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pmserverClient) Report(ctx context.Context, in *Outcome, opts ...grpc.CallOption) (*ReportResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReportResponse)
+	err := c.cc.Invoke(ctx, Pmserver_Report_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pmserverClient) ReportBatch(ctx context.Context, in *ReportBatchRequest, opts ...grpc.CallOption) (*ReportResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ReportResponse)
+	err := c.cc.Invoke(ctx, Pmserver_ReportBatch_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pmserverClient) ReportStream(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Outcome, ReportResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Pmserver_ServiceDesc.Streams[0], Pmserver_ReportStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[Outcome, ReportResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Pmserver_ReportStreamClient = grpc.ClientStreamingClient[Outcome, ReportResponse]
+
+func (c *pmserverClient) ListScrapers(ctx context.Context, in *ListScrapersRequest, opts ...grpc.CallOption) (*ListScrapersResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListScrapersResponse)
+	err := c.cc.Invoke(ctx, Pmserver_ListScrapers_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pmserverClient) GetPool(ctx context.Context, in *GetPoolRequest, opts ...grpc.CallOption) (*Pool, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Pool)
+	err := c.cc.Invoke(ctx, Pmserver_GetPool_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *pmserverClient) ListProxies(ctx context.Context, in *ListProxiesRequest, opts ...grpc.CallOption) (*ListProxiesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListProxiesResponse)
+	err := c.cc.Invoke(ctx, Pmserver_ListProxies_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PmserverServer is the server API for Pmserver service.
+// All implementations must embed UnimplementedPmserverServer
+// for forward compatibility.
+//
+// Pmserver hands out proxies of scrapers and takes reports how they worked,
+// the same pools as the HTTP API.
+type PmserverServer interface {
+	// Checkout hands out one proxy.
+	// NOT_FOUND for unknown scraper, RESOURCE_EXHAUSTED over quota,
+	// FAILED_PRECONDITION with open circuit, UNAVAILABLE with no proxy available.
+	Checkout(context.Context, *CheckoutRequest) (*CheckoutResponse, error)
+	// CheckoutBatch hands out up to count proxies, fewer if the pool runs out.
+	// Fails the same way as Checkout only if no proxy was handed out.
+	CheckoutBatch(context.Context, *CheckoutBatchRequest) (*CheckoutBatchResponse, error)
+	// Report tells outcome of using proxy.
+	Report(context.Context, *Outcome) (*ReportResponse, error)
+	// ReportBatch checks every outcome first and applies them in order only if all are valid.
+	ReportBatch(context.Context, *ReportBatchRequest) (*ReportResponse, error)
+	// ReportStream applies outcomes as they come, stopping at the first invalid one.
+	ReportStream(grpc.ClientStreamingServer[Outcome, ReportResponse]) error
+	// ListScrapers returns registered scrapers.
+	ListScrapers(context.Context, *ListScrapersRequest) (*ListScrapersResponse, error)
+	// GetPool returns sizes of the pool of scraper with its quota and circuit.
+	GetPool(context.Context, *GetPoolRequest) (*Pool, error)
+	// ListProxies returns proxies of scraper with given status.
+	ListProxies(context.Context, *ListProxiesRequest) (*ListProxiesResponse, error)
+	mustEmbedUnimplementedPmserverServer()
+}
+
+// UnimplementedPmserverServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedPmserverServer struct{}
+
+func (UnimplementedPmserverServer) Checkout(context.Context, *CheckoutRequest) (*CheckoutResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Checkout not implemented")
+}
+func (UnimplementedPmserverServer) CheckoutBatch(context.Context, *CheckoutBatchRequest) (*CheckoutBatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CheckoutBatch not implemented")
+}
+func (UnimplementedPmserverServer) Report(context.Context, *Outcome) (*ReportResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Report not implemented")
+}
+func (UnimplementedPmserverServer) ReportBatch(context.Context, *ReportBatchRequest) (*ReportResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReportBatch not implemented")
+}
+func (UnimplementedPmserverServer) ReportStream(grpc.ClientStreamingServer[Outcome, ReportResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method ReportStream not implemented")
+}
+func (UnimplementedPmserverServer) ListScrapers(context.Context, *ListScrapersRequest) (*ListScrapersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListScrapers not implemented")
+}
+func (UnimplementedPmserverServer) GetPool(context.Context, *GetPoolRequest) (*Pool, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPool not implemented")
+}
+func (UnimplementedPmserverServer) ListProxies(context.Context, *ListProxiesRequest) (*ListProxiesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListProxies not implemented")
+}
+func (UnimplementedPmserverServer) mustEmbedUnimplementedPmserverServer() {}
+func (UnimplementedPmserverServer) testEmbeddedByValue()                  {}
+
+// UnsafePmserverServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PmserverServer will
+// result in compilation errors.
+type UnsafePmserverServer interface {
+	mustEmbedUnimplementedPmserverServer()
+}
+
+func RegisterPmserverServer(s grpc.ServiceRegistrar, srv PmserverServer) {
+	// If the following call pancis, it indicates UnimplementedPmserverServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Pmserver_ServiceDesc, srv)
+}
+
+func _Pmserver_Checkout_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckoutRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PmserverServer).Checkout(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Pmserver_Checkout_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PmserverServer).Checkout(ctx, req.(*CheckoutRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Pmserver_CheckoutBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckoutBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PmserverServer).CheckoutBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Pmserver_CheckoutBatch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PmserverServer).CheckoutBatch(ctx, req.(*CheckoutBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Pmserver_Report_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Outcome)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PmserverServer).Report(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Pmserver_Report_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PmserverServer).Report(ctx, req.(*Outcome))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Pmserver_ReportBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReportBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PmserverServer).ReportBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Pmserver_ReportBatch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PmserverServer).ReportBatch(ctx, req.(*ReportBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Pmserver_ReportStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(PmserverServer).ReportStream(&grpc.GenericServerStream[Outcome, ReportResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Pmserver_ReportStreamServer = grpc.ClientStreamingServer[Outcome, ReportResponse]
+
+func _Pmserver_ListScrapers_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListScrapersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PmserverServer).ListScrapers(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Pmserver_ListScrapers_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PmserverServer).ListScrapers(ctx, req.(*ListScrapersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Pmserver_GetPool_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPoolRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PmserverServer).GetPool(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Pmserver_GetPool_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PmserverServer).GetPool(ctx, req.(*GetPoolRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Pmserver_ListProxies_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListProxiesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PmserverServer).ListProxies(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Pmserver_ListProxies_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PmserverServer).ListProxies(ctx, req.(*ListProxiesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Pmserver_ServiceDesc is the grpc.ServiceDesc for Pmserver service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Pmserver_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pmserver.v1.Pmserver",
+	HandlerType: (*PmserverServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Checkout",
+			Handler:    _Pmserver_Checkout_Handler,
+		},
+		{
+			MethodName: "CheckoutBatch",
+			Handler:    _Pmserver_CheckoutBatch_Handler,
+		},
+		{
+			MethodName: "Report",
+			Handler:    _Pmserver_Report_Handler,
+		},
+		{
+			MethodName: "ReportBatch",
+			Handler:    _Pmserver_ReportBatch_Handler,
+		},
+		{
+			MethodName: "ListScrapers",
+			Handler:    _Pmserver_ListScrapers_Handler,
+		},
+		{
+			MethodName: "GetPool",
+			Handler:    _Pmserver_GetPool_Handler,
+		},
+		{
+			MethodName: "ListProxies",
+			Handler:    _Pmserver_ListProxies_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ReportStream",
+			Handler:       _Pmserver_ReportStream_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "pmserver.proto",
+}
@@ -0,0 +1,309 @@
+// Package grpcapi serves proxy pools over gRPC alongside the HTTP API
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+	"github.com/AlexeyYurko/go-pmserver/db"
+	"github.com/AlexeyYurko/go-pmserver/grpcapi/pmserverpb"
+	"github.com/AlexeyYurko/go-pmserver/manager"
+)
+
+const defaultMaxBatch = 1000
+
+// Server implements pmserverpb.PmserverServer with the same manager functions as the HTTP API
+type Server struct {
+	pmserverpb.UnimplementedPmserverServer
+
+	Listen string
+	// MaxBatch limits proxies taken and outcomes reported in one call
+	MaxBatch int
+}
+
+// New creates gRPC server listening on address
+func New(listen string) *Server {
+	return &Server{Listen: listen, MaxBatch: defaultMaxBatch}
+}
+
+// NewFromConfig creates gRPC server with settings from config.yml
+func NewFromConfig() *Server {
+	s := New(config.GRPCListen)
+	if config.GRPCMaxBatch > 0 {
+		s.MaxBatch = config.GRPCMaxBatch
+	}
+	return s
+}
+
+// ListenAndServe accepts client connections until the listener fails
+func (s *Server) ListenAndServe() error {
+	listener, err := net.Listen("tcp", s.Listen)
+	if err != nil {
+		return err
+	}
+	log.Info().Str("listen", s.Listen).Msg("gRPC server started")
+	server := grpc.NewServer()
+	pmserverpb.RegisterPmserverServer(server, s)
+	return server.Serve(listener)
+}
+
+// Checkout hands out one proxy of scraper
+func (s *Server) Checkout(_ context.Context, request *pmserverpb.CheckoutRequest) (*pmserverpb.CheckoutResponse, error) {
+	selection, err := s.checkoutOf(request.GetScraper(), request.GetSelection())
+	if err != nil {
+		return nil, err
+	}
+	proxy, err := manager.GetRandomProxy(request.GetScraper(), selection)
+	if err != nil {
+		return nil, checkoutError(request.GetScraper(), err)
+	}
+	return &pmserverpb.CheckoutResponse{Proxy: proxy}, nil
+}
+
+// CheckoutBatch hands out up to count proxies of scraper, fewer if the pool runs out
+func (s *Server) CheckoutBatch(_ context.Context, request *pmserverpb.CheckoutBatchRequest) (*pmserverpb.CheckoutBatchResponse, error) {
+	count := int(request.GetCount())
+	if count < 1 || count > s.MaxBatch {
+		return nil, status.Errorf(codes.InvalidArgument, "count should be from 1 to %d", s.MaxBatch)
+	}
+	selection, err := s.checkoutOf(request.GetScraper(), request.GetSelection())
+	if err != nil {
+		return nil, err
+	}
+
+	proxies := make([]string, 0, count)
+	for len(proxies) < count {
+		proxy, err := manager.GetRandomProxy(request.GetScraper(), selection)
+		if err != nil {
+			if len(proxies) == 0 {
+				return nil, checkoutError(request.GetScraper(), err)
+			}
+			break
+		}
+		proxies = append(proxies, proxy)
+	}
+	return &pmserverpb.CheckoutBatchResponse{Proxies: proxies}, nil
+}
+
+// checkoutOf checks scraper, registering it with auto-create-scrapers, and converts selection
+func (s *Server) checkoutOf(scraper string, selection *pmserverpb.Selection) (manager.Selection, error) {
+	if err := knownScraper(scraper, config.AutoCreateScrapers); err != nil {
+		return manager.Selection{}, err
+	}
+	return selectionOf(selection)
+}
+
+// selectionOf converts selection checking it the same way as query of /get-random
+func selectionOf(selection *pmserverpb.Selection) (manager.Selection, error) {
+	if selection.GetMaxLatency() < 0 {
+		return manager.Selection{}, status.Error(codes.InvalidArgument, "max_latency is negative")
+	}
+	if anonymity := selection.GetAnonymity(); anonymity != "" && !db.ValidAnonymity(anonymity) {
+		return manager.Selection{}, status.Error(codes.InvalidArgument, "anonymity should be transparent, anonymous or elite")
+	}
+	return manager.Selection{
+		MaxLatency:     selection.GetMaxLatency(),
+		RequireLatency: selection.GetRequireLatency(),
+		MinAnonymity:   selection.GetAnonymity(),
+		Domain:         manager.NormalizeDomain(selection.GetDomain()),
+	}, nil
+}
+
+// checkoutError translates error of GetRandomProxy to status
+func checkoutError(scraper string, err error) error {
+	switch {
+	case errors.Is(err, manager.ErrQuotaExceeded):
+		return status.Errorf(codes.ResourceExhausted, "quota of scraper %s exceeded", scraper)
+	case errors.Is(err, manager.ErrCircuitOpen):
+		return status.Errorf(codes.FailedPrecondition, "circuit of scraper %s is open", scraper)
+	}
+	return status.Errorf(codes.Unavailable, "no proxy available for scraper %s", scraper)
+}
+
+// Report applies outcome of using proxy
+func (s *Server) Report(_ context.Context, outcome *pmserverpb.Outcome) (*pmserverpb.ReportResponse, error) {
+	if err := checkOutcome(outcome); err != nil {
+		return nil, err
+	}
+	return report([]*pmserverpb.Outcome{outcome}), nil
+}
+
+// ReportBatch applies outcomes in order if every one of them is valid
+func (s *Server) ReportBatch(_ context.Context, request *pmserverpb.ReportBatchRequest) (*pmserverpb.ReportResponse, error) {
+	outcomes := request.GetOutcomes()
+	if len(outcomes) > s.MaxBatch {
+		return nil, status.Errorf(codes.InvalidArgument, "more than %d outcomes", s.MaxBatch)
+	}
+	for i, outcome := range outcomes {
+		if err := checkOutcome(outcome); err != nil {
+			return nil, status.Errorf(status.Code(err), "outcome %d: %s", i, status.Convert(err).Message())
+		}
+	}
+	return report(outcomes), nil
+}
+
+// ReportStream applies outcomes as they come until the stream ends or an outcome is invalid
+func (s *Server) ReportStream(stream grpc.ClientStreamingServer[pmserverpb.Outcome, pmserverpb.ReportResponse]) error {
+	response := &pmserverpb.ReportResponse{}
+	for {
+		outcome, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return stream.SendAndClose(response)
+		}
+		if err != nil {
+			return err
+		}
+		if err = checkOutcome(outcome); err != nil {
+			// outcomes before the invalid one stay applied, its index tells how many
+			return status.Errorf(status.Code(err), "outcome %d: %s", len(response.Results), status.Convert(err).Message())
+		}
+		reported := report([]*pmserverpb.Outcome{outcome})
+		response.Applied += reported.Applied
+		response.Results = append(response.Results, reported.Results...)
+	}
+}
+
+// checkOutcome checks outcome the same way as /inc-good-attempts and /mark-dead
+func checkOutcome(outcome *pmserverpb.Outcome) error {
+	if outcome.GetScraper() == "" || outcome.GetProxy() == "" {
+		return status.Error(codes.InvalidArgument, "scraper or proxy is empty")
+	}
+	if err := knownScraper(outcome.GetScraper(), false); err != nil {
+		return err
+	}
+	if outcome.GetFailed() && !manager.ValidReason(outcome.GetReason()) {
+		return status.Error(codes.InvalidArgument, "reason should be one of "+strings.Join(manager.FailureReasons, ", "))
+	}
+	if outcome.Latency != nil && outcome.GetLatency() < 0 {
+		return status.Error(codes.InvalidArgument, "latency is negative")
+	}
+	return nil
+}
+
+// report applies checked outcomes in order with manager.ReportOutcomes, outcomes of the same scraper
+// coming one after another go in one call
+func report(outcomes []*pmserverpb.Outcome) *pmserverpb.ReportResponse {
+	response := &pmserverpb.ReportResponse{Results: make([]string, 0, len(outcomes))}
+	for start := 0; start < len(outcomes); {
+		scraper := outcomes[start].GetScraper()
+		end := start + 1
+		for end < len(outcomes) && outcomes[end].GetScraper() == scraper {
+			end++
+		}
+		batch := make([]manager.Outcome, 0, end-start)
+		for _, outcome := range outcomes[start:end] {
+			batch = append(batch, outcomeOf(outcome))
+		}
+		for _, result := range manager.ReportOutcomes(scraper, batch) {
+			if result == manager.OutcomeApplied {
+				response.Applied++
+			}
+			response.Results = append(response.Results, result)
+		}
+		start = end
+	}
+	return response
+}
+
+// outcomeOf converts outcome to the one of manager, latency is negative if not measured
+func outcomeOf(outcome *pmserverpb.Outcome) manager.Outcome {
+	latency := -1.0
+	if outcome.Latency != nil {
+		latency = outcome.GetLatency()
+	}
+	return manager.Outcome{
+		Proxy:   outcome.GetProxy(),
+		Failed:  outcome.GetFailed(),
+		Reason:  outcome.GetReason(),
+		Latency: latency,
+		Domain:  outcome.GetDomain(),
+	}
+}
+
+// ListScrapers returns registered scrapers sorted by name
+func (s *Server) ListScrapers(context.Context, *pmserverpb.ListScrapersRequest) (*pmserverpb.ListScrapersResponse, error) {
+	scrapers := db.Scrapers()
+	sort.Strings(scrapers)
+	return &pmserverpb.ListScrapersResponse{Scrapers: scrapers}, nil
+}
+
+// GetPool returns sizes of the pool of scraper with its quota and circuit
+func (s *Server) GetPool(_ context.Context, request *pmserverpb.GetPoolRequest) (*pmserverpb.Pool, error) {
+	scraper := request.GetScraper()
+	if err := knownScraper(scraper, false); err != nil {
+		return nil, err
+	}
+
+	busy := db.Set.BusySize(scraper)
+	quota := manager.UsageOfQuota(scraper)
+	circuit := manager.CircuitOf(scraper)
+	return &pmserverpb.Pool{
+		Scraper:   scraper,
+		Available: int32(db.Set.AvailableSize(scraper)),
+		Busy:      int32(busy),
+		Postponed: int32(db.Set.BusyAndPostponedSize(scraper) - busy),
+		Unchecked: int32(len(db.Set.GetUnchecked(scraper))),
+		Dead:      int32(len(db.Set.GetDead(scraper))),
+		Quota: &pmserverpb.Quota{
+			Busy:         int32(quota.Busy),
+			MaxBusy:      int32(quota.MaxBusy),
+			PerMinute:    int32(quota.PerMinute),
+			MaxPerMinute: int32(quota.MaxPerMinute),
+			Rejected:     int32(quota.Rejected),
+		},
+		Circuit: &pmserverpb.Circuit{
+			State:       circuit.State,
+			Since:       circuit.Since,
+			WindowStart: circuit.WindowStart,
+			Successes:   int32(circuit.Successes),
+			Failures:    int32(circuit.Failures),
+		},
+	}, nil
+}
+
+// ListProxies returns working or dead proxies of scraper sorted
+func (s *Server) ListProxies(_ context.Context, request *pmserverpb.ListProxiesRequest) (*pmserverpb.ListProxiesResponse, error) {
+	scraper := request.GetScraper()
+	if err := knownScraper(scraper, false); err != nil {
+		return nil, err
+	}
+
+	var proxies []string
+	switch request.GetStatus() {
+	case "", "working":
+		proxies = db.Set.GetWorking(scraper)
+	case "dead":
+		proxies = db.Set.GetDead(scraper)
+	default:
+		return nil, status.Error(codes.InvalidArgument, "status should be working or dead")
+	}
+	sort.Strings(proxies)
+	return &pmserverpb.ListProxiesResponse{Proxies: proxies}, nil
+}
+
+// knownScraper checks scraper is registered, registering unknown one if autoCreate is set
+func knownScraper(scraper string, autoCreate bool) error {
+	if scraper == "" {
+		return status.Error(codes.InvalidArgument, "scraper is empty")
+	}
+	if db.ScraperExists(scraper) {
+		return nil
+	}
+	if autoCreate {
+		if err := db.AddScraper(scraper); err == nil || errors.Is(err, db.ErrScraperExists) {
+			log.Info().Str("scraper", scraper).Msg("Scraper registered on first use")
+			return nil
+		}
+	}
+	return status.Errorf(codes.NotFound, "unknown scraper %s", scraper)
+}
@@ -0,0 +1,112 @@
+package grpcapi
+
+import (
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+	"github.com/AlexeyYurko/go-pmserver/db"
+	"github.com/AlexeyYurko/go-pmserver/grpcapi/pmserverpb"
+)
+
+// dial serves New over in-memory connection and returns client of it
+func dial(t *testing.T) pmserverpb.PmserverClient {
+	t.Helper()
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	pmserverpb.RegisterPmserverServer(server, New(""))
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return pmserverpb.NewPmserverClient(conn)
+}
+
+// setupPool stores one good and one dead proxy for scraper
+func setupPool(t *testing.T) {
+	t.Helper()
+	config.Scrapers = []string{"shop"}
+	config.Groups = nil
+	config.ProxyrackProxyIP = []string{"9.9.9.9"}
+	db.Init()
+	db.StoreProxies("", []string{"1.1.1.1:80", "2.2.2.2:80"})
+	db.Set.Dead("shop", "2.2.2.2:80")
+}
+
+func TestReportResults(t *testing.T) {
+	setupPool(t)
+	client := dial(t)
+	ctx := context.Background()
+
+	response, err := client.Report(ctx, &pmserverpb.Outcome{Scraper: "shop", Proxy: "5.5.5.5:80"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.GetApplied() != 0 || !slices.Equal(response.GetResults(), []string{"unknown_proxy"}) {
+		t.Errorf("Report of unknown proxy = %d %v, want 0 [unknown_proxy]", response.GetApplied(), response.GetResults())
+	}
+
+	response, err = client.ReportBatch(ctx, &pmserverpb.ReportBatchRequest{Outcomes: []*pmserverpb.Outcome{
+		{Scraper: "shop", Proxy: "1.1.1.1:80"},
+		{Scraper: "shop", Proxy: "2.2.2.2:80"},
+		{Scraper: "shop", Proxy: "5.5.5.5:80"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"applied", "ignored", "unknown_proxy"}
+	if response.GetApplied() != 1 || !slices.Equal(response.GetResults(), want) {
+		t.Errorf("ReportBatch = %d %v, want 1 %v", response.GetApplied(), response.GetResults(), want)
+	}
+}
+
+func TestReportStreamResults(t *testing.T) {
+	setupPool(t)
+	client := dial(t)
+
+	stream, err := client.ReportStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, proxy := range []string{"2.2.2.2:80", "1.1.1.1:80"} {
+		if err = stream.Send(&pmserverpb.Outcome{Scraper: "shop", Proxy: proxy}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	response, err := stream.CloseAndRecv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"ignored", "applied"}
+	if response.GetApplied() != 1 || !slices.Equal(response.GetResults(), want) {
+		t.Errorf("ReportStream = %d %v, want 1 %v", response.GetApplied(), response.GetResults(), want)
+	}
+
+	stream, err = client.ReportStream(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = stream.Send(&pmserverpb.Outcome{Scraper: "shop", Proxy: "5.5.5.5:80"})
+	_ = stream.Send(&pmserverpb.Outcome{Scraper: "shop", Proxy: "1.1.1.1:80", Failed: true, Reason: "nonsense"})
+	_, err = stream.CloseAndRecv()
+	if status.Code(err) != codes.InvalidArgument || !strings.HasPrefix(status.Convert(err).Message(), "outcome 1:") {
+		t.Errorf("ReportStream with invalid second outcome: err = %v, want InvalidArgument of outcome 1", err)
+	}
+}
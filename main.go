@@ -4,7 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -19,11 +19,16 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
+	"github.com/AlexeyYurko/go-pmserver/blocklist"
+	"github.com/AlexeyYurko/go-pmserver/checker"
 	"github.com/AlexeyYurko/go-pmserver/config"
 	"github.com/AlexeyYurko/go-pmserver/db"
+	"github.com/AlexeyYurko/go-pmserver/forward"
+	"github.com/AlexeyYurko/go-pmserver/grpcapi"
 	"github.com/AlexeyYurko/go-pmserver/manager"
 	stats "github.com/AlexeyYurko/go-pmserver/metrics"
 	"github.com/AlexeyYurko/go-pmserver/now"
+	"github.com/AlexeyYurko/go-pmserver/source"
 )
 
 const (
@@ -31,10 +36,28 @@ const (
 	hoursInDay      = 24
 	minsInHour      = 60
 	secsInMinute    = 60
+
+	defaultScheduleAttempts = "10"
+	maxScheduleAttempts     = 100
 )
 
+var proxySource *source.Fetcher
+
+var statsOrders = []string{"name", "sdate", "success", "fdate", "fail", "latency"}
+
 func runSetup() {
 	config.ParseConfig()
+	if err := manager.CheckBackoffConfig(); err != nil {
+		log.Fatal().Err(err).Msg("Wrong backoff config")
+	}
+	if err := blocklist.Init(); err != nil {
+		log.Fatal().Err(err).Msg("Wrong blocklist config")
+	}
+	proxySource = source.NewFetcher(config.ResourceLink, config.ProxyListUsername, config.ProxyListPassword,
+		time.Duration(config.ProxyListTimeout)*time.Second)
+	proxySource.Retries = config.ProxyListRetries
+	proxySource.RetryBackoff = time.Duration(config.ProxyListRetryBackoff) * time.Second
+	proxySource.MaxShrinkPercent = config.ProxyListMaxShrinkPercent
 	db.Init()
 	db.Load()
 	reloadProxies()
@@ -72,6 +95,33 @@ func main() {
 		}
 	}()
 
+	if config.ForwardProxyEnabled {
+		forwardProxy, err := forward.NewFromConfig()
+		if err != nil {
+			log.Fatal().Err(err).Msg("Wrong forward proxy rules")
+		}
+		go func() {
+			if err := forwardProxy.ListenAndServe(); err != nil {
+				log.Fatal().Err(err).Msg("Failed to start forward proxy")
+			}
+		}()
+		if config.ForwardProxySOCKSListen != "" {
+			go func() {
+				if err := forwardProxy.ListenAndServeSOCKS(); err != nil {
+					log.Fatal().Err(err).Msg("Failed to start SOCKS5 proxy")
+				}
+			}()
+		}
+	}
+
+	if config.GRPCEnabled {
+		go func() {
+			if err := grpcapi.NewFromConfig().ListenAndServe(); err != nil {
+				log.Fatal().Err(err).Msg("Failed to start gRPC server")
+			}
+		}()
+	}
+
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
@@ -102,6 +152,10 @@ func executeCronJob() {
 	checkErrCron(err, "returnPostponedWithCondition", config.ReturnPostponedTime)
 	_, err = scheduler.Every(config.SaveToMongoTime).Seconds().Do(db.Save)
 	checkErrCron(err, "saveToMongo", config.SaveToMongoTime)
+	if config.CheckerEnabled {
+		_, err = scheduler.Every(config.CheckProxiesTime).Seconds().Do(checker.NewFromConfig().Run)
+		checkErrCron(err, "checkProxies", config.CheckProxiesTime)
+	}
 	scheduler.StartAsync()
 }
 
@@ -109,9 +163,12 @@ func setupRouter() *gin.Engine {
 	router := gin.Default()
 	router.Use(stats.RequestStats())
 	router.GET("/", indexPage)
+	router.GET("/openapi.yaml", routeOpenAPI)
+	router.GET("/echo", echo)
 	router.GET("/get-random", routeGetRandom)
 	router.GET("/inc-good-attempts", routeIncGoodAttempts)
 	router.GET("/mark-dead", routeMarkDead)
+	router.POST("/report-outcomes", routeReportOutcomes)
 	router.GET("/reanimate", routeReanimate)
 	router.GET("/start", start)
 	router.GET("/alive-from-dead", routeAliveFromDead)
@@ -123,11 +180,25 @@ func setupRouter() *gin.Engine {
 	router.GET("/get-dead-list", getDeadList)
 	router.GET("/get-proxy-usefulness-stats", getProxyUsefulnessStats)
 	router.GET("/clear-usefulness-stats", routeClearUsefulnessStats)
+	router.GET("/backoff-schedule", routeBackoffSchedule)
+	router.GET("/get-policy", routeGetPolicy)
+	router.GET("/get-quota", routeGetQuota)
+	router.GET("/get-circuit", routeGetCircuit)
 	router.GET("/zstats", showStatsForZabbix)
 	router.GET("/hstats", showHTMLStats)
 	router.GET("/stats", metrics)
+	router.GET("/events", routeEvents)
+	router.GET("/events/ws", routeEventsWebSocket)
 	router.POST("/add-proxies", routeAddProxies)
 	router.POST("/remove-proxies", routeRemoveProxies)
+	router.GET("/list-scrapers", routeListScrapers)
+	router.POST("/add-scraper", routeAddScraper)
+	router.POST("/rename-scraper", routeRenameScraper)
+	router.POST("/delete-scraper", routeDeleteScraper)
+	router.GET("/list-proxy-actions", routeListProxyActions)
+	router.POST("/proxy-action", routeProxyAction)
+	router.POST("/release-proxy", routeReleaseProxy)
+	setupRouterV2(router)
 
 	return router
 }
@@ -140,24 +211,74 @@ func indexPage(c *gin.Context) {
 	c.String(http.StatusOK, "PMServer - GO version - Hello")
 }
 
+// echo tells the caller from which ip and with which headers its request came,
+// proxies are sent here by checker to find out their exit ip and anonymity
+func echo(c *gin.Context) {
+	ip, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		ip = c.Request.RemoteAddr
+	}
+
+	c.JSON(http.StatusOK, checker.EchoResponse{IP: ip, Headers: c.Request.Header})
+}
+
 func routeGetRandom(context *gin.Context) {
 	scraper := context.Query("scraper")
 
-	if scraper == "" {
-		context.String(http.StatusForbidden, "Field scraper is empty")
+	if !scraperRegistered(context, scraper, config.AutoCreateScrapers) {
+		return
+	}
+
+	selection, err := selectionFromQuery(context)
+	if err != nil {
+		context.String(http.StatusForbidden, err.Error())
 
 		return
 	}
 
-	randomProxy, err := manager.GetRandomProxy(scraper)
+	randomProxy, err := manager.GetRandomProxy(scraper, selection)
 
-	if err != nil {
+	switch {
+	case errors.Is(err, manager.ErrQuotaExceeded):
+		context.String(http.StatusTooManyRequests, "Quota exceeded")
+	case errors.Is(err, manager.ErrCircuitOpen):
+		context.String(http.StatusServiceUnavailable, "Circuit open")
+	case err != nil:
 		context.String(http.StatusNoContent, "")
-	} else {
+	default:
 		context.String(http.StatusOK, randomProxy)
 	}
 }
 
+// selectionFromQuery reads max_latency, latency_mode, anonymity and domain of get random proxy request
+func selectionFromQuery(context *gin.Context) (selection manager.Selection, err error) {
+	if maxLatency := context.Query("max_latency"); maxLatency != "" {
+		value, parseErr := strconv.ParseFloat(maxLatency, 64)
+		if parseErr != nil || value < 0 {
+			return selection, errors.New("Field max_latency is not a positive number")
+		}
+
+		selection.MaxLatency = value
+	}
+
+	switch context.DefaultQuery("latency_mode", "prefer") {
+	case "prefer":
+	case "require":
+		selection.RequireLatency = true
+	default:
+		return selection, errors.New("Field latency_mode should be prefer or require")
+	}
+
+	selection.MinAnonymity = context.Query("anonymity")
+	if selection.MinAnonymity != "" && !db.ValidAnonymity(selection.MinAnonymity) {
+		return selection, errors.New("Field anonymity should be transparent, anonymous or elite")
+	}
+
+	selection.Domain = manager.NormalizeDomain(context.Query("domain"))
+
+	return selection, nil
+}
+
 func routeIncGoodAttempts(context *gin.Context) {
 	scraper := context.Query("scraper")
 	proxy := context.Query("proxy")
@@ -168,7 +289,30 @@ func routeIncGoodAttempts(context *gin.Context) {
 		return
 	}
 
+	if !scraperRegistered(context, scraper, false) {
+		return
+	}
+
+	var latency float64 = -1
+
+	if reported := context.Query("latency"); reported != "" {
+		value, err := strconv.ParseFloat(reported, 64)
+		if err != nil || value < 0 {
+			context.String(http.StatusForbidden, "Field latency is not a positive number")
+
+			return
+		}
+
+		latency = value
+	}
+
 	manager.IncGoodAttempts(scraper, proxy)
+	manager.ReportLatency(scraper, proxy, latency)
+
+	if domain := manager.NormalizeDomain(context.Query("domain")); domain != "" {
+		manager.DomainPassed(scraper, proxy, domain)
+	}
+
 	context.String(http.StatusOK, "OK")
 }
 
@@ -182,15 +326,29 @@ func routeMarkDead(context *gin.Context) {
 		return
 	}
 
-	manager.MarkDead(scraper, proxy)
+	if !scraperRegistered(context, scraper, false) {
+		return
+	}
+
+	reason := context.Query("reason")
+	if !manager.ValidReason(reason) {
+		context.String(http.StatusForbidden, "Field reason should be one of "+strings.Join(manager.FailureReasons, ", "))
+
+		return
+	}
+
+	if domain := manager.NormalizeDomain(context.Query("domain")); domain != "" {
+		manager.MarkDeadOnDomain(scraper, proxy, domain, reason)
+	} else {
+		manager.MarkDead(scraper, proxy, reason)
+	}
+
 	context.String(http.StatusOK, "OK")
 }
 
 func routeReanimate(context *gin.Context) {
 	scraper := context.Query("scraper")
-	if scraper == "" {
-		context.String(http.StatusForbidden, "Field scraper is empty")
-
+	if !scraperRegistered(context, scraper, false) {
 		return
 	}
 
@@ -200,9 +358,7 @@ func routeReanimate(context *gin.Context) {
 
 func routeAliveFromDead(context *gin.Context) {
 	scraper := context.Query("scraper")
-	if scraper == "" {
-		context.String(http.StatusForbidden, "Field scraper is empty")
-
+	if !scraperRegistered(context, scraper, false) {
 		return
 	}
 
@@ -221,7 +377,7 @@ func removeDays(context *gin.Context) {
 	daysInt64, err := strconv.ParseInt(days, 10, 64)
 	if err == nil {
 		log.Info().Msgf("New clearance time set to %d days.\n", daysInt64)
-		config.RemoveDeadTime = daysInt64 * hoursInDay * minsInHour * secsInMinute
+		config.SetRemoveDeadTime(daysInt64 * hoursInDay * minsInHour * secsInMinute)
 	}
 
 	context.String(http.StatusOK, "OK")
@@ -239,7 +395,7 @@ func changeMaxGoodAttempts(context *gin.Context) {
 
 	if err == nil {
 		log.Info().Msgf("New max attempts value set to %d.\n", maxAttempts)
-		config.MaxGoodAttempts = int32(maxAttempts)
+		config.SetMaxGoodAttempts(int32(maxAttempts))
 	}
 
 	context.String(http.StatusOK, "OK")
@@ -247,9 +403,7 @@ func changeMaxGoodAttempts(context *gin.Context) {
 
 func removeDead(context *gin.Context) {
 	scraper := context.Query("scraper")
-	if scraper == "" {
-		context.String(http.StatusForbidden, "Field scraper is empty")
-
+	if !scraperRegistered(context, scraper, false) {
 		return
 	}
 
@@ -263,16 +417,19 @@ func reloadProxyList(c *gin.Context) {
 	c.String(http.StatusOK, "OK")
 }
 
-func start(c *gin.Context) {
-	scraper := c.Query("scraper")
+func start(context *gin.Context) {
+	scraper := context.Query("scraper")
+	if !scraperRegistered(context, scraper, config.AutoCreateScrapers) {
+		return
+	}
+
 	log.Info().Msgf("%s\n", scraper)
+	context.String(http.StatusOK, "OK")
 }
 
 func getWorkingList(context *gin.Context) {
 	scraper := context.Query("scraper")
-	if scraper == "" {
-		context.String(http.StatusForbidden, "Field scraper is empty")
-
+	if !scraperRegistered(context, scraper, false) {
 		return
 	}
 
@@ -284,9 +441,7 @@ func getWorkingList(context *gin.Context) {
 
 func getDeadList(context *gin.Context) {
 	scraper := context.Query("scraper")
-	if scraper == "" {
-		context.String(http.StatusForbidden, "Field scraper is empty")
-
+	if !scraperRegistered(context, scraper, false) {
 		return
 	}
 
@@ -299,8 +454,6 @@ func getDeadList(context *gin.Context) {
 func getProxyUsefulnessStats(context *gin.Context) {
 	var name string
 
-	var statsOrders = []string{"name", "sdate", "success", "fdate", "fail"}
-
 	scraper := context.Query("scraper")
 	orderBy := context.DefaultQuery("order_by", "name")
 	found := find(statsOrders, orderBy)
@@ -311,6 +464,10 @@ func getProxyUsefulnessStats(context *gin.Context) {
 		return
 	}
 
+	if !scraperRegistered(context, scraper, false) {
+		return
+	}
+
 	stats.ProxyUsefulnessStatsToCSV(scraper, orderBy)
 
 	saveTime := stats.UnixTimeString(now.Time())
@@ -320,6 +477,90 @@ func getProxyUsefulnessStats(context *gin.Context) {
 	context.String(http.StatusOK, "OK")
 }
 
+// routeBackoffSchedule shows backoffs given to proxy failing several times in a row, no proxy is touched.
+// Policy is taken from query (type, base, factor, step, cap, jitter) or the configured one of scraper and tier.
+func routeBackoffSchedule(context *gin.Context) {
+	schedule, err := backoffScheduleFromQuery(context)
+
+	switch {
+	case errors.Is(err, db.ErrUnknownScraper):
+		context.String(http.StatusNotFound, "Unknown scraper "+context.Query("scraper"))
+	case err != nil:
+		context.String(http.StatusForbidden, err.Error())
+	default:
+		context.JSON(http.StatusOK, schedule)
+	}
+}
+
+// backoffScheduleFromQuery builds backoff schedule asked in query, db.ErrUnknownScraper for unknown scraper
+func backoffScheduleFromQuery(context *gin.Context) (gin.H, error) {
+	attempts, err := strconv.Atoi(context.DefaultQuery("attempts", defaultScheduleAttempts))
+	if err != nil || attempts < 1 || attempts > maxScheduleAttempts {
+		return nil, fmt.Errorf("Field attempts should be from 1 to %d", maxScheduleAttempts)
+	}
+
+	scraper := context.Query("scraper")
+	if scraper != "" && !ensureScraper(scraper, false) {
+		return nil, db.ErrUnknownScraper
+	}
+
+	tier := context.DefaultQuery("tier", manager.TierFree)
+
+	if tier != manager.TierFree && tier != manager.TierRack {
+		return nil, errors.New("Field tier should be free or rack")
+	}
+
+	var params config.Backoff
+
+	if context.Query("type") != "" {
+		if err = context.ShouldBindQuery(&params); err != nil {
+			return nil, errors.New("Wrong policy parameters")
+		}
+	} else {
+		params = manager.BackoffParams(scraper, tier)
+	}
+
+	policy, err := manager.NewBackoffPolicy(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"scraper":  scraper,
+		"tier":     tier,
+		"policy":   params,
+		"schedule": manager.BackoffSchedule(policy, attempts),
+	}, nil
+}
+
+// routeGetPolicy shows settings effective for scraper after applying its overrides from config
+func routeGetPolicy(context *gin.Context) {
+	scraper := context.Query("scraper")
+	if !scraperRegistered(context, scraper, false) {
+		return
+	}
+
+	context.JSON(http.StatusOK, manager.EffectivePolicy(scraper))
+}
+
+func routeGetQuota(context *gin.Context) {
+	scraper := context.Query("scraper")
+	if !scraperRegistered(context, scraper, false) {
+		return
+	}
+
+	context.JSON(http.StatusOK, manager.UsageOfQuota(scraper))
+}
+
+func routeGetCircuit(context *gin.Context) {
+	scraper := context.Query("scraper")
+	if !scraperRegistered(context, scraper, false) {
+		return
+	}
+
+	context.JSON(http.StatusOK, manager.CircuitOf(scraper))
+}
+
 func routeClearUsefulnessStats(c *gin.Context) {
 	db.Base.ClearUsefulnessStats()
 	c.String(http.StatusOK, "OK")
@@ -358,7 +599,13 @@ func routeAddProxies(context *gin.Context) {
 		return
 	}
 
-	db.StoreProxies(json.Scraper, json.Proxies)
+	if json.Scraper != "" && !scraperRegistered(context, json.Scraper, config.AutoCreateScrapers) {
+		return
+	}
+
+	for scraper, filtered := range db.StoreProxies(json.Scraper, json.Proxies) {
+		log.Info().Str("scraper", scraper).Int("count", filtered).Msg("Proxies filtered out by blocklist")
+	}
 
 	context.String(http.StatusOK, "OK")
 }
@@ -386,55 +633,42 @@ func routeRemoveProxies(context *gin.Context) {
 		return
 	}
 
+	if json.Scraper != "" && !scraperRegistered(context, json.Scraper, false) {
+		return
+	}
+
 	db.Base.RemoveProxies(json.Scraper, json.Proxies)
 
 	context.String(http.StatusOK, "OK")
 }
 
 func reloadProxies() {
-	var proxies []string
-
 	var scraperToAdd = ""
 
 	log.Info().Msg("Reloading Proxies")
 
-	proxies, err := loadProxiesFromWeb(config.ResourceLink)
-	if err != nil {
-		log.Error().Err(err).Msg("Error loading proxies")
-	}
-
-	db.StoreProxies(scraperToAdd, proxies)
-}
-
-func loadProxiesFromWeb(resourceLink string) ([]string, error) {
-	ctx := context.Background()
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, resourceLink, http.NoBody)
+	proxies, err := proxySource.Fetch(context.Background())
+	if errors.Is(err, source.ErrNotModified) {
+		log.Info().Msg("Proxy list not modified since last reload")
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+		return
 	}
-
-	req.SetBasicAuth(config.ProxyListUsername, config.ProxyListPassword)
-	resp, err := http.DefaultClient.Do(req)
-
 	if err != nil {
-		return nil, fmt.Errorf("HTTP request failed: %w", err)
-	}
-
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+		log.Error().Err(err).Msg("Error loading proxies")
+		db.Events.Publish(db.Event{Type: db.EventReloadFailed, Message: err.Error()})
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
+		return
 	}
 
-	proxies := strings.Split(string(body), "\n")
+	for scraper, filtered := range db.StoreProxies(scraperToAdd, proxies) {
+		log.Info().Str("scraper", scraper).Int("count", filtered).Msg("Proxies filtered out by blocklist")
+	}
 
-	return proxies, nil
+	db.Events.Publish(db.Event{Type: db.EventReload, Count: len(proxies)})
 }
 
 func returnPostponedWithCondition() {
-	for _, scraper := range config.Scrapers {
+	for _, scraper := range db.Scrapers() {
 		sizeOfBusyAndPostponed := db.Set.BusyAndPostponedSize(scraper)
 		if sizeOfBusyAndPostponed == 0 {
 			return
@@ -0,0 +1,217 @@
+package manager
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+	"github.com/AlexeyYurko/go-pmserver/db"
+)
+
+// Backoff policy types
+const (
+	BackoffExponential  = "exponential"
+	BackoffLinear       = "linear"
+	BackoffFixed        = "fixed"
+	BackoffDecorrelated = "decorrelated"
+)
+
+// Jitter types
+const (
+	JitterNone    = "none"
+	JitterFull    = "full"
+	JitterEqual   = "equal"
+	JitterUniform = "uniform"
+)
+
+// Proxy tiers with own backoff policies
+const (
+	TierRack = "rack"
+	TierFree = "free"
+)
+
+const (
+	decorrelatedMultiplier = 3
+	// maxBackoff keeps uncapped policies from overflowing, 10 years
+	maxBackoff = 10 * 365 * 24 * 60 * 60
+)
+
+// defaultBackoff is the policy used when config has none
+var defaultBackoff = config.Backoff{
+	Type:   BackoffExponential,
+	Base:   128,
+	Factor: 16,
+	Cap:    2592000,
+	Jitter: JitterUniform,
+}
+
+// BackoffPolicy tells how long dead proxy waits before it can be reanimated
+type BackoffPolicy interface {
+	// Backoff in seconds after attempt-th failure, previous is the backoff given after the last one
+	Backoff(attempt int, previous int64) int64
+}
+
+type exponentialBackoff struct {
+	base, factor, capacity float64
+	jitter                 string
+}
+
+func (p exponentialBackoff) Backoff(attempt int, _ int64) int64 {
+	return jitteredWithCap(p.base*math.Pow(p.factor, float64(attempt)), p.capacity, p.jitter)
+}
+
+type linearBackoff struct {
+	base, step, capacity float64
+	jitter               string
+}
+
+func (p linearBackoff) Backoff(attempt int, _ int64) int64 {
+	steps := math.Max(float64(attempt-1), 0)
+	return jitteredWithCap(p.base+p.step*steps, p.capacity, p.jitter)
+}
+
+type fixedBackoff struct {
+	value  float64
+	jitter string
+}
+
+func (p fixedBackoff) Backoff(int, int64) int64 {
+	return jitteredWithCap(p.value, 0, p.jitter)
+}
+
+// decorrelatedBackoff picks random backoff between base and three times the previous one
+type decorrelatedBackoff struct {
+	base, capacity float64
+}
+
+func (p decorrelatedBackoff) Backoff(_ int, previous int64) int64 {
+	upper := math.Max(float64(previous)*decorrelatedMultiplier, p.base)
+	return int64(capped(p.base+rand.Float64()*(upper-p.base), p.capacity))
+}
+
+// NewBackoffPolicy creates policy from config parameters
+func NewBackoffPolicy(params config.Backoff) (BackoffPolicy, error) {
+	if params.Base < 0 || params.Cap < 0 || params.Step < 0 || params.Factor < 0 {
+		return nil, fmt.Errorf("backoff parameters can not be negative: %+v", params)
+	}
+	switch params.Jitter {
+	case "", JitterNone, JitterFull, JitterEqual, JitterUniform:
+	default:
+		return nil, fmt.Errorf("unknown jitter %q", params.Jitter)
+	}
+	switch params.Type {
+	case BackoffExponential:
+		if params.Factor == 0 {
+			return nil, fmt.Errorf("exponential backoff needs factor")
+		}
+		return exponentialBackoff{base: params.Base, factor: params.Factor, capacity: params.Cap, jitter: params.Jitter}, nil
+	case BackoffLinear:
+		return linearBackoff{base: params.Base, step: params.Step, capacity: params.Cap, jitter: params.Jitter}, nil
+	case BackoffFixed:
+		return fixedBackoff{value: params.Base, jitter: params.Jitter}, nil
+	case BackoffDecorrelated:
+		return decorrelatedBackoff{base: params.Base, capacity: params.Cap}, nil
+	}
+	return nil, fmt.Errorf("unknown backoff type %q", params.Type)
+}
+
+// ProxyTier tells which tier proxy belongs to
+func ProxyTier(proxy string) string {
+	if db.InProxyrack(proxy) {
+		return TierRack
+	}
+	return TierFree
+}
+
+// BackoffParams finds backoff parameters for scraper and tier:
+// scraper tier, global tier, scraper default, global default, in this order.
+// Proxyrack proxies without configured tier keep fixed proxyrack-backoff-time.
+func BackoffParams(scraper, tier string) config.Backoff {
+	overrides, _ := config.OverridesFor(scraper)
+	scraperTiers := overrides.Backoff
+	candidates := []*config.Backoff{
+		tierBackoff(&scraperTiers, tier),
+		tierBackoff(&config.GlobalBackoff, tier),
+	}
+	if tier == TierRack {
+		candidates = append(candidates, &config.Backoff{Type: BackoffFixed, Base: float64(config.PolicyFor(scraper).ProxyrackBackoffTime)})
+	}
+	candidates = append(candidates, scraperTiers.Default, config.GlobalBackoff.Default)
+	for _, candidate := range candidates {
+		if candidate != nil {
+			return *candidate
+		}
+	}
+	return defaultBackoff
+}
+
+func tierBackoff(tiers *config.BackoffTiers, tier string) *config.Backoff {
+	switch tier {
+	case TierRack:
+		return tiers.Rack
+	case TierFree:
+		return tiers.Free
+	}
+	return nil
+}
+
+// backoffPolicyFor returns policy for scraper and tier, broken config falls back to default policy
+func backoffPolicyFor(scraper, tier string) BackoffPolicy {
+	policy, err := NewBackoffPolicy(BackoffParams(scraper, tier))
+	if err != nil {
+		policy, _ = NewBackoffPolicy(defaultBackoff)
+	}
+	return policy
+}
+
+// CheckBackoffConfig validates every backoff policy in config
+func CheckBackoffConfig() error {
+	tiers := map[string]config.BackoffTiers{"": config.GlobalBackoff}
+	for scraper, overrides := range config.ScraperOverrides {
+		tiers[scraper] = overrides.Backoff
+	}
+	for scraper, scraperTiers := range tiers {
+		for _, params := range []*config.Backoff{scraperTiers.Default, scraperTiers.Rack, scraperTiers.Free} {
+			if params == nil {
+				continue
+			}
+			if _, err := NewBackoffPolicy(*params); err != nil {
+				return fmt.Errorf("backoff of scraper %q: %w", scraper, err)
+			}
+		}
+	}
+	return nil
+}
+
+// BackoffSchedule gives backoffs policy would produce for the first attempts failures in a row
+func BackoffSchedule(policy BackoffPolicy, attempts int) []int64 {
+	schedule := make([]int64, 0, attempts)
+	var previous int64
+	for attempt := 1; attempt <= attempts; attempt++ {
+		previous = policy.Backoff(attempt, previous)
+		schedule = append(schedule, previous)
+	}
+	return schedule
+}
+
+func capped(value, capacity float64) float64 {
+	if capacity > 0 && value > capacity {
+		return capacity
+	}
+	return math.Min(value, maxBackoff)
+}
+
+// jitteredWithCap caps value, adds jitter and caps it again, so jitter never goes over the cap
+func jitteredWithCap(value, capacity float64, jitter string) int64 {
+	value = capped(value, capacity)
+	switch jitter {
+	case JitterFull:
+		value *= rand.Float64()
+	case JitterEqual:
+		value = value/2 + rand.Float64()*value/2
+	case JitterUniform:
+		value = float64(randomUniform(value))
+	}
+	return int64(capped(value, capacity))
+}
@@ -0,0 +1,169 @@
+package manager
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+)
+
+// jitterRuns is how many times random backoffs are drawn to check their bounds
+const jitterRuns = 1000
+
+func TestNewBackoffPolicyRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		params config.Backoff
+	}{
+		{name: "unknown type", params: config.Backoff{Type: "random", Base: 1}},
+		{name: "empty type", params: config.Backoff{Base: 1}},
+		{name: "unknown jitter", params: config.Backoff{Type: BackoffFixed, Base: 1, Jitter: "some"}},
+		{name: "exponential without factor", params: config.Backoff{Type: BackoffExponential, Base: 1}},
+		{name: "negative base", params: config.Backoff{Type: BackoffFixed, Base: -1}},
+		{name: "negative cap", params: config.Backoff{Type: BackoffLinear, Base: 1, Cap: -1}},
+		{name: "negative step", params: config.Backoff{Type: BackoffLinear, Base: 1, Step: -1}},
+		{name: "negative factor", params: config.Backoff{Type: BackoffExponential, Base: 1, Factor: -2}},
+	}
+	for _, tt := range tests {
+		if _, err := NewBackoffPolicy(tt.params); err == nil {
+			t.Errorf("%s: NewBackoffPolicy(%+v) gave no error", tt.name, tt.params)
+		}
+	}
+}
+
+func TestBackoffScheduleWithoutJitter(t *testing.T) {
+	tests := []struct {
+		name   string
+		params config.Backoff
+		want   []int64
+	}{
+		{
+			name:   "exponential",
+			params: config.Backoff{Type: BackoffExponential, Base: 2, Factor: 3, Jitter: JitterNone},
+			want:   []int64{6, 18, 54, 162},
+		},
+		{
+			name:   "exponential with cap",
+			params: config.Backoff{Type: BackoffExponential, Base: 2, Factor: 3, Cap: 100, Jitter: JitterNone},
+			want:   []int64{6, 18, 54, 100, 100},
+		},
+		{
+			name:   "linear",
+			params: config.Backoff{Type: BackoffLinear, Base: 10, Step: 5},
+			want:   []int64{10, 15, 20, 25},
+		},
+		{
+			name:   "linear with cap",
+			params: config.Backoff{Type: BackoffLinear, Base: 10, Step: 5, Cap: 18, Jitter: JitterNone},
+			want:   []int64{10, 15, 18, 18},
+		},
+		{
+			name:   "fixed",
+			params: config.Backoff{Type: BackoffFixed, Base: 7, Cap: 3},
+			want:   []int64{7, 7, 7},
+		},
+	}
+	for _, tt := range tests {
+		policy, err := NewBackoffPolicy(tt.params)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := BackoffSchedule(policy, len(tt.want)); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: schedule %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBackoffWithoutCapDoesNotOverflow(t *testing.T) {
+	policy, err := NewBackoffPolicy(config.Backoff{Type: BackoffExponential, Base: 128, Factor: 16, Jitter: JitterNone})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := policy.Backoff(1000, 0); got != maxBackoff {
+		t.Errorf("backoff %d, want %d", got, maxBackoff)
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	const base = 100.0
+	tests := []struct {
+		jitter   string
+		cap      float64
+		min, max int64
+	}{
+		{jitter: JitterNone, min: 100, max: 100},
+		{jitter: JitterFull, min: 0, max: 100},
+		{jitter: JitterEqual, min: 50, max: 100},
+		{jitter: JitterUniform, min: 50, max: 150},
+		// jitter never goes over the cap
+		{jitter: JitterUniform, cap: 120, min: 50, max: 120},
+		{jitter: JitterFull, cap: 40, min: 0, max: 40},
+		{jitter: JitterEqual, cap: 40, min: 20, max: 40},
+	}
+	for _, tt := range tests {
+		policy, err := NewBackoffPolicy(config.Backoff{Type: BackoffFixed, Base: base, Jitter: tt.jitter})
+		if tt.cap > 0 {
+			policy, err = NewBackoffPolicy(config.Backoff{Type: BackoffLinear, Base: base, Cap: tt.cap, Jitter: tt.jitter})
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < jitterRuns; i++ {
+			if got := policy.Backoff(1, 0); got < tt.min || got > tt.max {
+				t.Fatalf("jitter %s cap %v: backoff %d out of [%d, %d]", tt.jitter, tt.cap, got, tt.min, tt.max)
+			}
+		}
+	}
+}
+
+func TestDecorrelatedBackoff(t *testing.T) {
+	tests := []struct {
+		name     string
+		params   config.Backoff
+		previous int64
+		min, max int64
+	}{
+		{name: "first failure", params: config.Backoff{Type: BackoffDecorrelated, Base: 10}, min: 10, max: 10},
+		{name: "grows from previous", params: config.Backoff{Type: BackoffDecorrelated, Base: 10}, previous: 20, min: 10, max: 60},
+		{name: "capped", params: config.Backoff{Type: BackoffDecorrelated, Base: 10, Cap: 30}, previous: 100, min: 10, max: 30},
+	}
+	for _, tt := range tests {
+		policy, err := NewBackoffPolicy(tt.params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < jitterRuns; i++ {
+			if got := policy.Backoff(2, tt.previous); got < tt.min || got > tt.max {
+				t.Fatalf("%s: backoff %d out of [%d, %d]", tt.name, got, tt.min, tt.max)
+			}
+		}
+	}
+}
+
+func TestCheckBackoffConfig(t *testing.T) {
+	globalBackoff, scraperOverrides := config.GlobalBackoff, config.ScraperOverrides
+	t.Cleanup(func() {
+		config.GlobalBackoff, config.ScraperOverrides = globalBackoff, scraperOverrides
+	})
+
+	valid := &config.Backoff{Type: BackoffLinear, Base: 10, Step: 5}
+	broken := &config.Backoff{Type: BackoffExponential, Base: 10}
+	tests := []struct {
+		name    string
+		global  config.BackoffTiers
+		scraper config.BackoffTiers
+		wantErr bool
+	}{
+		{name: "nothing configured"},
+		{name: "valid", global: config.BackoffTiers{Default: valid, Rack: valid}, scraper: config.BackoffTiers{Free: valid}},
+		{name: "broken global tier", global: config.BackoffTiers{Rack: broken}, wantErr: true},
+		{name: "broken scraper default", global: config.BackoffTiers{Default: valid}, scraper: config.BackoffTiers{Default: broken}, wantErr: true},
+	}
+	for _, tt := range tests {
+		config.GlobalBackoff = tt.global
+		config.ScraperOverrides = map[string]config.PolicyOverrides{"ra": {Backoff: tt.scraper}}
+		if err := CheckBackoffConfig(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: CheckBackoffConfig() = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
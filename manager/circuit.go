@@ -0,0 +1,162 @@
+package manager
+
+import (
+	"errors"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+	"github.com/AlexeyYurko/go-pmserver/db"
+	"github.com/AlexeyYurko/go-pmserver/now"
+)
+
+// States of scraper circuit breaker
+const (
+	// CircuitClosed is normal work
+	CircuitClosed = "closed"
+	// CircuitOpen is an incident, backoffs are not escalated and handouts may be paused
+	CircuitOpen = "open"
+	// CircuitHalfOpen probes if the incident is over, handouts are resumed but backoffs are still not escalated
+	CircuitHalfOpen = "half-open"
+)
+
+const (
+	defaultCircuitWindow      = 60
+	defaultCircuitMinRequests = 20
+	defaultCircuitProbePeriod = 300
+)
+
+// ErrCircuitOpen returned by GetRandomProxy while circuit of scraper is open and handouts are paused
+var ErrCircuitOpen = errors.New("circuit open")
+
+// CircuitOf returns state of scraper circuit breaker
+func CircuitOf(scraper string) (state db.Circuit) {
+	settings := circuitSettings(scraper)
+	db.Circuits.Update(scraper, func(circuit *db.Circuit, fresh bool) {
+		advance(scraper, circuit, fresh, settings, now.Time())
+		state = *circuit
+	})
+	return
+}
+
+// circuitTripped checks if backoffs of scraper should not be escalated now
+func circuitTripped(scraper string) (tripped bool) {
+	settings := circuitSettings(scraper)
+	if settings.FailureRatio <= 0 {
+		return false
+	}
+	db.Circuits.Update(scraper, func(circuit *db.Circuit, fresh bool) {
+		advance(scraper, circuit, fresh, settings, now.Time())
+		tripped = circuit.State != CircuitClosed
+	})
+	return
+}
+
+// handoutsPaused checks if scraper should get no proxies now
+func handoutsPaused(scraper string) (paused bool) {
+	settings := circuitSettings(scraper)
+	if settings.PauseHandouts != "yes" {
+		return false
+	}
+	db.Circuits.Update(scraper, func(circuit *db.Circuit, fresh bool) {
+		advance(scraper, circuit, fresh, settings, now.Time())
+		paused = circuit.State == CircuitOpen
+	})
+	return
+}
+
+// recordOutcome counts request of scraper and opens or closes its circuit when failure ratio says so
+func recordOutcome(scraper string, failed bool) {
+	settings := circuitSettings(scraper)
+	if settings.FailureRatio <= 0 {
+		return
+	}
+	db.Circuits.Update(scraper, func(circuit *db.Circuit, fresh bool) {
+		currentTime := now.Time()
+		advance(scraper, circuit, fresh, settings, currentTime)
+		if circuit.State == CircuitClosed && circuit.WindowStart+settings.Window <= currentTime {
+			restartWindow(circuit, currentTime)
+		}
+		if failed {
+			circuit.Failures++
+		} else {
+			circuit.Successes++
+		}
+		if circuit.State != CircuitOpen && failing(circuit, settings) {
+			moveTo(scraper, circuit, CircuitOpen, currentTime)
+		}
+	})
+}
+
+// advance sets up fresh circuit closed, moves open circuit to half-open after probe period
+// and half-open one to closed or back to open
+func advance(scraper string, circuit *db.Circuit, fresh bool, settings config.CircuitBreaker, currentTime int64) {
+	if fresh {
+		*circuit = db.Circuit{State: CircuitClosed, Since: currentTime, WindowStart: currentTime}
+	}
+	if settings.FailureRatio <= 0 && circuit.State != CircuitClosed {
+		moveTo(scraper, circuit, CircuitClosed, currentTime)
+	}
+	if circuit.State == CircuitClosed || circuit.Since+settings.ProbePeriod > currentTime {
+		return
+	}
+	switch {
+	case circuit.State == CircuitOpen:
+		moveTo(scraper, circuit, CircuitHalfOpen, currentTime)
+	case circuit.Failures > 0 && ratio(circuit) >= settings.FailureRatio:
+		moveTo(scraper, circuit, CircuitOpen, currentTime)
+	default:
+		moveTo(scraper, circuit, CircuitClosed, currentTime)
+	}
+}
+
+func failing(circuit *db.Circuit, settings config.CircuitBreaker) bool {
+	return circuit.Successes+circuit.Failures >= settings.MinRequests && ratio(circuit) >= settings.FailureRatio
+}
+
+func ratio(circuit *db.Circuit) float64 {
+	if circuit.Successes+circuit.Failures == 0 {
+		return 0
+	}
+	return float64(circuit.Failures) / float64(circuit.Successes+circuit.Failures)
+}
+
+func restartWindow(circuit *db.Circuit, currentTime int64) {
+	circuit.WindowStart = currentTime
+	circuit.Successes = 0
+	circuit.Failures = 0
+}
+
+// moveTo changes state of circuit, logs it and publishes it to events
+func moveTo(scraper string, circuit *db.Circuit, state string, currentTime int64) {
+	event := log.Info()
+	if state == CircuitOpen {
+		event = log.Warn()
+	}
+	event.
+		Str("scraper", scraper).
+		Str("from", circuit.State).
+		Str("to", state).
+		Int("successes", circuit.Successes).
+		Int("failures", circuit.Failures).
+		Msg("circuit breaker state changed")
+	db.Events.Publish(db.Event{Type: db.EventCircuit, Scraper: scraper, From: circuit.State, To: state})
+	circuit.State = state
+	circuit.Since = currentTime
+	restartWindow(circuit, currentTime)
+}
+
+// circuitSettings returns circuit breaker settings of scraper with defaults for not set ones
+func circuitSettings(scraper string) config.CircuitBreaker {
+	settings := config.PolicyFor(scraper).CircuitBreaker
+	if settings.Window <= 0 {
+		settings.Window = defaultCircuitWindow
+	}
+	if settings.MinRequests <= 0 {
+		settings.MinRequests = defaultCircuitMinRequests
+	}
+	if settings.ProbePeriod <= 0 {
+		settings.ProbePeriod = defaultCircuitProbePeriod
+	}
+	return settings
+}
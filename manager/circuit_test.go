@@ -0,0 +1,90 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+	"github.com/AlexeyYurko/go-pmserver/db"
+	"github.com/AlexeyYurko/go-pmserver/now"
+)
+
+func TestCircuitTransitionPublished(t *testing.T) {
+	breaker := config.ScraperCircuitBreaker
+	t.Cleanup(func() {
+		config.ScraperCircuitBreaker = breaker
+		config.ResolvePolicies()
+	})
+	config.ScraperCircuitBreaker = config.CircuitBreaker{FailureRatio: 0.5, MinRequests: 2}
+	config.ResolvePolicies()
+	config.Scrapers = []string{"tripping"}
+	config.Groups = nil
+	db.Init()
+
+	subscription := db.Events.Subscribe(db.EventFilter{Scrapers: []string{"tripping"}, Types: []string{db.EventCircuit}})
+	defer db.Events.Cancel(subscription)
+
+	recordOutcome("tripping", true)
+	recordOutcome("tripping", true)
+	select {
+	case event := <-subscription.C:
+		if event.From != CircuitClosed || event.To != CircuitOpen {
+			t.Errorf("event %+v, want from %s to %s", event, CircuitClosed, CircuitOpen)
+		}
+	default:
+		t.Fatal("no circuit event published")
+	}
+	if !circuitTripped("tripping") {
+		t.Error("circuit not tripped after failures")
+	}
+}
+
+func TestDisabledCircuitKeepsNoState(t *testing.T) {
+	breaker := config.ScraperCircuitBreaker
+	t.Cleanup(func() {
+		config.ScraperCircuitBreaker = breaker
+		config.ResolvePolicies()
+	})
+	config.ScraperCircuitBreaker = config.CircuitBreaker{}
+	config.ResolvePolicies()
+	config.Scrapers = []string{"untouched"}
+	config.Groups = nil
+	db.Init()
+
+	if circuitTripped("untouched") {
+		t.Error("disabled circuit tripped")
+	}
+	if db.Circuits.Known("untouched") {
+		t.Error("disabled circuit got state")
+	}
+}
+
+func TestDomainFailuresTripCircuit(t *testing.T) {
+	breaker, backoff := config.ScraperCircuitBreaker, config.GlobalBackoff
+	t.Cleanup(func() {
+		config.ScraperCircuitBreaker, config.GlobalBackoff = breaker, backoff
+		config.ResolvePolicies()
+	})
+	config.ScraperCircuitBreaker = config.CircuitBreaker{FailureRatio: 0.5, MinRequests: 2, ProbePeriod: 1000}
+	config.GlobalBackoff = config.BackoffTiers{Default: &config.Backoff{Type: BackoffFixed, Base: 60, Jitter: JitterNone}}
+	config.ResolvePolicies()
+	config.Scrapers = []string{"shop"}
+	config.Groups = nil
+	config.ProxyrackProxyIP = []string{"9.9.9.9"}
+	db.Init()
+	db.StoreProxies("", []string{"1.1.1.1:80"})
+
+	MarkDeadOnDomain("shop", "1.1.1.1:80", "example.com", ReasonNone)
+	if circuitTripped("shop") {
+		t.Fatal("circuit tripped before min requests")
+	}
+	MarkDeadOnDomain("shop", "1.1.1.1:80", "example.com", ReasonNone)
+	if !circuitTripped("shop") {
+		t.Fatal("domain failures did not trip the circuit")
+	}
+	if db.Base.AliveOnDomain("shop", "1.1.1.1:80", "example.com", now.Time()+900) {
+		t.Error("proxy failed while circuit is open is not dead on domain for probe period")
+	}
+	if failures, lastBackoff := db.Base.IncDomainFailures("shop", "1.1.1.1:80", "example.com"); failures != 2 || lastBackoff != 60 {
+		t.Errorf("failures %d last backoff %d, want failure in incident not escalating the backoff", failures, lastBackoff)
+	}
+}
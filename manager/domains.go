@@ -0,0 +1,60 @@
+package manager
+
+import (
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/AlexeyYurko/go-pmserver/db"
+	"github.com/AlexeyYurko/go-pmserver/now"
+)
+
+// NormalizeDomain brings target domain to the form it is stored in, "Example.COM." becomes "example.com"
+func NormalizeDomain(domain string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+}
+
+// DomainPassed forgets failures of proxy on domain after a successful request to it
+func DomainPassed(scraper, proxy, domain string) {
+	if db.Base.ProxyNotInBase(scraper, proxy) {
+		return
+	}
+	db.Base.ClearDomain(scraper, proxy, domain)
+}
+
+// MarkDeadOnDomain marks proxy dead on domain only, the scraper keeps getting it for other domains.
+// Backoff is picked the same way as for MarkDead but counted from failures on the domain,
+// the failure counts for circuit of scraper too
+func MarkDeadOnDomain(scraper, proxy, domain, reason string) {
+	if db.Base.ProxyNotInBase(scraper, proxy) {
+		return
+	}
+
+	recordOutcome(scraper, true)
+	var backOffTime int64
+	if circuitTripped(scraper) {
+		// failures in an incident are not the proxy's fault, its backoff on domain is not escalated
+		backOffTime = circuitSettings(scraper).ProbePeriod
+		db.Base.StoreDomainDeadUntil(scraper, proxy, domain, now.Time()+backOffTime)
+	} else {
+		failures, lastBackoff := db.Base.IncDomainFailures(scraper, proxy, domain)
+		if policy, ok := failurePolicy(scraper, reason); ok && policy.Backoff > 0 {
+			backOffTime = policy.Backoff
+		} else {
+			backOffTime = backoffPolicyFor(scraper, ProxyTier(proxy)).Backoff(int(failures), lastBackoff)
+		}
+		db.Base.StoreDomainBackoff(scraper, proxy, domain, backOffTime, now.Time())
+	}
+
+	// proxy handed out for the request goes back to others
+	if db.Set.ProxyBusy(scraper, proxy) {
+		markGood(scraper, proxy)
+	}
+	log.Debug().
+		Str("scraper", scraper).
+		Str("proxy", proxy).
+		Str("domain", domain).
+		Str("reason", reason).
+		Int64("backoff", backOffTime).
+		Msg("proxy is DEAD on domain")
+}
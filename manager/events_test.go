@@ -0,0 +1,59 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+	"github.com/AlexeyYurko/go-pmserver/db"
+)
+
+// received drains events published so far
+func received(subscription *db.Subscription) (events []db.Event) {
+	for {
+		select {
+		case event := <-subscription.C:
+			events = append(events, event)
+		default:
+			return
+		}
+	}
+}
+
+func TestReanimateEvents(t *testing.T) {
+	t.Cleanup(func() {
+		config.Groups = nil
+		config.ResolvePolicies()
+	})
+	config.Scrapers = []string{"greedy", "modest"}
+	config.Groups = map[string][]string{"shop": {"greedy", "modest"}}
+	config.ProxyrackProxyIP = []string{"9.9.9.9"}
+	db.Init()
+	db.StoreProxies("", []string{"1.1.1.1:80"})
+
+	subscription := db.Events.Subscribe(db.EventFilter{Scrapers: []string{"modest"}})
+	defer db.Events.Cancel(subscription)
+
+	ReanimateProxies("modest")
+	db.Base.AliveFromDead("modest")
+	if events := received(subscription); len(events) > 0 {
+		t.Errorf("nothing to reanimate, got events %+v", events)
+	}
+
+	db.Set.Dead("modest", "1.1.1.1:80")
+	db.Base.AliveFromDead("greedy")
+	events := received(subscription)
+	want := []db.Event{
+		{Type: db.EventStatus, Scraper: "shop", Member: "modest", Proxy: "1.1.1.1:80", From: "unchecked", To: "dead"},
+		{Type: db.EventStatus, Scraper: "shop", Proxy: "1.1.1.1:80", From: "dead", To: "unchecked"},
+		{Type: db.EventReanimate, Scraper: "shop", Count: 1},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("events %+v, want %+v", events, want)
+	}
+	for i, event := range events {
+		event.At = 0
+		if event != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, event, want[i])
+		}
+	}
+}
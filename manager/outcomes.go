@@ -0,0 +1,76 @@
+package manager
+
+import (
+	"github.com/rs/zerolog/log"
+
+	"github.com/AlexeyYurko/go-pmserver/db"
+)
+
+// Results of outcomes reported with ReportOutcomes
+const (
+	OutcomeApplied      = "applied"
+	OutcomeIgnored      = "ignored"
+	OutcomeUnknownProxy = "unknown_proxy"
+)
+
+// Outcome of using proxy, reported in a batch
+type Outcome struct {
+	Proxy  string
+	Failed bool
+	// Reason of failure, one of FailureReasons or empty
+	Reason string
+	// Latency of successful request in ms, negative if not measured
+	Latency float64
+	// Domain of request, failure marks proxy dead on this domain only
+	Domain string
+}
+
+// ReportOutcomes applies outcomes of scraper in order and returns result of each of them.
+// Success of proxy which is already dead is stale and ignored, proxies not in the pool are unknown.
+// Batches of different clients may interleave, every outcome is applied on its own like a single report
+func ReportOutcomes(scraper string, outcomes []Outcome) (results []string) {
+	proxies := make([]string, len(outcomes))
+	for i, outcome := range outcomes {
+		proxies[i] = outcome.Proxy
+	}
+
+	known := db.Base.ProxiesInBase(scraper, proxies)
+	results = make([]string, len(outcomes))
+	for i, outcome := range outcomes {
+		switch {
+		case !known[outcome.Proxy]:
+			results[i] = OutcomeUnknownProxy
+		case !outcome.Failed && db.Set.ProxyAlreadyDead(scraper, outcome.Proxy):
+			log.Debug().
+				Str("scraper", scraper).
+				Str("proxy", outcome.Proxy).
+				Msg("success of DEAD proxy ignored")
+			results[i] = OutcomeIgnored
+		default:
+			applyOutcome(scraper, outcome)
+			results[i] = OutcomeApplied
+			// failure may remove proxy, the rest of its outcomes are for unknown proxy then
+			if outcome.Failed {
+				known[outcome.Proxy] = db.Base.Exist(scraper, outcome.Proxy)
+			}
+		}
+	}
+	return
+}
+
+func applyOutcome(scraper string, outcome Outcome) {
+	domain := NormalizeDomain(outcome.Domain)
+	if outcome.Failed {
+		if domain != "" {
+			MarkDeadOnDomain(scraper, outcome.Proxy, domain, outcome.Reason)
+		} else {
+			MarkDead(scraper, outcome.Proxy, outcome.Reason)
+		}
+		return
+	}
+	IncGoodAttempts(scraper, outcome.Proxy)
+	ReportLatency(scraper, outcome.Proxy, outcome.Latency)
+	if domain != "" {
+		DomainPassed(scraper, outcome.Proxy, domain)
+	}
+}
@@ -0,0 +1,39 @@
+package manager
+
+import (
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+	"github.com/AlexeyYurko/go-pmserver/db"
+)
+
+func TestReportOutcomesConcurrently(t *testing.T) {
+	config.Scrapers = []string{"shop", "news"}
+	config.Groups = nil
+	config.ProxyrackProxyIP = []string{"9.9.9.9"}
+	db.Init()
+	db.StoreProxies("", []string{"1.1.1.1:80", "2.2.2.2:80"})
+
+	outcomes := []Outcome{
+		{Proxy: "1.1.1.1:80", Latency: 120},
+		{Proxy: "2.2.2.2:80", Latency: -1, Domain: "example.com"},
+		{Proxy: "5.5.5.5:80", Latency: -1},
+	}
+	want := []string{OutcomeApplied, OutcomeApplied, OutcomeUnknownProxy}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		for _, scraper := range config.Scrapers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if results := ReportOutcomes(scraper, outcomes); !slices.Equal(results, want) {
+					t.Errorf("ReportOutcomes(%s) = %v, want %v", scraper, results, want)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,21 @@
+package manager
+
+import "github.com/AlexeyYurko/go-pmserver/config"
+
+// ScraperPolicy all settings deciding what happens to proxies of a scraper
+type ScraperPolicy struct {
+	config.ProxyPolicy
+	// Backoff parameters for dead proxies by tier
+	Backoff map[string]config.Backoff `json:"backoff"`
+}
+
+// EffectivePolicy resolves settings of scraper after applying its overrides
+func EffectivePolicy(scraper string) ScraperPolicy {
+	return ScraperPolicy{
+		ProxyPolicy: config.PolicyFor(scraper),
+		Backoff: map[string]config.Backoff{
+			TierFree: BackoffParams(scraper, TierFree),
+			TierRack: BackoffParams(scraper, TierRack),
+		},
+	}
+}
@@ -1,47 +1,171 @@
 package manager
 
 import (
-	"math"
+	"errors"
 	"math/rand"
+	"slices"
+	"time"
 
 	"github.com/rs/zerolog/log"
 
+	"github.com/AlexeyYurko/go-pmserver/blocklist"
 	"github.com/AlexeyYurko/go-pmserver/config"
 	"github.com/AlexeyYurko/go-pmserver/db"
 	"github.com/AlexeyYurko/go-pmserver/now"
 )
 
-var busyPostponeTimeoutCapSec float32 = 10.0
+var busyPostponeTimeoutCapSec = 10.0
+
+// maxTakeAttempts limits picking proxies again when concurrent handouts take them first
+const maxTakeAttempts = 3
+
+var errRateLimited = errors.New("every picked proxy was taken up to its rate limit")
+
+var errProxyRateLimited = errors.New("proxy was taken up to its rate limit")
+
+// Selection narrows down proxies GetRandomProxy can choose from, zero value allows any available proxy
+type Selection struct {
+	// MaxLatency in ms, proxies with rolling latency estimate under it are preferred, 0 for no limit
+	MaxLatency float64
+	// RequireLatency makes MaxLatency strict, proxies over it or never measured are not handed out
+	RequireLatency bool
+	// MinAnonymity is the worst anonymity level allowed, empty for any
+	MinAnonymity string
+	// Domain is target domain of request, proxies dead on it are skipped, empty for any
+	Domain string
+	// Exclude proxies already tried for the request, they are never handed out again
+	Exclude []string
+}
+
+func (s Selection) filtered() bool {
+	return s.MaxLatency > 0 || s.MinAnonymity != db.AnonymityUnknown || s.Domain != "" || len(s.Exclude) > 0
+}
+
+// accepts checks proxy against selection, latency is checked only if strictLatency is set
+func (s Selection) accepts(scraper, proxy string, strictLatency bool) bool {
+	if slices.Contains(s.Exclude, proxy) {
+		return false
+	}
+	if s.MinAnonymity != db.AnonymityUnknown && !db.AnonymityAtLeast(db.Base.Anonymity(scraper, proxy), s.MinAnonymity) {
+		return false
+	}
+	if s.Domain != "" && !db.Base.AliveOnDomain(scraper, proxy, s.Domain, now.Time()) {
+		return false
+	}
+	if strictLatency && s.MaxLatency > 0 && !s.latencyFits(scraper, proxy) {
+		return false
+	}
+	return true
+}
+
+func (s Selection) latencyFits(scraper, proxy string) bool {
+	latency, known := db.Base.Latency(scraper, proxy)
+	return known && latency <= s.MaxLatency
+}
+
+// randomKey picks random available proxy matching selection which rate limit of scraper allows to hand out
+func randomKey(scraper string, selection Selection, limit config.RateLimit, at time.Time) (string, error) {
+	rateLimited := db.RateLimited(limit)
+	quarantined := db.Actions.Any()
+	blocked := blocklist.For(scraper)
+	if !selection.filtered() && !rateLimited && !quarantined && blocked.Empty() {
+		return db.Set.GetRandomKey(scraper)
+	}
+	accepts := func(strictLatency bool) func(proxy string) bool {
+		return func(proxy string) bool {
+			if quarantined && db.Actions.Is(scraper, proxy, db.ActionQuarantine) {
+				return false
+			}
+			if blocked.Blocked(proxy) {
+				return false
+			}
+			if rateLimited && !db.RateLimits.Allows(scraper, proxy, limit, at) {
+				return false
+			}
+			return selection.accepts(scraper, proxy, strictLatency)
+		}
+	}
+	randomProxy, err := db.Set.GetRandomKeyWhere(scraper, accepts(true))
+	if err != nil && selection.MaxLatency > 0 && !selection.RequireLatency {
+		return db.Set.GetRandomKeyWhere(scraper, accepts(false))
+	}
+	return randomProxy, err
+}
+
+// takeRandomKey picks random proxy and counts its handout for rate limit,
+// proxy a concurrent handout has taken meanwhile is not allowed any more and another one is picked
+func takeRandomKey(scraper string, selection Selection, limit config.RateLimit, at time.Time) (randomProxy string, err error) {
+	for attempt := 0; attempt < maxTakeAttempts; attempt++ {
+		if randomProxy, err = randomKey(scraper, selection, limit, at); err != nil {
+			return
+		}
+		if !db.RateLimited(limit) {
+			db.RateLimits.Take(scraper, randomProxy, limit, at)
+			return
+		}
+		if db.RateLimits.TakeIfAllowed(scraper, randomProxy, limit, at) {
+			return
+		}
+	}
+	return "", errRateLimited
+}
 
 // GetRandomProxy finds random proxy in available list
 // TODO refactor available list to speed ups
-func GetRandomProxy(scraper string) (randomProxy string, err error) {
-	if randomProxy, err = db.Set.GetRandomKey(scraper); err != nil {
-		db.TimeStatsForUnavailableProxies[scraper] = append(db.TimeStatsForUnavailableProxies[scraper], now.Time())
+func GetRandomProxy(scraper string, selection Selection) (randomProxy string, err error) {
+	policy := config.PolicyFor(scraper)
+	handoutTime := time.Now()
+	if err = reserveQuota(scraper, policy.Quota, handoutTime); err != nil {
+		return
+	}
+	if handoutsPaused(scraper) {
+		db.Quotas.Release(scraper, handoutTime)
+		return "", ErrCircuitOpen
+	}
+	if randomProxy, err = takeRandomKey(scraper, selection, policy.RateLimit, handoutTime); err != nil {
+		db.Quotas.Release(scraper, handoutTime)
+		db.AddStat(db.TimeStatsForUnavailableProxies, scraper, now.Time())
 		log.Info().Str("scraper", scraper).Msg("there is no good/unchecked proxy available")
 	} else {
-		var timeForStartCounting int64
-		var newCounter int
-
-		if counter := db.SuccessfulGetRandomProxyRequestRate[scraper].Counter; counter != 0 {
-			timeForStartCounting = db.SuccessfulGetRandomProxyRequestRate[scraper].TimeForStartCounting
-			newCounter = counter + 1
-		} else {
-			timeForStartCounting = now.Time()
-			newCounter = 1
-		}
-		successfulGetStat := db.RequestsRate{
-			TimeForStartCounting: timeForStartCounting,
-			Counter:              newCounter,
-		}
-		db.SuccessfulGetRandomProxyRequestRate[scraper] = successfulGetStat
-
-		db.Set.Busy(scraper, randomProxy)
-		postponeReturnFromBusyToGood(scraper, randomProxy, true)
+		handOut(scraper, randomProxy)
 	}
 	return
 }
 
+// Reserve hands proxy scraper keeps for a session out to it again, quota, circuit breaker and rate limit
+// apply as for GetRandomProxy and the handout is counted the same way
+func Reserve(scraper, proxy string) error {
+	policy := config.PolicyFor(scraper)
+	handoutTime := time.Now()
+	if err := reserveQuota(scraper, policy.Quota, handoutTime); err != nil {
+		return err
+	}
+	if handoutsPaused(scraper) {
+		db.Quotas.Release(scraper, handoutTime)
+		return ErrCircuitOpen
+	}
+	if !db.RateLimited(policy.RateLimit) {
+		db.RateLimits.Take(scraper, proxy, policy.RateLimit, handoutTime)
+	} else if !db.RateLimits.TakeIfAllowed(scraper, proxy, policy.RateLimit, handoutTime) {
+		db.Quotas.Release(scraper, handoutTime)
+		return errProxyRateLimited
+	}
+	handOut(scraper, proxy)
+	return nil
+}
+
+// handOut counts proxy given to scraper and keeps it busy
+func handOut(scraper, proxy string) {
+	db.CountSuccessfulGet(scraper, now.Time())
+	// pinned proxy stays available for everybody
+	if !db.Actions.Is(scraper, proxy, db.ActionPin) {
+		db.Set.Busy(scraper, proxy)
+		db.Quotas.CountBusy(scraper, proxy)
+		postponeReturnFromBusyToGood(scraper, proxy, true)
+	}
+	db.Quotas.Settle(scraper)
+}
+
 func postponeReturnFromBusyToGood(scraper, proxy string, initial bool) {
 	currentTime := now.Time()
 	postponeTime := now.Time()
@@ -53,7 +177,7 @@ func postponeReturnFromBusyToGood(scraper, proxy string, initial bool) {
 	if currentTime+1 > postponeTime {
 		postponeTime = currentTime + 1
 	}
-	db.GoodPostponeTimeoutsForStats[scraper] = append(db.GoodPostponeTimeoutsForStats[scraper], postponeTime-proxyTime)
+	db.AddStat(db.GoodPostponeTimeoutsForStats, scraper, postponeTime-proxyTime)
 	db.Base.StoreNextCheck(scraper, proxy, postponeTime)
 	if !initial {
 		db.Base.ProxyTimeToNow(scraper, proxy)
@@ -66,9 +190,10 @@ func IncGoodAttempts(scraper, proxy string) {
 		return
 	}
 
+	recordOutcome(scraper, false)
 	localProxyGoodAttempts := db.Base.IncProxyGoodAttempts(scraper, proxy)
-	db.ProxySuccessUsageTimeForStats[scraper] = append(db.ProxySuccessUsageTimeForStats[scraper], now.Time()-db.Base.ProxyTime(scraper, proxy))
-	if localProxyGoodAttempts >= config.MaxGoodAttempts {
+	db.AddStat(db.ProxySuccessUsageTimeForStats, scraper, now.Time()-db.Base.ProxyTime(scraper, proxy))
+	if localProxyGoodAttempts >= config.PolicyFor(scraper).MaxGoodAttempts && !db.Actions.Is(scraper, proxy, db.ActionPin) {
 		log.Debug().
 			Str("scraper", scraper).
 			Int32("attempts", localProxyGoodAttempts).
@@ -85,12 +210,20 @@ func IncGoodAttempts(scraper, proxy string) {
 	}
 }
 
+// ReportLatency adds request duration in ms to rolling latency estimate of proxy
+func ReportLatency(scraper, proxy string, latency float64) {
+	if latency < 0 || db.Base.ProxyNotInBase(scraper, proxy) {
+		return
+	}
+	db.Base.StoreLatency(scraper, proxy, latency, config.PolicyFor(scraper).LatencySmoothing)
+}
+
 func markPostponed(scraper, proxy string) {
 	log.Debug().
 		Str("scraper", scraper).
 		Str("proxy", proxy).
 		Msg("GOOD proxy became POSTPONED")
-	nextCheck := now.Time() + config.BackoffTimeForGoodAttempts
+	nextCheck := now.Time() + config.PolicyFor(scraper).BackoffTimeForGoodAttempts
 	db.Base.StoreNextCheck(scraper, proxy, nextCheck)
 	db.Set.Postponed(scraper, proxy)
 }
@@ -111,14 +244,46 @@ func markGood(scraper, proxy string) {
 		Msg("proxy set to GOOD")
 }
 
-// MarkDead increase bad proxy statistics and counter
-func MarkDead(scraper, proxy string) {
+// MarkDead increase bad proxy statistics and counter,
+// reason picks failure policy from config, empty reason keeps default backoff
+func MarkDead(scraper, proxy, reason string) {
 	if db.Base.ProxyNotInBase(scraper, proxy) {
 		return
 	}
 
+	recordOutcome(scraper, true)
+	if db.Actions.Is(scraper, proxy, db.ActionPin) {
+		db.Base.CountFailedUse(scraper, proxy)
+		log.Debug().
+			Str("scraper", scraper).
+			Str("proxy", proxy).
+			Str("reason", reason).
+			Msg("PINNED proxy is kept available")
+		return
+	}
+	if circuitTripped(scraper) {
+		markDeadForProbePeriod(scraper, proxy, reason)
+		return
+	}
+	markDead(scraper, proxy, reason)
+}
+
+func markDead(scraper, proxy, reason string) {
 	db.Base.IncFailureAttempts(scraper, proxy)
 
+	if reason != ReasonNone {
+		failures := db.Base.IncFailureReason(scraper, proxy, reason)
+		if removeAfterFailures(scraper, proxy, reason, failures) {
+			log.Info().
+				Str("scraper", scraper).
+				Str("proxy", proxy).
+				Str("reason", reason).
+				Int32("failures", failures).
+				Msg("proxy removed after too many failures")
+			return
+		}
+	}
+
 	if db.Set.ProxyAlreadyDead(scraper, proxy) {
 		log.Debug().
 			Str("scraper", scraper).
@@ -129,20 +294,68 @@ func MarkDead(scraper, proxy string) {
 	db.Set.Dead(scraper, proxy)
 
 	var backOffTime int64
-	if db.InProxyrack(proxy) {
-		backOffTime = config.ProxyrackBackoffTime
+	if policy, ok := failurePolicy(scraper, reason); ok && policy.Backoff > 0 {
+		backOffTime = policy.Backoff
 	} else {
-		backOffTime = expBackoffFullJitter(int(db.Base.FailedAttempts(scraper, proxy)))
+		policy := backoffPolicyFor(scraper, ProxyTier(proxy))
+		backOffTime = policy.Backoff(int(db.Base.FailedAttempts(scraper, proxy)), db.Base.LastBackoff(scraper, proxy))
 	}
+	db.Base.StoreBackoff(scraper, proxy, backOffTime)
 	db.Base.StoreNextCheck(scraper, proxy, now.Time()+backOffTime)
 	log.Debug().
 		Str("scraper", scraper).
 		Str("proxy", proxy).
+		Str("reason", reason).
+		Int64("backoff", backOffTime).
 		Msg("proxy is DEAD")
 }
 
-func reanimateDead(scraper string) {
-	var nReanimated int
+// markDeadForProbePeriod marks proxy dead while circuit of scraper is not closed, failure is not counted
+// in a row and for removal, so backoff is not escalated and proxy is back when the circuit is probed
+func markDeadForProbePeriod(scraper, proxy, reason string) {
+	db.Base.CountFailedUse(scraper, proxy)
+	if db.Set.ProxyAlreadyDead(scraper, proxy) {
+		return
+	}
+	db.Set.Dead(scraper, proxy)
+	backOffTime := circuitSettings(scraper).ProbePeriod
+	db.Base.StoreNextCheck(scraper, proxy, now.Time()+backOffTime)
+	log.Debug().
+		Str("scraper", scraper).
+		Str("proxy", proxy).
+		Str("reason", reason).
+		Int64("backoff", backOffTime).
+		Msg("proxy is DEAD while circuit is open")
+}
+
+// CheckPassed moves proxy which passed active health check from unchecked to good
+func CheckPassed(scraper, proxy string) {
+	if !db.Set.ProxyUnchecked(scraper, proxy) {
+		return
+	}
+	log.Debug().
+		Str("scraper", scraper).
+		Str("proxy", proxy).
+		Msg("UNCHECKED proxy passed health check")
+	// it was never handed out, so there is no busy timeout to postpone
+	db.Set.Good(scraper, proxy)
+	db.Base.ProxyTimeToNow(scraper, proxy)
+}
+
+// CheckFailed marks proxy which failed active health check as dead
+func CheckFailed(scraper, proxy, reason string) {
+	if !db.Set.ProxyUnchecked(scraper, proxy) {
+		return
+	}
+	log.Debug().
+		Str("scraper", scraper).
+		Str("proxy", proxy).
+		Str("reason", reason).
+		Msg("UNCHECKED proxy failed health check")
+	markDead(scraper, proxy, reason)
+}
+
+func reanimateDead(scraper string) (nReanimated int) {
 	deadProxies := db.Set.GetDead(scraper)
 	log.Info().
 		Int("count", len(deadProxies)).
@@ -160,10 +373,10 @@ func reanimateDead(scraper string) {
 			Int("count", nReanimated).
 			Msg("proxies moved from 'dead' to 'unchecked'")
 	}
+	return
 }
 
-func returnToGoodFromBusyAndPostponed(scraper string) {
-	var nReturned int
+func returnToGoodFromBusyAndPostponed(scraper string) (nReturned int) {
 	busyAndPostponed := db.Set.LoadBusyPostponed(scraper)
 	for _, proxy := range busyAndPostponed {
 		nextCheck := db.Base.LoadNextCheck(scraper, proxy)
@@ -184,16 +397,18 @@ func returnToGoodFromBusyAndPostponed(scraper string) {
 			Int("count", nReturned).
 			Msg("proxies moved from 'busy' and 'postponed' to 'good'")
 	}
+	return
 }
 
 // RemoveDeadProxiesForALongTime removes too old dead proxies
 func RemoveDeadProxiesForALongTime(scraper string) {
 	var nRemoved int
 	var deadList []string
+	removeDeadTime := config.PolicyFor(scraper).RemoveDeadTime
 	deadProxies := db.Set.GetDead(scraper)
 	for _, proxy := range deadProxies {
 		proxyTime := db.Base.ProxyTime(scraper, proxy)
-		timeToRemoveDeadProxies := proxyTime + config.RemoveDeadTime
+		timeToRemoveDeadProxies := proxyTime + removeDeadTime
 		if proxyTime != 0 && timeToRemoveDeadProxies <= now.Time() {
 			nRemoved++
 			deadList = append(deadList, proxy)
@@ -209,29 +424,25 @@ func RemoveDeadProxiesForALongTime(scraper string) {
 	}
 }
 
-func randomUniform(value float32) int64 {
+// randomUniform returns random value from 0.5 to 1.5 of the given one
+func randomUniform(value float64) int64 {
 	mn := 0.5 * value
 	mx := 1.5 * value
-	number := mn + (mx - mn)
-	return int64(rand.Float32() * number)
-}
-
-func expBackoffFullJitter(attempts int) int64 {
-	var capacity = 2592000.0
-	var base = 128.0
-	var backOffTime float32
-	maxAttempts := int(math.Log(capacity/base) / math.Log(16))
-	if attempts <= maxAttempts {
-		backOffTime = float32(base * math.Pow(16.0, float64(attempts)))
-	} else {
-		backOffTime = float32(capacity)
-	}
-	return randomUniform(backOffTime)
+	return int64(mn + rand.Float64()*(mx-mn))
 }
 
 // ReanimateProxies tries rise proxies from non-working state
 func ReanimateProxies(scraper string) {
-	reanimateDead(scraper)
-	returnToGoodFromBusyAndPostponed(scraper)
+	reanimated := reanimateDead(scraper) + returnToGoodFromBusyAndPostponed(scraper)
 	RemoveDeadProxiesForALongTime(scraper)
+	// domain a proxy recovered on long ago tells nothing about it any more
+	db.Base.ForgetExpiredDomains(scraper, now.Time()-config.PolicyFor(scraper).RemoveDeadTime)
+	if reanimated > 0 {
+		// like removed proxies, reanimated ones belong to the pool of every member of the group
+		pool := scraper
+		if group, ok := db.GroupOf(scraper); ok {
+			pool = group
+		}
+		db.Events.Publish(db.Event{Type: db.EventReanimate, Scraper: pool, Count: reanimated})
+	}
 }
@@ -0,0 +1,46 @@
+package manager
+
+import (
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+	"github.com/AlexeyYurko/go-pmserver/db"
+)
+
+// ErrQuotaExceeded returned by GetRandomProxy when scraper already took as many proxies as its quota allows
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaUsage is how much of its quota scraper uses now
+type QuotaUsage struct {
+	Busy         int `json:"busy"`
+	MaxBusy      int `json:"max_busy"`
+	PerMinute    int `json:"per_minute"`
+	MaxPerMinute int `json:"max_per_minute"`
+	Rejected     int `json:"rejected"`
+}
+
+// UsageOfQuota returns quota of scraper with its current usage
+func UsageOfQuota(scraper string) QuotaUsage {
+	quota := config.PolicyFor(scraper).Quota
+	return QuotaUsage{
+		Busy:         db.Quotas.Busy(scraper),
+		MaxBusy:      quota.MaxBusy,
+		PerMinute:    db.Quotas.Handouts(scraper, time.Now()),
+		MaxPerMinute: quota.MaxPerMinute,
+		Rejected:     db.Quotas.Rejected(scraper),
+	}
+}
+
+// reserveQuota refuses handout to scraper which already took as many proxies as its quota allows,
+// otherwise reserves handout in the quota until it is settled or released
+func reserveQuota(scraper string, quota config.Quota, at time.Time) error {
+	exceeded := db.Quotas.Reserve(scraper, quota, at)
+	if exceeded == "" {
+		return nil
+	}
+	log.Debug().Str("scraper", scraper).Str("quota", exceeded).Msg("quota exceeded")
+	return ErrQuotaExceeded
+}
@@ -0,0 +1,101 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+	"github.com/AlexeyYurko/go-pmserver/db"
+)
+
+func TestMaxBusyCountedPerGroupMember(t *testing.T) {
+	scraperQuota := config.ScraperQuota
+	t.Cleanup(func() {
+		config.ScraperQuota, config.Groups = scraperQuota, nil
+		config.ResolvePolicies()
+	})
+	config.ScraperQuota = config.Quota{MaxBusy: 2}
+	config.ResolvePolicies()
+	config.Scrapers = []string{"greedy", "modest"}
+	config.Groups = map[string][]string{"shop": {"greedy", "modest"}}
+	config.ProxyrackProxyIP = []string{"9.9.9.9"}
+	db.Init()
+	db.StoreProxies("", []string{"1.1.1.1:80", "2.2.2.2:80", "3.3.3.3:80", "4.4.4.4:80"})
+
+	for i := 0; i < 2; i++ {
+		if _, err := GetRandomProxy("greedy", Selection{}); err != nil {
+			t.Fatalf("greedy handout %d: %v", i, err)
+		}
+	}
+	if _, err := GetRandomProxy("greedy", Selection{}); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("greedy over its quota: err = %v, want ErrQuotaExceeded", err)
+	}
+	if _, err := GetRandomProxy("modest", Selection{}); err != nil {
+		t.Fatalf("modest is limited by handouts of greedy: %v", err)
+	}
+	if usage := UsageOfQuota("modest"); usage.Busy != 1 {
+		t.Errorf("modest busy %d, want 1", usage.Busy)
+	}
+}
+
+func TestQuotaHoldsUnderConcurrentHandouts(t *testing.T) {
+	scraperQuota := config.ScraperQuota
+	t.Cleanup(func() {
+		config.ScraperQuota = scraperQuota
+		config.ResolvePolicies()
+	})
+	config.Scrapers = []string{"solo"}
+	config.Groups = nil
+	config.ProxyrackProxyIP = []string{"9.9.9.9"}
+	proxies := make([]string, 0, 50)
+	for i := 1; i <= 50; i++ {
+		proxies = append(proxies, fmt.Sprintf("1.1.1.%d:80", i))
+	}
+
+	tests := []struct {
+		name  string
+		quota config.Quota
+		want  int
+	}{
+		{name: "busy", quota: config.Quota{MaxBusy: 3}, want: 3},
+		{name: "per minute", quota: config.Quota{MaxPerMinute: 5}, want: 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.ScraperQuota = tt.quota
+			config.ResolvePolicies()
+			db.Init()
+			db.StoreProxies("", proxies)
+
+			var handedOut sync.WaitGroup
+			var mu sync.Mutex
+			got, refused := 0, 0
+			for i := 0; i < 40; i++ {
+				handedOut.Add(1)
+				go func() {
+					defer handedOut.Done()
+					_, err := GetRandomProxy("solo", Selection{})
+					mu.Lock()
+					defer mu.Unlock()
+					switch {
+					case err == nil:
+						got++
+					case errors.Is(err, ErrQuotaExceeded):
+						refused++
+					default:
+						t.Errorf("handout: %v", err)
+					}
+				}()
+			}
+			handedOut.Wait()
+			if got != tt.want || refused != 40-tt.want {
+				t.Errorf("handed out %d, refused %d, want %d and %d", got, refused, tt.want, 40-tt.want)
+			}
+			if usage := UsageOfQuota("solo"); usage.Rejected != 40-tt.want {
+				t.Errorf("rejected %d, want %d", usage.Rejected, 40-tt.want)
+			}
+		})
+	}
+}
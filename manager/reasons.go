@@ -0,0 +1,64 @@
+package manager
+
+import (
+	"fmt"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+	"github.com/AlexeyYurko/go-pmserver/db"
+)
+
+// Failure reasons accepted by MarkDead
+const (
+	ReasonNone    = ""
+	ReasonTimeout = "timeout"
+	ReasonRefused = "refused"
+	ReasonBanned  = "banned"
+	ReasonCaptcha = "captcha"
+	ReasonHTTP5xx = "http_5xx"
+	ReasonCustom  = "custom"
+)
+
+// removalActor is actor of blocks taken by failure policies
+const removalActor = "failure-policy"
+
+// FailureReasons lists every named failure reason
+var FailureReasons = []string{ReasonTimeout, ReasonRefused, ReasonBanned, ReasonCaptcha, ReasonHTTP5xx, ReasonCustom}
+
+// ValidReason checks if reason is known to MarkDead, empty reason is valid and means not specified
+func ValidReason(reason string) bool {
+	if reason == ReasonNone {
+		return true
+	}
+	for _, known := range FailureReasons {
+		if reason == known {
+			return true
+		}
+	}
+	return false
+}
+
+// failurePolicy finds policy of scraper for reason, ok is false if the reason has no own policy
+func failurePolicy(scraper, reason string) (policy config.FailurePolicy, ok bool) {
+	if reason == ReasonNone {
+		return
+	}
+	policy, ok = config.PolicyFor(scraper).FailurePolicies[reason]
+	return
+}
+
+// removeAfterFailures blocks proxy if it failed with the reason as many times as policy allows,
+// so it is removed and not added again by the next proxy list, returns true if proxy was removed
+func removeAfterFailures(scraper, proxy, reason string, failures int32) bool {
+	policy, ok := failurePolicy(scraper, reason)
+	if !ok || policy.RemoveAfter == 0 || failures < policy.RemoveAfter {
+		return false
+	}
+	db.TakeAction(db.ProxyAction{
+		Scraper: scraper,
+		Proxy:   proxy,
+		Action:  db.ActionBlock,
+		Reason:  fmt.Sprintf("failed %d times with reason %s", failures, reason),
+		Actor:   removalActor,
+	})
+	return true
+}
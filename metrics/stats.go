@@ -7,6 +7,7 @@ import (
 	"os"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -15,6 +16,7 @@ import (
 
 	"github.com/AlexeyYurko/go-pmserver/config"
 	"github.com/AlexeyYurko/go-pmserver/db"
+	"github.com/AlexeyYurko/go-pmserver/manager"
 	"github.com/AlexeyYurko/go-pmserver/now"
 	"github.com/jedib0t/go-pretty/v6/table"
 )
@@ -31,6 +33,8 @@ const (
 	postponed = "postponed"
 	good      = "good"
 	available = "available"
+	// throttled are available proxies held back by rate limit
+	throttled = "throttled"
 )
 
 // Report from default metric registry
@@ -56,27 +60,40 @@ func RequestStats() gin.HandlerFunc {
 	}
 }
 
-type statRecord struct {
-	Proxy                  string
-	LastSuccessfullyUsed   string
-	NumberOfSuccessfulUses string
-	LastFailureUsed        string
-	NumberOfFailures       string
+// StatRecord is usage of proxy as written to usefulness stats
+type StatRecord struct {
+	Proxy                  string `json:"proxy"`
+	LastSuccessfullyUsed   string `json:"last_successfully_used"`
+	NumberOfSuccessfulUses string `json:"number_of_successful_uses"`
+	LastFailureUsed        string `json:"last_failure_used"`
+	NumberOfFailures       string `json:"number_of_failures"`
+	LatencyMs              string `json:"latency_ms"`
+	ExitIP                 string `json:"exit_ip"`
+	Anonymity              string `json:"anonymity"`
+	FailureReasons         string `json:"failure_reasons"`
+	DeadDomains            string `json:"dead_domains"`
+	latency                float64
 }
 type outputForStat map[string]map[string]int
 
 var statsFilename = "success_stats.csv"
 
+// unknownLatency puts never measured proxies to the end when sorting by latency
+var unknownLatency = math.Inf(1)
+
 func makeProxiesNumbersData(scraper string) outputForStat {
 	var outputs = make(map[string]map[string]int)
 	var mainStatuses = []string{available, good, postponed, busy, dead, unchecked}
 	var proxyTypes = []string{"all", "rack", "free"}
 
+	limit := config.PolicyFor(scraper).RateLimit
+	currentTime := time.Now()
 	for _, proxyType := range proxyTypes {
 		outputs[proxyType] = make(map[string]int)
 		for _, status := range mainStatuses {
 			outputs[proxyType][status] = db.Set.LengthWithProxyRackAffected(scraper, status, proxyType)
 		}
+		outputs[proxyType][throttled] = db.RateLimits.ThrottledSize(scraper, proxyType, limit, currentTime)
 	}
 	outputs["all"]["total"] = outputs["all"]["available"] + outputs["all"]["busy"] + outputs["all"]["postponed"] + outputs["all"]["dead"]
 	outputs["rack"]["total"] = outputs["rack"]["available"] + outputs["rack"]["busy"] + outputs["rack"]["postponed"] + outputs["rack"]["dead"]
@@ -86,16 +103,25 @@ func makeProxiesNumbersData(scraper string) outputForStat {
 
 // LogStats output stats to console
 func LogStats() {
-	toLogStatuses := []string{good, unchecked, available, busy, postponed, dead, "total"}
+	toLogStatuses := []string{good, unchecked, available, throttled, busy, postponed, dead, "total"}
 	var proxyTypes = []string{"all", "rack", "free"}
 
-	for _, scraper := range config.Scrapers {
+	for _, scraper := range db.Scrapers() {
 		lines := makeProxiesNumbersData(scraper)
 		total := lines["all"]["total"]
 		if total == 0 {
 			log.Info().Str("scraper", scraper).Msg("no data at all")
 			continue
 		}
+		usage := manager.UsageOfQuota(scraper)
+		log.Info().
+			Str("scraper", scraper).
+			Int("busy", usage.Busy).
+			Int("max_busy", usage.MaxBusy).
+			Int("per_minute", usage.PerMinute).
+			Int("max_per_minute", usage.MaxPerMinute).
+			Int("rejected", usage.Rejected).
+			Msg("quota usage")
 		for _, proxyType := range proxyTypes {
 			for _, status := range toLogStatuses {
 				proxies := lines[proxyType][status]
@@ -114,9 +140,13 @@ func LogStats() {
 
 // HTMLStats outputs stats to html response
 func HTMLStats() (output string) {
-	toLogStatuses := []string{good, unchecked, available, busy, postponed, dead, "total"}
-	for _, scraper := range config.Scrapers {
+	toLogStatuses := []string{good, unchecked, available, throttled, busy, postponed, dead, "total"}
+	for _, scraper := range db.Scrapers() {
 		output += fmt.Sprintf("<br><br><strong>%s</strong><br>", scraper)
+		group, grouped := db.GroupOf(scraper)
+		if grouped {
+			output += fmt.Sprintf("group %s: %s<br>", group, strings.Join(db.GroupMembers(group), ", "))
+		}
 		t := table.NewWriter()
 		t.AppendHeader(table.Row{"Status", "Numbers all", "%", "Numbers free", "% free", "Numbers rack", "% rack"})
 		t.SetStyle(table.StyleLight)
@@ -138,20 +168,73 @@ func HTMLStats() (output string) {
 			t.AppendRow([]interface{}{name, allProxies, allProxiesPercent, freeProxies, freeProxiesPercent, rackProxies, rackProxiesPercent})
 		}
 		output += t.RenderHTML()
+		usage := manager.UsageOfQuota(scraper)
+		output += fmt.Sprintf("quota: busy %s, per minute %s, rejected %d<br>",
+			quotaString(usage.Busy, usage.MaxBusy), quotaString(usage.PerMinute, usage.MaxPerMinute), usage.Rejected)
+		circuit := manager.CircuitOf(scraper)
+		output += fmt.Sprintf("circuit: %s since %s<br>", circuit.State, UnixTimeString(circuit.Since))
+		if grouped {
+			output += groupUsageHTML(group)
+		}
 	}
 	return output
 }
 
+// groupUsageHTML outputs successful uses and failures of proxies shared by group, member by member
+func groupUsageHTML(group string) string {
+	t := table.NewWriter()
+	t.AppendHeader(table.Row{"Member", "Successful uses", "Failures", "Success %"})
+	t.SetStyle(table.StyleLight)
+	for _, member := range db.GroupMembers(group) {
+		var uses, failures int
+		for _, record := range db.Base.RangeScraper(member) {
+			uses += int(record.NumberOfSuccessfulUses)
+			failures += int(record.NumberOfFailures)
+		}
+		successPercent := 0.0
+		if uses+failures > 0 {
+			successPercent = math.Round(float64(uses) / float64(uses+failures) * 100)
+		}
+		t.AppendRow([]interface{}{member, uses, failures, successPercent})
+	}
+	return t.RenderHTML()
+}
+
 // ProxyUsefulnessStatsToCSV output internal stats to CSV
 func ProxyUsefulnessStatsToCSV(scraper, orderBy string) {
-	stats := make([]statRecord, 0)
+	writeCSV(ProxyUsefulnessStats(scraper, orderBy))
+}
+
+// ProxyUsefulnessStats returns usage of every proxy of scraper ordered by name, sdate, success, fdate, fail or latency
+func ProxyUsefulnessStats(scraper, orderBy string) []StatRecord {
+	stats := make([]StatRecord, 0)
+	currentTime := now.Time()
 	for proxy, record := range db.Base.RangeScraper(scraper) {
-		lineRecord := statRecord{
+		deadDomains := make([]string, 0, len(record.Domains))
+		for domain, health := range record.Domains {
+			if health.DeadUntil > currentTime {
+				deadDomains = append(deadDomains, domain)
+			}
+		}
+		sort.Strings(deadDomains)
+		lineRecord := StatRecord{
 			Proxy:                  proxy,
 			LastSuccessfullyUsed:   UnixTimeString(record.LastSuccessfullyUsed),
 			NumberOfSuccessfulUses: strconv.Itoa(int(record.NumberOfSuccessfulUses)),
 			LastFailureUsed:        UnixTimeString(record.LastFailureUsed),
 			NumberOfFailures:       strconv.Itoa(int(record.NumberOfFailures)),
+			LatencyMs:              latencyString(record.Latency, record.LatencySamples),
+			ExitIP:                 record.ExitIP,
+			Anonymity:              record.Anonymity,
+			FailureReasons:         failureReasonsString(record.FailureReasons),
+			DeadDomains:            strings.Join(deadDomains, " "),
+			latency:                unknownLatency,
+		}
+		if lineRecord.Anonymity == db.AnonymityUnknown {
+			lineRecord.Anonymity = "unknown"
+		}
+		if record.LatencySamples > 0 {
+			lineRecord.latency = record.Latency
 		}
 		stats = append(stats, lineRecord)
 	}
@@ -180,12 +263,16 @@ func ProxyUsefulnessStatsToCSV(scraper, orderBy string) {
 			sort.SliceStable(stats, func(i, j int) bool {
 				return stats[i].NumberOfFailures > stats[j].NumberOfFailures
 			})
+		case "latency":
+			sort.SliceStable(stats, func(i, j int) bool {
+				return stats[i].latency < stats[j].latency
+			})
 		}
 	}
-	writeCSV(stats)
+	return stats
 }
 
-func writeCSV(data []statRecord) {
+func writeCSV(data []StatRecord) {
 	file, err := os.Create(statsFilename)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Cannot create file")
@@ -193,7 +280,8 @@ func writeCSV(data []statRecord) {
 	defer file.Close()
 	writer := csv.NewWriter(file)
 	defer writer.Flush()
-	var header = []string{"proxy", "last_successfully_used", "number_of_successful_uses", "last_failure_used", "number_of_failures"}
+	var header = []string{"proxy", "last_successfully_used", "number_of_successful_uses", "last_failure_used", "number_of_failures", "latency_ms",
+		"exit_ip", "anonymity", "failure_reasons", "dead_domains"}
 	_ = writer.Write(header)
 	for _, record := range data {
 		line := []string{
@@ -202,6 +290,11 @@ func writeCSV(data []statRecord) {
 			record.NumberOfSuccessfulUses,
 			record.LastFailureUsed,
 			record.NumberOfFailures,
+			record.LatencyMs,
+			record.ExitIP,
+			record.Anonymity,
+			record.FailureReasons,
+			record.DeadDomains,
 		}
 		_ = writer.Write(line)
 	}
@@ -242,6 +335,31 @@ func UnixTimeString(unixTime int64) string {
 	return unitTimeInRFC3339
 }
 
+// quotaString formats usage of quota as "3/10", quota 0 is not limited
+func quotaString(used, quota int) string {
+	if quota == 0 {
+		return strconv.Itoa(used) + "/unlimited"
+	}
+	return strconv.Itoa(used) + "/" + strconv.Itoa(quota)
+}
+
+func latencyString(latency float64, samples int32) string {
+	if samples == 0 {
+		return "unknown"
+	}
+	return strconv.FormatFloat(latency, 'f', 1, 64)
+}
+
+// failureReasonsString formats counters as "banned:2 timeout:5"
+func failureReasonsString(reasons map[string]int32) string {
+	counters := make([]string, 0, len(reasons))
+	for reason, counter := range reasons {
+		counters = append(counters, reason+":"+strconv.Itoa(int(counter)))
+	}
+	sort.Strings(counters)
+	return strings.Join(counters, " ")
+}
+
 func countMinMax(array []int64) (mn, mx int64) {
 	mx = array[0]
 	mn = array[0]
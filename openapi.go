@@ -0,0 +1,17 @@
+package main
+
+import (
+	_ "embed"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// openAPISpec describes every route of setupRouter, openapi_test.go checks nothing is left out
+//
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+func routeOpenAPI(context *gin.Context) {
+	context.Data(http.StatusOK, "application/yaml; charset=utf-8", openAPISpec)
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/AlexeyYurko/go-pmserver/config"
+)
+
+// ginParam matches path parameter of gin route, like :scraper
+var ginParam = regexp.MustCompile(`:([A-Za-z_]+)`)
+
+func documentedOperations(t *testing.T) map[string]bool {
+	t.Helper()
+
+	var spec struct {
+		Paths map[string]map[string]yaml.Node `yaml:"paths"`
+	}
+
+	if err := yaml.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("openapi.yaml is not valid yaml: %v", err)
+	}
+
+	operations := make(map[string]bool)
+
+	for path, methods := range spec.Paths {
+		for method := range methods {
+			operations[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	return operations
+}
+
+func TestEveryRouteDocumented(t *testing.T) {
+	documented := documentedOperations(t)
+	registered := make(map[string]bool)
+
+	for _, route := range setupRouter().Routes() {
+		operation := route.Method + " " + ginParam.ReplaceAllString(route.Path, "{$1}")
+		registered[operation] = true
+
+		if !documented[operation] {
+			t.Errorf("route %s is not documented in openapi.yaml", operation)
+		}
+	}
+
+	for operation := range documented {
+		if !registered[operation] {
+			t.Errorf("openapi.yaml documents %s which is not registered", operation)
+		}
+	}
+}
+
+// boundTypes are types of other packages handlers bind query or body to, by name as written in handlers
+var boundTypes = map[string]reflect.Type{
+	"config.Backoff": reflect.TypeOf(config.Backoff{}),
+}
+
+// handlerParams are query parameters and top level body fields read by a handler
+type handlerParams struct {
+	query map[string]bool
+	body  map[string]bool
+}
+
+// sourceOf is parsed code of the package with its functions and types by name
+type sourceOf struct {
+	funcs map[string]*ast.FuncDecl
+	types map[string]ast.Expr
+}
+
+func parsePackage(t *testing.T) sourceOf {
+	t.Helper()
+
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := sourceOf{funcs: make(map[string]*ast.FuncDecl), types: make(map[string]ast.Expr)}
+	fileSet := token.NewFileSet()
+
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+
+		parsed, err := parser.ParseFile(fileSet, file, nil, parser.SkipObjectResolution)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, decl := range parsed.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv == nil {
+					source.funcs[decl.Name.Name] = decl
+				}
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					if typeSpec, ok := spec.(*ast.TypeSpec); ok {
+						source.types[typeSpec.Name.Name] = typeSpec.Type
+					}
+				}
+			}
+		}
+	}
+
+	return source
+}
+
+// paramsOf collects parameters read by handler and by functions of the package it calls
+func (s sourceOf) paramsOf(handler string) handlerParams {
+	params := handlerParams{query: make(map[string]bool), body: make(map[string]bool)}
+	s.collect(handler, params, make(map[string]bool))
+
+	return params
+}
+
+func (s sourceOf) collect(name string, params handlerParams, visited map[string]bool) {
+	decl, ok := s.funcs[name]
+	if !ok || visited[name] {
+		return
+	}
+
+	visited[name] = true
+	variables := variableTypes(decl)
+
+	ast.Inspect(decl.Body, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+
+		switch fun := call.Fun.(type) {
+		case *ast.Ident:
+			if fun.Name == "bindV2" && len(call.Args) == 2 {
+				s.addFields(params.body, variables, call.Args[1], "json")
+			}
+
+			s.collect(fun.Name, params, visited)
+		case *ast.SelectorExpr:
+			switch fun.Sel.Name {
+			case "Query", "DefaultQuery", "GetQuery":
+				if name, ok := stringLiteral(call.Args); ok {
+					params.query[name] = true
+				}
+			case "BindJSON", "ShouldBindJSON":
+				if len(call.Args) == 1 {
+					s.addFields(params.body, variables, call.Args[0], "json")
+				}
+			case "ShouldBindQuery", "BindQuery":
+				if len(call.Args) == 1 {
+					s.addFields(params.query, variables, call.Args[0], "form")
+				}
+			}
+		}
+
+		return true
+	})
+}
+
+// variableTypes returns types of variables declared in function, with its parameters and named results
+func variableTypes(decl *ast.FuncDecl) map[string]ast.Expr {
+	variables := make(map[string]ast.Expr)
+
+	fieldLists := []*ast.FieldList{decl.Type.Params, decl.Type.Results}
+	for _, list := range fieldLists {
+		if list == nil {
+			continue
+		}
+
+		for _, field := range list.List {
+			for _, name := range field.Names {
+				variables[name.Name] = field.Type
+			}
+		}
+	}
+
+	ast.Inspect(decl.Body, func(node ast.Node) bool {
+		if spec, ok := node.(*ast.ValueSpec); ok && spec.Type != nil {
+			for _, name := range spec.Names {
+				variables[name.Name] = spec.Type
+			}
+		}
+
+		return true
+	})
+
+	return variables
+}
+
+// addFields adds names of fields of struct bound through pointer argument, by tag
+func (s sourceOf) addFields(names map[string]bool, variables map[string]ast.Expr, argument ast.Expr, tag string) {
+	pointer, ok := argument.(*ast.UnaryExpr)
+	if !ok || pointer.Op != token.AND {
+		return
+	}
+
+	variable, ok := pointer.X.(*ast.Ident)
+	if !ok {
+		return
+	}
+
+	switch typeExpr := variables[variable.Name].(type) {
+	case *ast.StructType:
+		addTags(names, typeExpr, tag)
+	case *ast.Ident:
+		if structType, ok := s.types[typeExpr.Name].(*ast.StructType); ok {
+			addTags(names, structType, tag)
+		}
+	case *ast.SelectorExpr:
+		if bound, ok := boundTypes[typeExpr.X.(*ast.Ident).Name+"."+typeExpr.Sel.Name]; ok {
+			for i := 0; i < bound.NumField(); i++ {
+				if name := tagName(bound.Field(i).Tag.Get(tag)); name != "" {
+					names[name] = true
+				}
+			}
+		}
+	}
+}
+
+func addTags(names map[string]bool, structType *ast.StructType, tag string) {
+	for _, field := range structType.Fields.List {
+		if field.Tag == nil {
+			continue
+		}
+
+		value, err := strconv.Unquote(field.Tag.Value)
+		if err != nil {
+			continue
+		}
+
+		if name := tagName(reflect.StructTag(value).Get(tag)); name != "" {
+			names[name] = true
+		}
+	}
+}
+
+func tagName(tag string) string {
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "-" {
+		return ""
+	}
+
+	return name
+}
+
+func stringLiteral(args []ast.Expr) (string, bool) {
+	if len(args) == 0 {
+		return "", false
+	}
+
+	literal, ok := args[0].(*ast.BasicLit)
+	if !ok || literal.Kind != token.STRING {
+		return "", false
+	}
+
+	value, err := strconv.Unquote(literal.Value)
+
+	return value, err == nil
+}
+
+// documentedParams returns query parameters and top level body properties documented for every operation
+func documentedParams(t *testing.T) map[string]handlerParams {
+	t.Helper()
+
+	var spec map[string]any
+	if err := yaml.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("openapi.yaml is not valid yaml: %v", err)
+	}
+
+	resolve := func(node any) map[string]any {
+		for {
+			object, _ := node.(map[string]any)
+			ref, ok := object["$ref"].(string)
+			if !ok {
+				return object
+			}
+
+			node = spec
+			for _, key := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+				node = node.(map[string]any)[key]
+			}
+		}
+	}
+
+	documented := make(map[string]handlerParams)
+	paths, _ := spec["paths"].(map[string]any)
+
+	for path, methods := range paths {
+		for method, operation := range methods.(map[string]any) {
+			params := handlerParams{query: make(map[string]bool), body: make(map[string]bool)}
+			operationMap := resolve(operation)
+
+			parameters, _ := operationMap["parameters"].([]any)
+			for _, parameter := range parameters {
+				if parameter := resolve(parameter); parameter["in"] == "query" {
+					params.query[parameter["name"].(string)] = true
+				}
+			}
+
+			if body := resolve(operationMap["requestBody"]); body != nil {
+				content, _ := body["content"].(map[string]any)
+				jsonContent, _ := content["application/json"].(map[string]any)
+				schema := resolve(jsonContent["schema"])
+				properties, _ := schema["properties"].(map[string]any)
+
+				for property := range properties {
+					params.body[property] = true
+				}
+			}
+
+			documented[strings.ToUpper(method)+" "+path] = params
+		}
+	}
+
+	return documented
+}
+
+func difference(from, without map[string]bool) []string {
+	var names []string
+
+	for name := range from {
+		if !without[name] {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func TestDocumentedParametersRead(t *testing.T) {
+	source := parsePackage(t)
+	documented := documentedParams(t)
+
+	for _, route := range setupRouter().Routes() {
+		operation := route.Method + " " + ginParam.ReplaceAllString(route.Path, "{$1}")
+		handler := route.Handler[strings.LastIndex(route.Handler, ".")+1:]
+
+		if _, ok := source.funcs[handler]; !ok {
+			t.Errorf("%s: handler %s not found", operation, handler)
+
+			continue
+		}
+
+		read := source.paramsOf(handler)
+		spec := documented[operation]
+
+		for _, check := range []struct {
+			kind            string
+			read, described map[string]bool
+		}{
+			{kind: "query parameter", read: read.query, described: spec.query},
+			{kind: "body field", read: read.body, described: spec.body},
+		} {
+			if missing := difference(check.described, check.read); len(missing) > 0 {
+				t.Errorf("%s documents %s %v which %s does not read", operation, check.kind, missing, handler)
+			}
+
+			if missing := difference(check.read, check.described); len(missing) > 0 {
+				t.Errorf("%s reads %s %v which openapi.yaml does not document", operation, check.kind, missing)
+			}
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/AlexeyYurko/go-pmserver/manager"
+)
+
+const (
+	outcomeGood = "good"
+	outcomeDead = "dead"
+
+	maxOutcomes = 1000
+)
+
+// outcomeItem is one outcome of /report-outcomes,
+// format {"proxy": <proxy>, "outcome": <good, dead>, "reason": <reason, optional>, "latency": <ms, optional>,
+// "domain": <target domain, optional>}
+type outcomeItem struct {
+	Proxy   string   `json:"proxy"`
+	Outcome string   `json:"outcome"`
+	Reason  string   `json:"reason"`
+	Latency *float64 `json:"latency"`
+	Domain  string   `json:"domain"`
+}
+
+// outcomeResult tells what became of outcome, one of manager.Outcome* results
+type outcomeResult struct {
+	Proxy  string `json:"proxy"`
+	Result string `json:"result"`
+}
+
+// outcomesOf checks items the same way as /inc-good-attempts and /mark-dead, naming the first wrong one
+func outcomesOf(items []outcomeItem) ([]manager.Outcome, error) {
+	if len(items) == 0 {
+		return nil, errors.New("Empty outcomes list")
+	}
+
+	if len(items) > maxOutcomes {
+		return nil, fmt.Errorf("More than %d outcomes", maxOutcomes)
+	}
+
+	outcomes := make([]manager.Outcome, len(items))
+
+	for i, item := range items {
+		if item.Proxy == "" {
+			return nil, fmt.Errorf("Outcome %d: field proxy is empty", i)
+		}
+
+		if item.Outcome != outcomeGood && item.Outcome != outcomeDead {
+			return nil, fmt.Errorf("Outcome %d: field outcome should be good or dead", i)
+		}
+
+		if !manager.ValidReason(item.Reason) {
+			return nil, fmt.Errorf("Outcome %d: field reason should be one of %s", i, strings.Join(manager.FailureReasons, ", "))
+		}
+
+		latency := -1.0
+
+		if item.Latency != nil {
+			if *item.Latency < 0 {
+				return nil, fmt.Errorf("Outcome %d: field latency is not a positive number", i)
+			}
+
+			latency = *item.Latency
+		}
+
+		outcomes[i] = manager.Outcome{
+			Proxy:   item.Proxy,
+			Failed:  item.Outcome == outcomeDead,
+			Reason:  item.Reason,
+			Latency: latency,
+			Domain:  item.Domain,
+		}
+	}
+
+	return outcomes, nil
+}
+
+// reportOutcomes applies outcomes of scraper in order and pairs results with proxies
+func reportOutcomes(scraper string, outcomes []manager.Outcome) []outcomeResult {
+	results := make([]outcomeResult, len(outcomes))
+
+	for i, result := range manager.ReportOutcomes(scraper, outcomes) {
+		results[i] = outcomeResult{Proxy: outcomes[i].Proxy, Result: result}
+	}
+
+	return results
+}
+
+// routeReportOutcomes for reporting many outcomes in one request, applied in order
+// format {"scraper": <name>, "outcomes": [<outcome>, ...]}
+// answers {"results": [{"proxy": <proxy>, "result": <applied, ignored, unknown_proxy>}, ...]}
+func routeReportOutcomes(context *gin.Context) {
+	var json struct {
+		Scraper  string        `json:"scraper"`
+		Outcomes []outcomeItem `json:"outcomes"`
+	}
+
+	if err := context.BindJSON(&json); err != nil {
+		context.String(http.StatusForbidden, "Something went wrong")
+
+		return
+	}
+
+	if !scraperRegistered(context, json.Scraper, false) {
+		return
+	}
+
+	outcomes, err := outcomesOf(json.Outcomes)
+	if err != nil {
+		context.String(http.StatusForbidden, err.Error())
+
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"results": reportOutcomes(json.Scraper, outcomes)})
+}
+
+// routeV2ReportOutcomes format {"outcomes": [<outcome>, ...]}, answers the same as /report-outcomes
+func routeV2ReportOutcomes(context *gin.Context) {
+	scraper, ok := scraperV2(context, false)
+	if !ok {
+		return
+	}
+
+	var json struct {
+		Outcomes []outcomeItem `json:"outcomes"`
+	}
+
+	if !bindV2(context, &json) {
+		return
+	}
+
+	outcomes, err := outcomesOf(json.Outcomes)
+	if err != nil {
+		invalidV2(context, err.Error())
+
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"results": reportOutcomes(scraper, outcomes)})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/AlexeyYurko/go-pmserver/db"
+)
+
+// routeProxyAction for quarantining, pinning or blocklisting proxy
+// format {"scraper": <name, empty for all scrapers>, "proxy": <proxy>, "action": <quarantine, pin, block>,
+// "reason": <why>, "actor": <who>}
+func routeProxyAction(context *gin.Context) {
+	var json struct {
+		Scraper string `json:"scraper"`
+		Proxy   string `json:"proxy"`
+		Action  string `json:"action"`
+		Reason  string `json:"reason"`
+		Actor   string `json:"actor"`
+	}
+
+	if err := context.BindJSON(&json); err != nil || json.Proxy == "" {
+		context.String(http.StatusForbidden, "Field proxy is empty")
+
+		return
+	}
+
+	if !db.ValidAction(json.Action) {
+		context.String(http.StatusForbidden, "Field action should be quarantine, pin or block")
+
+		return
+	}
+
+	if json.Scraper != "" && !scraperRegistered(context, json.Scraper, false) {
+		return
+	}
+
+	db.TakeAction(db.ProxyAction{
+		Scraper: json.Scraper,
+		Proxy:   json.Proxy,
+		Action:  json.Action,
+		Reason:  json.Reason,
+		Actor:   actor(context, json.Actor),
+	})
+	context.String(http.StatusOK, "OK")
+}
+
+// routeReleaseProxy for cancelling action taken on proxy
+// format {"scraper": <name, empty for all scrapers>, "proxy": <proxy>, "actor": <who>}
+func routeReleaseProxy(context *gin.Context) {
+	var json struct {
+		Scraper string `json:"scraper"`
+		Proxy   string `json:"proxy"`
+		Actor   string `json:"actor"`
+	}
+
+	if err := context.BindJSON(&json); err != nil || json.Proxy == "" {
+		context.String(http.StatusForbidden, "Field proxy is empty")
+
+		return
+	}
+
+	if json.Scraper != "" && !scraperRegistered(context, json.Scraper, false) {
+		return
+	}
+
+	if err := db.ReleaseProxy(json.Scraper, json.Proxy, actor(context, json.Actor)); errors.Is(err, db.ErrNoAction) {
+		context.String(http.StatusNotFound, "No action taken on proxy "+json.Proxy)
+
+		return
+	}
+
+	context.String(http.StatusOK, "OK")
+}
+
+// routeListProxyActions shows actions taken for scraper and for all scrapers, every action if scraper is not given
+func routeListProxyActions(context *gin.Context) {
+	scraper := context.Query("scraper")
+	if scraper != "" && !scraperRegistered(context, scraper, false) {
+		return
+	}
+
+	actions := db.Actions.List(scraper)
+	if actions == nil {
+		actions = []db.ProxyAction{}
+	}
+
+	context.JSON(http.StatusOK, actions)
+}
+
+// actor is who took the action, address of the client if not told
+func actor(context *gin.Context, told string) string {
+	if told != "" {
+		return told
+	}
+
+	return context.ClientIP()
+}
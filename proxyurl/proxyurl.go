@@ -0,0 +1,43 @@
+// Package proxyurl reads proxy addresses in the forms proxy lists come in
+package proxyurl
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Parse converts proxy from the list to url. Plain host:port is http proxy,
+// host:port:user:password is proxy with credentials, with scheme in front or http without it
+func Parse(proxy string) (*url.URL, error) {
+	scheme, address, ok := strings.Cut(proxy, "://")
+	if !ok {
+		scheme, address = "http", proxy
+	}
+	if !strings.Contains(address, "@") {
+		if hostPort, user, password, ok := splitCredentials(address); ok {
+			return &url.URL{Scheme: scheme, User: url.UserPassword(user, password), Host: hostPort}, nil
+		}
+	}
+	return url.Parse(scheme + "://" + address)
+}
+
+// splitCredentials splits host:port:user:password, IPv6 address is written in brackets there,
+// the password may have colons in it
+func splitCredentials(address string) (hostPort, user, password string, ok bool) {
+	hostEnd := strings.Index(address, ":")
+	if strings.HasPrefix(address, "[") {
+		hostEnd = strings.Index(address, "]:") + 1
+	}
+	if hostEnd <= 0 {
+		return "", "", "", false
+	}
+	port, credentials, found := strings.Cut(address[hostEnd+1:], ":")
+	if !found || port == "" || strings.Trim(port, "0123456789") != "" {
+		return "", "", "", false
+	}
+	user, password, found = strings.Cut(credentials, ":")
+	if !found || user == "" {
+		return "", "", "", false
+	}
+	return address[:hostEnd] + ":" + port, user, password, true
+}
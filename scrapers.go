@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog/log"
+
+	"github.com/AlexeyYurko/go-pmserver/db"
+)
+
+// scraperRegistered checks scraper is given and registered, writing 403 or 404 response if it is not.
+// Unknown scraper is registered on the fly if autoCreate is set.
+func scraperRegistered(context *gin.Context, scraper string, autoCreate bool) bool {
+	if scraper == "" {
+		context.String(http.StatusForbidden, "Field scraper is empty")
+
+		return false
+	}
+
+	if ensureScraper(scraper, autoCreate) {
+		return true
+	}
+
+	context.String(http.StatusNotFound, "Unknown scraper "+scraper)
+
+	return false
+}
+
+// ensureScraper checks scraper is registered, registering unknown one if autoCreate is set
+func ensureScraper(scraper string, autoCreate bool) bool {
+	if db.ScraperExists(scraper) {
+		return true
+	}
+
+	if autoCreate {
+		err := db.AddScraper(scraper)
+		if err == nil || errors.Is(err, db.ErrScraperExists) {
+			log.Info().Str("scraper", scraper).Msg("Scraper registered on first use")
+
+			return true
+		}
+	}
+
+	return false
+}
+
+func routeListScrapers(context *gin.Context) {
+	scrapers := db.Scrapers()
+	sort.Strings(scrapers)
+	context.String(http.StatusOK, strings.Join(scrapers, "\n"))
+}
+
+// routeAddScraper for registering new scraper
+// format {"scraper": <name>}
+// new scraper gets all proxies shared between scrapers.
+func routeAddScraper(context *gin.Context) {
+	var json struct {
+		Scraper string `json:"scraper"`
+	}
+
+	if err := context.BindJSON(&json); err != nil || strings.TrimSpace(json.Scraper) == "" {
+		context.String(http.StatusForbidden, "Field scraper is empty")
+
+		return
+	}
+
+	if err := db.AddScraper(strings.TrimSpace(json.Scraper)); err != nil {
+		context.String(http.StatusConflict, err.Error())
+
+		return
+	}
+
+	context.String(http.StatusOK, "OK")
+}
+
+// routeRenameScraper for renaming scraper keeping its proxies
+// format {"scraper": <name>, "new_name": <new name>}
+func routeRenameScraper(context *gin.Context) {
+	var json struct {
+		Scraper string `json:"scraper"`
+		NewName string `json:"new_name"`
+	}
+
+	if err := context.BindJSON(&json); err != nil || json.Scraper == "" || strings.TrimSpace(json.NewName) == "" {
+		context.String(http.StatusForbidden, "Field scraper or new_name is empty")
+
+		return
+	}
+
+	newName := strings.TrimSpace(json.NewName)
+
+	switch err := db.RenameScraper(json.Scraper, newName); {
+	case errors.Is(err, db.ErrUnknownScraper):
+		context.String(http.StatusNotFound, "Unknown scraper "+json.Scraper)
+
+		return
+	case err != nil:
+		context.String(http.StatusConflict, err.Error())
+
+		return
+	}
+
+	context.String(http.StatusOK, "OK")
+}
+
+// routeDeleteScraper for removing scraper with all its proxies
+// format {"scraper": <name>}
+func routeDeleteScraper(context *gin.Context) {
+	var json struct {
+		Scraper string `json:"scraper"`
+	}
+
+	if err := context.BindJSON(&json); err != nil || json.Scraper == "" {
+		context.String(http.StatusForbidden, "Field scraper is empty")
+
+		return
+	}
+
+	if err := db.RemoveScraper(json.Scraper); err != nil {
+		context.String(http.StatusNotFound, "Unknown scraper "+json.Scraper)
+
+		return
+	}
+
+	context.String(http.StatusOK, "OK")
+}
@@ -0,0 +1,230 @@
+package source
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	percent        = 100
+	maxBodySize    = 32 << 20 // 32 MiB is far more than any proxy list we get
+	defaultTimeout = 30 * time.Second
+	// shrinkConfirmations rejections of lists of similar size in a row make a real shrink of the source
+	shrinkConfirmations = 3
+	// similarSizePercent how much sizes of rejected lists may differ to be counted as the same shrink
+	similarSizePercent = 10
+)
+
+var (
+	// ErrNotModified returned when the source answered 304 to a conditional request
+	ErrNotModified = errors.New("proxy list not modified")
+	// ErrListShrank returned when the new list is suspiciously smaller than the previous one
+	ErrListShrank = errors.New("proxy list shrank too much")
+	// ErrEmptyList returned when the source responded with no proxies at all
+	ErrEmptyList = errors.New("proxy list is empty")
+)
+
+// StatusError describes an unexpected HTTP status from the proxy source
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d", e.StatusCode)
+}
+
+// retryable reports whether another attempt could give a different answer
+func (e *StatusError) retryable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= http.StatusInternalServerError
+}
+
+// Fetcher downloads proxy lists from a single source
+type Fetcher struct {
+	URL              string
+	Username         string
+	Password         string
+	Retries          int
+	RetryBackoff     time.Duration
+	MaxShrinkPercent int
+	Client           *http.Client
+
+	mu           sync.Mutex
+	etag         string
+	lastModified string
+	lastCount    int
+	// shrunkCount size of the last rejected list and shrinkRejections how many similar ones were rejected in a row
+	shrunkCount      int
+	shrinkRejections int
+}
+
+// NewFetcher creates fetcher with own http client limited by timeout
+func NewFetcher(url, username, password string, timeout time.Duration) *Fetcher {
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	return &Fetcher{
+		URL:      url,
+		Username: username,
+		Password: password,
+		Client:   &http.Client{Timeout: timeout},
+	}
+}
+
+// Fetch downloads the proxy list retrying transient errors with exponential backoff.
+// ErrNotModified is returned if the list did not change since the last successful fetch.
+func (f *Fetcher) Fetch(ctx context.Context) ([]string, error) {
+	var err error
+	backoff := f.RetryBackoff
+	for attempt := 0; attempt <= f.Retries; attempt++ {
+		if attempt > 0 {
+			log.Warn().Err(err).Int("attempt", attempt).Dur("backoff", backoff).Msg("Retrying proxy list download")
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		var proxies []string
+		proxies, err = f.fetchOnce(ctx)
+		if err == nil {
+			return f.accept(proxies)
+		}
+		if !retryable(err) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+func (f *Fetcher) fetchOnce(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.URL, http.NoBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	if f.Username != "" || f.Password != "" {
+		req.SetBasicAuth(f.Username, f.Password)
+	}
+	f.mu.Lock()
+	if f.etag != "" {
+		req.Header.Set("If-None-Match", f.etag)
+	}
+	if f.lastModified != "" {
+		req.Header.Set("If-Modified-Since", f.lastModified)
+	}
+	f.mu.Unlock()
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, ErrNotModified
+	}
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxBodySize))
+		return nil, &StatusError{StatusCode: resp.StatusCode}
+	}
+
+	proxies, err := parseList(io.LimitReader(resp.Body, maxBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	f.mu.Lock()
+	f.etag = resp.Header.Get("ETag")
+	f.lastModified = resp.Header.Get("Last-Modified")
+	f.mu.Unlock()
+
+	return proxies, nil
+}
+
+// accept runs sanity checks against the previous list before handing proxies out
+func (f *Fetcher) accept(proxies []string) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(proxies) == 0 {
+		f.forgetValidators()
+		return nil, ErrEmptyList
+	}
+	if f.MaxShrinkPercent > 0 && f.lastCount > 0 {
+		minCount := f.lastCount * (percent - f.MaxShrinkPercent) / percent
+		if len(proxies) < minCount && !f.shrinkConfirmed(len(proxies)) {
+			f.forgetValidators()
+			return nil, fmt.Errorf("%w: %d proxies, previously %d", ErrListShrank, len(proxies), f.lastCount)
+		}
+	}
+	f.lastCount = len(proxies)
+	f.shrunkCount, f.shrinkRejections = 0, 0
+	return proxies, nil
+}
+
+// shrinkConfirmed counts rejected list of count proxies, a source returning lists of similar size
+// shrinkConfirmations times in a row has shrunk for real and its list becomes the new baseline
+func (f *Fetcher) shrinkConfirmed(count int) bool {
+	if f.shrinkRejections > 0 && similarSize(count, f.shrunkCount) {
+		f.shrinkRejections++
+	} else {
+		f.shrinkRejections = 1
+	}
+	f.shrunkCount = count
+	if f.shrinkRejections < shrinkConfirmations {
+		return false
+	}
+	log.Warn().Int("proxies", count).Int("previously", f.lastCount).Msg("Proxy list shrank for good, accepting it")
+	return true
+}
+
+func similarSize(a, b int) bool {
+	diff := a - b
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff*percent <= max(a, b)*similarSizePercent
+}
+
+// forgetValidators drops ETag and Last-Modified of a rejected list,
+// so the next fetch downloads it again instead of getting 304
+func (f *Fetcher) forgetValidators() {
+	f.etag = ""
+	f.lastModified = ""
+}
+
+func retryable(err error) bool {
+	if errors.Is(err, ErrNotModified) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.retryable()
+	}
+	return true
+}
+
+// parseList splits body into proxies skipping blank lines and comments
+func parseList(body io.Reader) (proxies []string, err error) {
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		proxies = append(proxies, line)
+	}
+	err = scanner.Err()
+	return
+}
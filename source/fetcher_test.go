@@ -0,0 +1,148 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func proxyList(count int) string {
+	var list strings.Builder
+	for i := 0; i < count; i++ {
+		fmt.Fprintf(&list, "10.0.%d.%d:8080\n", i/250, i%250+1)
+	}
+	return list.String()
+}
+
+func TestFetchRetriesTransientErrors(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "# comment\n\n1.1.1.1:80\n2.2.2.2:80\n")
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher(server.URL, "", "", 0)
+	fetcher.Retries = 2
+	proxies, err := fetcher.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	if len(proxies) != 2 || proxies[0] != "1.1.1.1:80" || proxies[1] != "2.2.2.2:80" {
+		t.Errorf("proxies = %v", proxies)
+	}
+	if requests.Load() != 3 {
+		t.Errorf("requests = %d, want 3", requests.Load())
+	}
+}
+
+func TestFetchDoesNotRetryClientErrors(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher(server.URL, "", "", 0)
+	fetcher.Retries = 3
+	_, err := fetcher.Fetch(context.Background())
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusForbidden {
+		t.Fatalf("err = %v, want status 403", err)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("requests = %d, want 1", requests.Load())
+	}
+}
+
+func TestFetchConditionalRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, _ := r.BasicAuth(); user != "user" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, "1.1.1.1:80\n")
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher(server.URL, "user", "secret", 0)
+	if _, err := fetcher.Fetch(context.Background()); err != nil {
+		t.Fatalf("first Fetch: %v", err)
+	}
+	if _, err := fetcher.Fetch(context.Background()); !errors.Is(err, ErrNotModified) {
+		t.Fatalf("second Fetch err = %v, want ErrNotModified", err)
+	}
+}
+
+func TestFetchEmptyList(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "# nothing today\n")
+	}))
+	defer server.Close()
+
+	if _, err := NewFetcher(server.URL, "", "", 0).Fetch(context.Background()); !errors.Is(err, ErrEmptyList) {
+		t.Fatalf("err = %v, want ErrEmptyList", err)
+	}
+}
+
+func TestFetchShrink(t *testing.T) {
+	var size atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, size.Load()))
+		fmt.Fprint(w, proxyList(int(size.Load())))
+	}))
+	defer server.Close()
+
+	fetcher := NewFetcher(server.URL, "", "", 0)
+	fetcher.MaxShrinkPercent = 50
+
+	steps := []struct {
+		size   int32
+		shrank bool
+	}{
+		{size: 100},
+		// a single dip is refused, a different one starts counting again
+		{size: 10, shrank: true},
+		{size: 40, shrank: true},
+		{size: 41, shrank: true},
+		// the third list of similar size in a row is a real shrink and becomes the baseline
+		{size: 40},
+		{size: 30},
+		{size: 100},
+		{size: 20, shrank: true},
+		// accepted list resets the count
+		{size: 100},
+		{size: 20, shrank: true},
+		{size: 20, shrank: true},
+	}
+	for i, step := range steps {
+		size.Store(step.size)
+		proxies, err := fetcher.Fetch(context.Background())
+		if step.shrank {
+			if !errors.Is(err, ErrListShrank) {
+				t.Fatalf("step %d: err = %v, want ErrListShrank", i, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("step %d: %v", i, err)
+		}
+		if len(proxies) != int(step.size) {
+			t.Fatalf("step %d: got %d proxies, want %d", i, len(proxies), step.size)
+		}
+	}
+}